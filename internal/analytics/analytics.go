@@ -0,0 +1,322 @@
+package analytics
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// one rep max estimates are only reliable for lower rep ranges
+const maxRepsForEstimate = 12
+
+// SQL versions of the Epley, Brzycki and Lombardi one rep max formulas for a set s
+const (
+	epleySQL    = `s.weight * (1 + s.reps / 30.0)`
+	brzyckiSQL  = `s.weight * 36.0 / (37 - s.reps)`
+	lombardiSQL = `s.weight * POWER(s.reps, 0.10)`
+)
+
+var ErrInvalidGranularity = errors.New("granularity must be week or month")
+
+type StatsQuery struct {
+	UserID      int
+	From        time.Time
+	To          time.Time
+	Granularity string
+}
+
+type Stats struct {
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	Granularity  string            `json:"granularity"`
+	Totals       Totals            `json:"totals"`
+	Periods      []Period          `json:"periods"`
+	MuscleGroups []MuscleGroupSets `json:"muscle_groups"`
+	OneRepMax    []OneRepMaxTrend  `json:"one_rep_max"`
+}
+
+type Totals struct {
+	Workouts        int     `json:"workouts"`
+	DurationMinutes int     `json:"duration_minutes"`
+	CaloriesBurned  int     `json:"calories_burned"`
+	Tonnage         float64 `json:"tonnage"`
+	Sets            int     `json:"sets"`
+}
+
+// Period holds the totals of a single week or month
+type Period struct {
+	Start           time.Time `json:"start"`
+	Workouts        int       `json:"workouts"`
+	DurationMinutes int       `json:"duration_minutes"`
+	CaloriesBurned  int       `json:"calories_burned"`
+	Tonnage         float64   `json:"tonnage"`
+	Sets            int       `json:"sets"`
+}
+
+type MuscleGroupSets struct {
+	MuscleGroup string `json:"muscle_group"`
+	Sets        int    `json:"sets"`
+}
+
+type OneRepMaxTrend struct {
+	ExerciseID   *int             `json:"exercise_id"`
+	ExerciseName string           `json:"exercise_name"`
+	Points       []OneRepMaxPoint `json:"points"`
+}
+
+type OneRepMaxPoint struct {
+	PeriodStart time.Time `json:"period_start"`
+	Epley       float64   `json:"epley"`
+	Brzycki     float64   `json:"brzycki"`
+	Lombardi    float64   `json:"lombardi"`
+}
+
+type PostgresStatsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStatsStore(db *sql.DB) *PostgresStatsStore {
+	return &PostgresStatsStore{
+		db: db,
+	}
+}
+
+type StatsStore interface {
+	GetStats(query StatsQuery) (*Stats, error)
+	Leaderboard(orgID int64, from, to time.Time) ([]LeaderboardEntry, error)
+	Attendance(orgID int64, from, to time.Time) ([]MemberAttendance, error)
+}
+
+func (pg *PostgresStatsStore) GetStats(query StatsQuery) (*Stats, error) {
+	if query.Granularity != GranularityWeek && query.Granularity != GranularityMonth {
+		return nil, ErrInvalidGranularity
+	}
+
+	stats := &Stats{
+		From:        query.From,
+		To:          query.To,
+		Granularity: query.Granularity,
+	}
+
+	var err error
+
+	stats.Periods, err = pg.periods(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, period := range stats.Periods {
+		stats.Totals.Workouts += period.Workouts
+		stats.Totals.DurationMinutes += period.DurationMinutes
+		stats.Totals.CaloriesBurned += period.CaloriesBurned
+		stats.Totals.Tonnage += period.Tonnage
+		stats.Totals.Sets += period.Sets
+	}
+
+	stats.MuscleGroups, err = pg.muscleGroups(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats.OneRepMax, err = pg.oneRepMax(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// periods returns the workout totals and the tonnage (weight x reps of the
+// completed working sets) per week or month, planned workouts aren't done yet
+func (pg *PostgresStatsStore) periods(query StatsQuery) ([]Period, error) {
+	sqlQuery := `
+	WITH workout_periods AS (
+		SELECT date_trunc($4, w.performed_at AT TIME ZONE w.timezone) AS period,
+			COUNT(*) AS workouts,
+			SUM(w.duration_minutes) AS duration_minutes,
+			SUM(COALESCE(w.calories_burned, 0)) AS calories_burned
+		FROM workouts w
+		WHERE w.user_id = $1 AND w.performed_at >= $2 AND w.performed_at < $3 AND NOT w.planned
+		GROUP BY 1
+	), volume_periods AS (
+		SELECT date_trunc($4, w.performed_at AT TIME ZONE w.timezone) AS period,
+			SUM(s.weight * s.reps) AS tonnage,
+			COUNT(s.id) AS sets
+		FROM workouts w
+		INNER JOIN workout_entries we ON we.workout_id = w.id
+		INNER JOIN workout_sets s ON s.workout_entry_id = we.id
+		WHERE w.user_id = $1 AND w.performed_at >= $2 AND w.performed_at < $3
+			AND s.completed AND s.set_type <> 'warmup'
+		GROUP BY 1
+	)
+	SELECT wp.period, wp.workouts, wp.duration_minutes, wp.calories_burned,
+		COALESCE(vp.tonnage, 0), COALESCE(vp.sets, 0)
+	FROM workout_periods wp
+	LEFT JOIN volume_periods vp ON vp.period = wp.period
+	ORDER BY wp.period
+	`
+
+	rows, err := pg.db.Query(sqlQuery, query.UserID, query.From, query.To, query.Granularity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	periods := []Period{}
+
+	for rows.Next() {
+		var period Period
+
+		err := rows.Scan(
+			&period.Start,
+			&period.Workouts,
+			&period.DurationMinutes,
+			&period.CaloriesBurned,
+			&period.Tonnage,
+			&period.Sets,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		periods = append(periods, period)
+	}
+
+	return periods, rows.Err()
+}
+
+// muscleGroups counts the working sets per primary muscle group of the catalog exercises
+func (pg *PostgresStatsStore) muscleGroups(query StatsQuery) ([]MuscleGroupSets, error) {
+	sqlQuery := `
+	SELECT muscle_group, COUNT(*) AS sets
+	FROM workouts w
+	INNER JOIN workout_entries we ON we.workout_id = w.id
+	INNER JOIN workout_sets s ON s.workout_entry_id = we.id
+	INNER JOIN exercises e ON e.id = we.exercise_id
+	CROSS JOIN LATERAL unnest(e.primary_muscles) AS muscle_group
+	WHERE w.user_id = $1 AND w.performed_at >= $2 AND w.performed_at < $3
+		AND s.completed AND s.set_type <> 'warmup'
+	GROUP BY muscle_group
+	ORDER BY sets DESC, muscle_group
+	`
+
+	rows, err := pg.db.Query(sqlQuery, query.UserID, query.From, query.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []MuscleGroupSets{}
+
+	for rows.Next() {
+		var group MuscleGroupSets
+
+		err := rows.Scan(&group.MuscleGroup, &group.Sets)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// oneRepMax returns the best estimated one rep max per exercise and period
+func (pg *PostgresStatsStore) oneRepMax(query StatsQuery) ([]OneRepMaxTrend, error) {
+	// catalog exercises are grouped by id, free text names case insensitive
+	sqlQuery := `
+	SELECT COALESCE(we.exercise_id::text, LOWER(we.exercise_name)) AS exercise, MIN(we.exercise_id), MIN(we.exercise_name),
+		date_trunc($4, w.performed_at AT TIME ZONE w.timezone) AS period,
+		ROUND(MAX(` + epleySQL + `)::numeric, 2),
+		ROUND(MAX(` + brzyckiSQL + `)::numeric, 2),
+		ROUND(MAX(` + lombardiSQL + `)::numeric, 2)
+	FROM workouts w
+	INNER JOIN workout_entries we ON we.workout_id = w.id
+	INNER JOIN workout_sets s ON s.workout_entry_id = we.id
+	WHERE w.user_id = $1 AND w.performed_at >= $2 AND w.performed_at < $3
+		AND s.completed AND s.set_type <> 'warmup'
+		AND s.weight > 0 AND s.reps BETWEEN 1 AND $5
+	GROUP BY exercise, period
+	ORDER BY exercise, period
+	`
+
+	rows, err := pg.db.Query(sqlQuery, query.UserID, query.From, query.To, query.Granularity, maxRepsForEstimate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	points := []oneRepMaxRow{}
+
+	for rows.Next() {
+		var row oneRepMaxRow
+
+		err := rows.Scan(&row.Exercise, &row.ExerciseID, &row.ExerciseName, &row.Point.PeriodStart, &row.Point.Epley, &row.Point.Brzycki, &row.Point.Lombardi)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, row)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return groupOneRepMax(points), nil
+}
+
+// oneRepMaxRow is a single period of an exercise, Exercise is the key the
+// rows are grouped and ordered by
+type oneRepMaxRow struct {
+	Exercise     string
+	ExerciseID   *int
+	ExerciseName string
+	Point        OneRepMaxPoint
+}
+
+// groupOneRepMax turns the rows into a trend per exercise sorted by name, the
+// first name of an exercise is used for the whole trend
+func groupOneRepMax(rows []oneRepMaxRow) []OneRepMaxTrend {
+	trends := []OneRepMaxTrend{}
+	last := ""
+
+	for _, row := range rows {
+		// rows are ordered by exercise, so a new exercise starts a new trend
+		if len(trends) == 0 || row.Exercise != last {
+			trends = append(trends, OneRepMaxTrend{ExerciseID: row.ExerciseID, ExerciseName: row.ExerciseName, Points: []OneRepMaxPoint{}})
+			last = row.Exercise
+		}
+
+		trend := &trends[len(trends)-1]
+		trend.Points = append(trend.Points, row.Point)
+	}
+
+	sort.SliceStable(trends, func(i, j int) bool {
+		return strings.ToLower(trends[i].ExerciseName) < strings.ToLower(trends[j].ExerciseName)
+	})
+
+	return trends
+}
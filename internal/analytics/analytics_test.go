@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupOneRepMax(t *testing.T) {
+	week1 := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	week2 := week1.AddDate(0, 0, 7)
+	benchPressID := 1
+	backSquatID := 2
+
+	// rows as the query returns them, ordered by exercise key and period
+	rows := []oneRepMaxRow{
+		{Exercise: "1", ExerciseID: &benchPressID, ExerciseName: "Bench Press", Point: OneRepMaxPoint{PeriodStart: week1, Epley: 100}},
+		{Exercise: "1", ExerciseID: &benchPressID, ExerciseName: "Bench Press", Point: OneRepMaxPoint{PeriodStart: week2, Epley: 102.5}},
+		{Exercise: "bench press", ExerciseName: "bench press", Point: OneRepMaxPoint{PeriodStart: week1, Epley: 90}},
+		// a free text name logged with different case in another week
+		{Exercise: "zercher squat", ExerciseName: "zercher squat", Point: OneRepMaxPoint{PeriodStart: week1, Epley: 80}},
+		{Exercise: "zercher squat", ExerciseName: "Zercher Squat", Point: OneRepMaxPoint{PeriodStart: week2, Epley: 85}},
+		{Exercise: "2", ExerciseID: &backSquatID, ExerciseName: "Back Squat", Point: OneRepMaxPoint{PeriodStart: week1, Epley: 140}},
+	}
+
+	trends := groupOneRepMax(rows)
+
+	require.Len(t, trends, 4)
+
+	assert.Equal(t, "Back Squat", trends[0].ExerciseName)
+
+	// the catalog exercise and the free text name are separate trends
+	assert.Equal(t, &benchPressID, trends[1].ExerciseID)
+	assert.Len(t, trends[1].Points, 2)
+	assert.Nil(t, trends[2].ExerciseID)
+	assert.Len(t, trends[2].Points, 1)
+
+	assert.Equal(t, "zercher squat", trends[3].ExerciseName)
+	assert.Len(t, trends[3].Points, 2)
+	assert.Equal(t, 85.0, trends[3].Points[1].Epley)
+}
@@ -0,0 +1,119 @@
+package analytics
+
+import "time"
+
+// LeaderboardEntry is the training volume of a member of an organization, the
+// tonnage of their completed working sets
+type LeaderboardEntry struct {
+	Rank     int     `json:"rank"`
+	UserID   int     `json:"user_id"`
+	Username string  `json:"username"`
+	Tonnage  float64 `json:"tonnage"`
+	Sets     int     `json:"sets"`
+	Workouts int     `json:"workouts"`
+}
+
+// MemberAttendance counts the workouts of a member and the days they trained
+type MemberAttendance struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Workouts int    `json:"workouts"`
+	Days     int    `json:"days"`
+}
+
+// WeekStart returns the start of the week of t, monday 00:00 UTC like
+// date_trunc('week') in postgres
+func WeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	// sunday is 0, it belongs to the week that started 6 days earlier
+	offset := (int(day.Weekday()) + 6) % 7
+
+	return day.AddDate(0, 0, -offset)
+}
+
+// Leaderboard ranks every member of the organization by their tonnage between
+// from and to, members that didn't train are at the bottom with 0. Only the
+// workouts a member shares with the organization or with everyone count,
+// followers workouts are meant for the followers the member accepted
+func (pg *PostgresStatsStore) Leaderboard(orgID int64, from, to time.Time) ([]LeaderboardEntry, error) {
+	query := `
+	SELECT RANK() OVER (ORDER BY COALESCE(SUM(s.weight * s.reps), 0) DESC),
+		m.user_id, u.username, COALESCE(SUM(s.weight * s.reps), 0), COUNT(s.id), COUNT(DISTINCT w.id)
+	FROM organization_members m
+	INNER JOIN users u ON u.id = m.user_id
+	LEFT JOIN workouts w ON w.user_id = m.user_id AND w.performed_at >= $2 AND w.performed_at < $3 AND NOT w.planned
+		AND w.visibility IN ('org', 'public')
+	LEFT JOIN workout_entries we ON we.workout_id = w.id
+	LEFT JOIN workout_sets s ON s.workout_entry_id = we.id AND s.completed AND s.set_type <> 'warmup'
+	WHERE m.organization_id = $1 AND m.status = 'accepted'
+	GROUP BY m.user_id, u.username
+	ORDER BY 1, u.username
+	`
+
+	rows, err := pg.db.Query(query, orgID, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []LeaderboardEntry{}
+
+	for rows.Next() {
+		var entry LeaderboardEntry
+
+		err := rows.Scan(&entry.Rank, &entry.UserID, &entry.Username, &entry.Tonnage, &entry.Sets, &entry.Workouts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Attendance counts the workouts and training days, in the timezone of each
+// workout, of every member of the organization between from and to. Like the
+// leaderboard it only counts the workouts a member shares.
+func (pg *PostgresStatsStore) Attendance(orgID int64, from, to time.Time) ([]MemberAttendance, error) {
+	query := `
+	SELECT m.user_id, u.username, COUNT(w.id),
+		COUNT(DISTINCT (w.performed_at AT TIME ZONE w.timezone)::date)
+	FROM organization_members m
+	INNER JOIN users u ON u.id = m.user_id
+	LEFT JOIN workouts w ON w.user_id = m.user_id AND w.performed_at >= $2 AND w.performed_at < $3 AND NOT w.planned
+		AND w.visibility IN ('org', 'public')
+	WHERE m.organization_id = $1 AND m.status = 'accepted'
+	GROUP BY m.user_id, u.username
+	ORDER BY 4 DESC, u.username
+	`
+
+	rows, err := pg.db.Query(query, orgID, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	attendance := []MemberAttendance{}
+
+	for rows.Next() {
+		var member MemberAttendance
+
+		err := rows.Scan(&member.UserID, &member.Username, &member.Workouts, &member.Days)
+
+		if err != nil {
+			return nil, err
+		}
+
+		attendance = append(attendance, member)
+	}
+
+	return attendance, rows.Err()
+}
@@ -0,0 +1,30 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeekStart(t *testing.T) {
+	monday := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   time.Time
+		want time.Time
+	}{
+		{name: "monday", in: monday, want: monday},
+		{name: "wednesday afternoon", in: time.Date(2025, 6, 4, 15, 30, 0, 0, time.UTC), want: monday},
+		{name: "sunday night", in: time.Date(2025, 6, 8, 23, 59, 0, 0, time.UTC), want: monday},
+		{name: "next monday", in: time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC), want: monday.AddDate(0, 0, 7)},
+		{name: "other timezone", in: time.Date(2025, 6, 9, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), want: monday},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, WeekStart(tt.in))
+		})
+	}
+}
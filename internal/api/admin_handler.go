@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// AdminHandler is the admin api, its routes are only for admins
+type AdminHandler struct {
+	userStore store.UserStore
+	issuer    *TokenIssuer
+	logger    *log.Logger
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func NewAdminHandler(userStore store.UserStore, issuer *TokenIssuer, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore: userStore,
+		issuer:    issuer,
+		logger:    logger,
+	}
+}
+
+// getUser writes the error response itself and returns nil when the user of
+// the id param doesn't exist
+func (ah *AdminHandler) getUser(w http.ResponseWriter, r *http.Request) *store.User {
+	userID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return nil
+	}
+
+	user, err := ah.userStore.GetUserByID(int(userID))
+
+	if err != nil {
+		ah.logger.Printf("ERROR: getUserByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return nil
+	}
+
+	return user
+}
+
+// getOtherUser is getUser for the changes admins can't make to themselves, so
+// they can't lock themselves out
+func (ah *AdminHandler) getOtherUser(w http.ResponseWriter, r *http.Request) *store.User {
+	user := ah.getUser(w, r)
+
+	if user != nil && user.ID == middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "you can't do this to your own account"})
+		return nil
+	}
+
+	return user
+}
+
+// HandleListUsers searches the users by a part of their username or email
+// (q), role and whether they are disabled
+func (ah *AdminHandler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := store.UserFilter{
+		Query: strings.TrimSpace(query.Get("q")),
+		Role:  query.Get("role"),
+		Limit: defaultListLimit,
+	}
+
+	if filter.Role != "" && !authz.ValidRole(filter.Role) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("role must be one of %s", strings.Join(store.Roles, ", "))})
+		return
+	}
+
+	if value := query.Get("disabled"); value != "" {
+		disabled, err := strconv.ParseBool(value)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "disabled must be true or false"})
+			return
+		}
+
+		filter.Disabled = &disabled
+	}
+
+	limit, err := utils.ReadIntQuery(r, "limit")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if limit != nil {
+		if *limit < 1 || *limit > maxListLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	offset, err := utils.ReadIntQuery(r, "offset")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if offset != nil {
+		if *offset < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "offset can't be negative"})
+			return
+		}
+		filter.Offset = *offset
+	}
+
+	users, total, err := ah.userStore.SearchUsers(filter)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: searchUsers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"users": users, "total": total})
+}
+
+func (ah *AdminHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	user := ah.getUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleSetRole changes the role of a user. The user is signed out
+// everywhere, a JWT would keep the old role until it expires otherwise.
+func (ah *AdminHandler) HandleSetRole(w http.ResponseWriter, r *http.Request) {
+	user := ah.getOtherUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	var req setRoleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: decodingSetRole: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if !authz.ValidRole(req.Role) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("role must be one of %s", strings.Join(store.Roles, ", "))})
+		return
+	}
+
+	if req.Role == user.Role {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+		return
+	}
+
+	err = ah.userStore.SetUserRole(user, req.Role)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: setUserRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = ah.issuer.RevokeAll(user.ID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: revokeAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.logger.Printf("INFO: %s changed the role of %s to %s", middleware.GetUser(r).Username, user.Username, user.Role)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleDisableUser disables an account and signs it out everywhere, its api
+// keys stop working too
+func (ah *AdminHandler) HandleDisableUser(w http.ResponseWriter, r *http.Request) {
+	user := ah.getOtherUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	err := ah.userStore.SetUserDisabled(user, true)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: setUserDisabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = ah.issuer.RevokeAll(user.ID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: revokeAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.logger.Printf("INFO: %s disabled %s", middleware.GetUser(r).Username, user.Username)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (ah *AdminHandler) HandleEnableUser(w http.ResponseWriter, r *http.Request) {
+	user := ah.getUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	err := ah.userStore.SetUserDisabled(user, false)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: setUserDisabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.logger.Printf("INFO: %s enabled %s", middleware.GetUser(r).Username, user.Username)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleRevokeTokens signs a user out everywhere, for when an account looks
+// compromised. Api keys are left alone, disable the account to stop those.
+func (ah *AdminHandler) HandleRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	user := ah.getUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	err := ah.issuer.RevokeAll(user.ID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: revokeAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	ah.logger.Printf("INFO: %s revoked the tokens of %s", middleware.GetUser(r).Username, user.Username)
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
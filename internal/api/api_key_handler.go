@@ -0,0 +1,252 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+type createAPIKeyRequest struct {
+	Name   string     `json:"name"`
+	Scopes []string   `json:"scopes"`
+	Expiry *time.Time `json:"expiry"`
+}
+
+type updateAPIKeyRequest struct {
+	Name   *string  `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+func validateAPIKeyName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+
+	if len(name) > 100 {
+		return errors.New("name can't be longer than 100 characters")
+	}
+
+	return nil
+}
+
+// normalizeAPIKeyScopes drops duplicates and refuses unknown scopes
+func normalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("scopes is required, pick from %s", strings.Join(store.APIKeyScopes, ", "))
+	}
+
+	known := map[string]bool{}
+	for _, scope := range store.APIKeyScopes {
+		known[scope] = true
+	}
+
+	seen := map[string]bool{}
+	normalized := []string{}
+
+	for _, scope := range scopes {
+		if !known[scope] {
+			return nil, fmt.Errorf("unknown scope %q, pick from %s", scope, strings.Join(store.APIKeyScopes, ", "))
+		}
+
+		if seen[scope] {
+			continue
+		}
+
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+
+	return normalized, nil
+}
+
+// getOwnAPIKey writes the error response itself and returns nil when the key
+// doesn't belong to the current user
+func (ah *APIKeyHandler) getOwnAPIKey(w http.ResponseWriter, r *http.Request) *store.APIKey {
+	keyID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid api key id"})
+		return nil
+	}
+
+	key, err := ah.apiKeyStore.GetAPIKeyByID(keyID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: getAPIKeyByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	// someone else's key is reported as missing, its id is none of your business
+	if key == nil || key.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return nil
+	}
+
+	return key
+}
+
+func (ah *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := ah.apiKeyStore.ListAPIKeys(middleware.GetUser(r).ID)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: listAPIKeys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (ah *APIKeyHandler) HandleGetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := ah.getOwnAPIKey(w, r)
+
+	if key == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_key": key})
+}
+
+// HandleCreateAPIKey is the only time the key itself is in the response
+func (ah *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: decodingCreateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateAPIKeyName(req.Name)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	scopes, err := normalizeAPIKeyScopes(req.Scopes)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if req.Expiry != nil && !req.Expiry.After(time.Now()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expiry must be in the future"})
+		return
+	}
+
+	key := &store.APIKey{
+		UserID: middleware.GetUser(r).ID,
+		Name:   strings.TrimSpace(req.Name),
+		Scopes: scopes,
+		Expiry: req.Expiry,
+	}
+
+	err = ah.apiKeyStore.CreateAPIKey(key)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: createAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create api key"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key})
+}
+
+// HandleUpdateAPIKey renames a key or changes its scopes, the key itself stays the same
+func (ah *APIKeyHandler) HandleUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := ah.getOwnAPIKey(w, r)
+
+	if key == nil {
+		return
+	}
+
+	var req updateAPIKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: decodingUpdateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Name != nil {
+		err = validateAPIKeyName(*req.Name)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		key.Name = strings.TrimSpace(*req.Name)
+	}
+
+	if req.Scopes != nil {
+		key.Scopes, err = normalizeAPIKeyScopes(req.Scopes)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	err = ah.apiKeyStore.UpdateAPIKey(key)
+
+	if err != nil {
+		ah.logger.Printf("ERROR: updateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_key": key})
+}
+
+func (ah *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := ah.getOwnAPIKey(w, r)
+
+	if key == nil {
+		return
+	}
+
+	err := ah.apiKeyStore.DeleteAPIKey(key.ID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return
+	}
+
+	if err != nil {
+		ah.logger.Printf("ERROR: deleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
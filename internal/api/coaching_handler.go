@@ -0,0 +1,275 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// CoachingHandler is both sides of a coaching, athletes invite their coaches
+// under /users/me/coaches and coaches answer under /coach/athletes
+type CoachingHandler struct {
+	coachingStore store.CoachingStore
+	userStore     store.UserStore
+	logger        *log.Logger
+}
+
+type inviteCoachRequest struct {
+	Username string `json:"username"`
+	Access   string `json:"access"`
+}
+
+type updateCoachingRequest struct {
+	Access string `json:"access"`
+}
+
+func NewCoachingHandler(coachingStore store.CoachingStore, userStore store.UserStore, logger *log.Logger) *CoachingHandler {
+	return &CoachingHandler{
+		coachingStore: coachingStore,
+		userStore:     userStore,
+		logger:        logger,
+	}
+}
+
+func validateCoachAccess(access string) error {
+	if !authz.ValidCoachAccess(access) {
+		return fmt.Errorf("access must be one of %s", strings.Join(store.CoachAccesses, ", "))
+	}
+
+	return nil
+}
+
+// HandleInviteCoach lets the current user give a coach access to their
+// workouts, the access starts once the coach accepts
+func (ch *CoachingHandler) HandleInviteCoach(w http.ResponseWriter, r *http.Request) {
+	var req inviteCoachRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: decodingInviteCoach: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateCoachAccess(req.Access)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	coach, err := ch.userStore.GetUserByUsername(strings.TrimSpace(req.Username))
+
+	if err != nil {
+		ch.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if coach == nil || coach.IsDisabled() || !authz.IsCoach(coach.Role) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "coach not found"})
+		return
+	}
+
+	if coach.ID == currentUser.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't coach yourself"})
+		return
+	}
+
+	coaching := &store.Coaching{
+		CoachID:         coach.ID,
+		CoachUsername:   coach.Username,
+		AthleteID:       currentUser.ID,
+		AthleteUsername: currentUser.Username,
+		Access:          req.Access,
+	}
+
+	err = ch.coachingStore.CreateCoaching(coaching)
+
+	if errors.Is(err, store.ErrDuplicateCoaching) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: createCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"coaching": coaching})
+}
+
+func (ch *CoachingHandler) HandleListCoaches(w http.ResponseWriter, r *http.Request) {
+	coachings, err := ch.coachingStore.ListCoaches(middleware.GetUser(r).ID)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: listCoaches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaches": coachings})
+}
+
+// HandleUpdateCoach changes the access of a coach of the current user, the id
+// param is the user id of the coach
+func (ch *CoachingHandler) HandleUpdateCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid coach id"})
+		return
+	}
+
+	var req updateCoachingRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: decodingUpdateCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateCoachAccess(req.Access)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	coaching, err := ch.coachingStore.GetCoaching(int(coachID), middleware.GetUser(r).ID)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: getCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if coaching == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "coach not found"})
+		return
+	}
+
+	coaching.Access = req.Access
+
+	err = ch.coachingStore.UpdateCoachingAccess(coaching)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: updateCoachingAccess: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaching": coaching})
+}
+
+// HandleRemoveCoach takes the access of a coach away, or withdraws the
+// invitation when it wasn't accepted yet
+func (ch *CoachingHandler) HandleRemoveCoach(w http.ResponseWriter, r *http.Request) {
+	coachID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid coach id"})
+		return
+	}
+
+	ch.deleteCoaching(w, int(coachID), middleware.GetUser(r).ID, "coach not found")
+}
+
+func (ch *CoachingHandler) HandleListAthletes(w http.ResponseWriter, r *http.Request) {
+	coachings, err := ch.coachingStore.ListAthletes(middleware.GetUser(r).ID)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: listAthletes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"athletes": coachings})
+}
+
+// HandleAcceptAthlete accepts the invitation of an athlete, the id param is
+// the user id of the athlete
+func (ch *CoachingHandler) HandleAcceptAthlete(w http.ResponseWriter, r *http.Request) {
+	athleteID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return
+	}
+
+	coaching, err := ch.coachingStore.GetCoaching(middleware.GetUser(r).ID, int(athleteID))
+
+	if err != nil {
+		ch.logger.Printf("ERROR: getCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if coaching == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation not found"})
+		return
+	}
+
+	if coaching.Status == store.CoachingAccepted {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaching": coaching})
+		return
+	}
+
+	err = ch.coachingStore.AcceptCoaching(coaching)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: acceptCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"coaching": coaching})
+}
+
+// HandleRemoveAthlete declines an invitation or stops coaching an athlete
+func (ch *CoachingHandler) HandleRemoveAthlete(w http.ResponseWriter, r *http.Request) {
+	athleteID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return
+	}
+
+	ch.deleteCoaching(w, middleware.GetUser(r).ID, int(athleteID), "athlete not found")
+}
+
+func (ch *CoachingHandler) deleteCoaching(w http.ResponseWriter, coachID, athleteID int, notFound string) {
+	err := ch.coachingStore.DeleteCoaching(coachID, athleteID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": notFound})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteCoaching: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
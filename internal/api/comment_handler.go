@@ -0,0 +1,212 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// CommentHandler is for the comments on the entries of a workout, by its owner
+// and their coaches
+type CommentHandler struct {
+	commentStore store.CommentStore
+	workoutStore store.WorkoutStore
+	authorizer   *authz.Authorizer
+	logger       *log.Logger
+}
+
+type createCommentRequest struct {
+	Body string `json:"body"`
+}
+
+const maxCommentLength = 2000
+
+func NewCommentHandler(commentStore store.CommentStore, workoutStore store.WorkoutStore, authorizer *authz.Authorizer, logger *log.Logger) *CommentHandler {
+	return &CommentHandler{
+		commentStore: commentStore,
+		workoutStore: workoutStore,
+		authorizer:   authorizer,
+		logger:       logger,
+	}
+}
+
+// authorizeWorkout reads the workout of the id param and writes the error
+// response itself when the current user may not use the permission on it
+func (ch *CommentHandler) authorizeWorkout(w http.ResponseWriter, r *http.Request, permission authz.Permission) (int64, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workoutID"})
+		return 0, false
+	}
+
+	err = ch.authorizer.AuthorizeWorkout(middleware.GetUser(r), permission, workoutID)
+
+	// workouts the user can't see are reported as missing
+	if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return 0, false
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: authorizeWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+
+	return workoutID, true
+}
+
+// HandleListComments is only for the owner and their coaches, the comments
+// stay private when others can see the workout through its visibility
+func (ch *CommentHandler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := ch.authorizeWorkout(w, r, authz.CommentWorkouts)
+
+	if !ok {
+		return
+	}
+
+	comments, err := ch.commentStore.ListComments(workoutID)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: listComments: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"comments": comments})
+}
+
+func (ch *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := ch.authorizeWorkout(w, r, authz.CommentWorkouts)
+
+	if !ok {
+		return
+	}
+
+	entryID, err := utils.ReadInt64Param(r, "entryID")
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readInt64Param %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid entryID"})
+		return
+	}
+
+	var req createCommentRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: decodingCreateComment: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+
+	if req.Body == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body is required"})
+		return
+	}
+
+	if len(req.Body) > maxCommentLength {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "body can't be longer than 2000 characters"})
+		return
+	}
+
+	entry := int(entryID)
+
+	comment := &store.WorkoutComment{
+		WorkoutID: workoutID,
+		EntryID:   &entry,
+		UserID:    middleware.GetUser(r).ID,
+		Body:      req.Body,
+	}
+
+	err = ch.commentStore.CreateComment(comment)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "entry not found"})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: createComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"comment": comment})
+}
+
+// HandleDeleteComment lets the author of a comment or the owner of the workout
+// delete it
+func (ch *CommentHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := ch.authorizeWorkout(w, r, authz.ReadWorkouts)
+
+	if !ok {
+		return
+	}
+
+	commentID, err := utils.ReadInt64Param(r, "commentID")
+
+	if err != nil {
+		ch.logger.Printf("ERROR: readInt64Param %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid commentID"})
+		return
+	}
+
+	comment, err := ch.commentStore.GetComment(commentID)
+
+	if err != nil {
+		ch.logger.Printf("ERROR: getComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if comment == nil || comment.WorkoutID != workoutID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if comment.UserID != currentUser.ID {
+		ownerID, err := ch.workoutStore.GetWorkoutOwner(workoutID)
+
+		if err != nil {
+			ch.logger.Printf("ERROR: getWorkoutOwner: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if ownerID != currentUser.ID {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to delete this comment"})
+			return
+		}
+	}
+
+	err = ch.commentStore.DeleteComment(commentID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment not found"})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("ERROR: deleteComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
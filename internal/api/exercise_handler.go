@@ -0,0 +1,41 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func (eh *ExerciseHandler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := store.ExerciseFilter{
+		Search:      query.Get("search"),
+		MuscleGroup: query.Get("muscle"),
+		Equipment:   query.Get("equipment"),
+	}
+
+	exercises, err := eh.exerciseStore.ListExercises(filter)
+
+	if err != nil {
+		eh.logger.Printf("ERROR: listExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
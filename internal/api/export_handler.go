@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+type ExportHandler struct {
+	exportStore store.ExportStore
+	logger      *log.Logger
+}
+
+func NewExportHandler(exportStore store.ExportStore, logger *log.Logger) *ExportHandler {
+	return &ExportHandler{
+		exportStore: exportStore,
+		logger:      logger,
+	}
+}
+
+// HandleExport streams every set of every workout of the current user as csv,
+// a json array or newline delimited json (default json)
+func (eh *ExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+
+	if format == "" {
+		format = utils.FormatJSON
+	}
+
+	stream, err := utils.NewStreamWriter(w, format, "workouts", store.ExportColumns)
+
+	if errors.Is(err, utils.ErrUnsupportedStreamFormat) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// the status is already sent from here on, all we can do is stop and log
+	if err != nil {
+		eh.logger.Printf("ERROR: newStreamWriter: %v", err)
+		return
+	}
+
+	err = eh.exportStore.ExportWorkouts(middleware.GetUser(r).ID, func(row *store.ExportRow) error {
+		return stream.WriteRow(row)
+	})
+
+	if err != nil {
+		eh.logger.Printf("ERROR: exportWorkouts: %v", err)
+		return
+	}
+
+	err = stream.Close()
+
+	if err != nil {
+		eh.logger.Printf("ERROR: closeStream: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// FollowHandler is for following other users and the workouts on their
+// profile, a follow is a request until the followee accepts it
+type FollowHandler struct {
+	followStore  store.FollowStore
+	userStore    store.UserStore
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+func NewFollowHandler(followStore store.FollowStore, userStore store.UserStore, workoutStore store.WorkoutStore, logger *log.Logger) *FollowHandler {
+	return &FollowHandler{
+		followStore:  followStore,
+		userStore:    userStore,
+		workoutStore: workoutStore,
+		logger:       logger,
+	}
+}
+
+// getProfileUser writes the error response itself and returns nil when the
+// user of the username param doesn't exist
+func (fh *FollowHandler) getProfileUser(w http.ResponseWriter, r *http.Request) *store.User {
+	user, err := fh.userStore.GetUserByUsername(chi.URLParam(r, "username"))
+
+	if err != nil {
+		fh.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if user == nil || user.IsDisabled() {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return nil
+	}
+
+	return user
+}
+
+func (fh *FollowHandler) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	user := fh.getProfileUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if user.ID == currentUser.ID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you can't follow yourself"})
+		return
+	}
+
+	status, err := fh.followStore.Follow(currentUser.ID, user.ID)
+
+	if err != nil {
+		fh.logger.Printf("ERROR: follow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": status})
+}
+
+func (fh *FollowHandler) HandleUnfollow(w http.ResponseWriter, r *http.Request) {
+	user := fh.getProfileUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	err := fh.followStore.Unfollow(middleware.GetUser(r).ID, user.ID)
+
+	if err != nil {
+		fh.logger.Printf("ERROR: unfollow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleListUserWorkouts lists the public workouts of a user, and the ones for
+// their followers when they accepted the current user as one
+func (fh *FollowHandler) HandleListUserWorkouts(w http.ResponseWriter, r *http.Request) {
+	user := fh.getProfileUser(w, r)
+
+	if user == nil {
+		return
+	}
+
+	filter := store.WorkoutFilter{
+		UserID:       user.ID,
+		Visibilities: []string{store.VisibilityPublic},
+		Sort:         store.WorkoutSortPerformedAt,
+		Descending:   true,
+		Cursor:       r.URL.Query().Get("cursor"),
+		Limit:        defaultListLimit,
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if currentUser != nil && !currentUser.IsAnonymous() {
+		following, err := fh.followStore.IsFollowing(currentUser.ID, user.ID)
+
+		if err != nil {
+			fh.logger.Printf("ERROR: isFollowing: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if following {
+			filter.Visibilities = append(filter.Visibilities, store.VisibilityFollowers)
+		}
+	}
+
+	limit, err := utils.ReadIntQuery(r, "limit")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if limit != nil {
+		if *limit < 1 || *limit > maxListLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	workouts, nextCursor, err := fh.workoutStore.ListWorkouts(filter)
+
+	if errors.Is(err, store.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid cursor"})
+		return
+	}
+
+	if err != nil {
+		fh.logger.Printf("ERROR: listWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts, "next_cursor": nextCursor})
+}
+
+// HandleListFollowers lists the followers and follow requests of the current
+// user
+func (fh *FollowHandler) HandleListFollowers(w http.ResponseWriter, r *http.Request) {
+	followers, err := fh.followStore.ListFollowers(middleware.GetUser(r).ID)
+
+	if err != nil {
+		fh.logger.Printf("ERROR: listFollowers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"followers": followers})
+}
+
+// HandleAcceptFollower accepts a follow request, the id param is the user id
+// of the follower
+func (fh *FollowHandler) HandleAcceptFollower(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		fh.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid follower id"})
+		return
+	}
+
+	err = fh.followStore.AcceptFollower(middleware.GetUser(r).ID, int(followerID))
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follow request not found"})
+		return
+	}
+
+	if err != nil {
+		fh.logger.Printf("ERROR: acceptFollower: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleRemoveFollower declines a follow request or removes a follower
+func (fh *FollowHandler) HandleRemoveFollower(w http.ResponseWriter, r *http.Request) {
+	followerID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		fh.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid follower id"})
+		return
+	}
+
+	err = fh.followStore.RemoveFollower(middleware.GetUser(r).ID, int(followerID))
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "follower not found"})
+		return
+	}
+
+	if err != nil {
+		fh.logger.Printf("ERROR: removeFollower: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
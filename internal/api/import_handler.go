@@ -0,0 +1,293 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/importer"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/tracks"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// a few hours of one second recordings stays well below this
+const maxImportSize = 20 << 20
+
+type ImportHandler struct {
+	workoutStore  store.WorkoutStore
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewImportHandler(workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, logger *log.Logger) *ImportHandler {
+	return &ImportHandler{
+		workoutStore:  workoutStore,
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+// readUpload returns the file that was sent in the file field of a multipart
+// form, it writes the error response itself and returns nil when there is none
+func readUpload(w http.ResponseWriter, r *http.Request, logger *log.Logger) (multipart.File, *multipart.FileHeader) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	err := r.ParseMultipartForm(maxImportSize)
+
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": "file is too large"})
+		return nil, nil
+	}
+
+	if err != nil {
+		logger.Printf("ERROR: parseMultipartForm: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid multipart upload"})
+		return nil, nil
+	}
+
+	file, header, err := r.FormFile("file")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a file is required in the file field"})
+		return nil, nil
+	}
+
+	return file, header
+}
+
+// HandleImportWorkout creates a workout from an uploaded gpx, tcx or fit file.
+// The format is taken from the file extension unless the format field is sent.
+func (ih *ImportHandler) HandleImportWorkout(w http.ResponseWriter, r *http.Request) {
+	file, header := readUpload(w, r, ih.logger)
+
+	if file == nil {
+		return
+	}
+
+	defer file.Close()
+
+	format := r.FormValue("format")
+
+	if format == "" {
+		format = tracks.FormatFromFilename(header.Filename)
+	}
+
+	activity, err := tracks.Parse(format, file)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// a single point or a track without timestamps has nothing to log
+	if activity.DurationSeconds == nil && activity.DistanceMeters == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "the activity has neither a duration nor a distance"})
+		return
+	}
+
+	workout := activity.Workout()
+	workout.UserID = middleware.GetUser(r).ID
+
+	if title := r.FormValue("title"); title != "" {
+		workout.Title = title
+	}
+
+	if timezone := r.FormValue("timezone"); timezone != "" {
+		_, err := time.LoadLocation(timezone)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid timezone"})
+			return
+		}
+
+		workout.Timezone = timezone
+	}
+
+	// the file is checked like a workout that is sent as json
+	err = validateWorkoutTitle(workout.Title)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkoutEntries(workout.Entries)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkoutTimes(workout, false)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = resolveWorkoutExercises(ih.exerciseStore, workout.Entries)
+
+	if err != nil {
+		ih.logger.Printf("ERROR: resolveExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	createdWorkout, err := ih.workoutStore.ImportWorkout(workout, activity.Points)
+
+	if err != nil {
+		ih.logger.Printf("ERROR: importWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to import workout"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+}
+
+type csvImportReport struct {
+	Source     string                    `json:"source"`
+	DryRun     bool                      `json:"dry_run"`
+	Created    int                       `json:"created"`
+	Duplicates int                       `json:"duplicates"`
+	Workouts   []importer.WorkoutSummary `json:"workouts"`
+}
+
+// HandleImportCSV imports the csv export of another app (source=strong, hevy or
+// fitnotes). Workouts that already exist are skipped, with dry_run=true
+// nothing is created and the report shows what would happen.
+func (ih *ImportHandler) HandleImportCSV(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	adapter, err := importer.NewAdapter(source)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	dryRun := false
+
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid dry_run parameter"})
+			return
+		}
+	}
+
+	file, _ := readUpload(w, r, ih.logger)
+
+	if file == nil {
+		return
+	}
+
+	defer file.Close()
+
+	// the apps export local times without a zone
+	timezone := r.FormValue("timezone")
+
+	if timezone == "" {
+		timezone = store.DefaultTimezone
+	}
+
+	loc, err := time.LoadLocation(timezone)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid timezone"})
+		return
+	}
+
+	workouts, err := adapter.Parse(file, loc)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	for _, workout := range workouts {
+		workout.UserID = currentUser.ID
+		workout.Timezone = timezone
+
+		err = validateWorkoutEntries(workout.Entries)
+
+		if err == nil {
+			err = validateWorkoutTimes(workout, false)
+		}
+
+		if err != nil {
+			message := fmt.Sprintf("%s on %s: %v", workout.Title, workout.PerformedAt.Format(time.DateOnly), err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": message})
+			return
+		}
+	}
+
+	err = importer.MapExercises(ih.exerciseStore, workouts)
+
+	if err != nil {
+		ih.logger.Printf("ERROR: mapExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	duplicates, err := ih.workoutStore.FindDuplicateWorkouts(currentUser.ID, workouts)
+
+	if err != nil {
+		ih.logger.Printf("ERROR: findDuplicateWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	report := csvImportReport{Source: source, DryRun: dryRun}
+	newWorkouts := []*store.Workout{}
+	seen := map[string]bool{}
+
+	for i, workout := range workouts {
+		key := importer.DuplicateKey(workout)
+
+		// the same workout can also be in the file twice
+		if duplicates[i] || seen[key] {
+			duplicates[i] = true
+			report.Duplicates++
+			continue
+		}
+
+		seen[key] = true
+		newWorkouts = append(newWorkouts, workout)
+	}
+
+	if !dryRun {
+		_, err = ih.workoutStore.CreateWorkouts(newWorkouts)
+
+		if err != nil {
+			ih.logger.Printf("ERROR: createWorkouts: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to import workouts"})
+			return
+		}
+
+		report.Created = len(newWorkouts)
+	}
+
+	for i, workout := range workouts {
+		summary := importer.Summarize(workout)
+		summary.Duplicate = duplicates[i]
+		report.Workouts = append(report.Workouts, summary)
+	}
+
+	status := http.StatusOK
+
+	if report.Created > 0 {
+		status = http.StatusCreated
+	}
+
+	utils.WriteJSON(w, status, utils.Envelope{"import": report})
+}
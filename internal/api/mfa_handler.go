@@ -0,0 +1,286 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/edwinboon/workout-tracking-api/internal/totp"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// the name authenticator apps show next to the codes
+const totpIssuer = "Workout Tracker"
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	mfaStore store.MFAStore
+	logger   *log.Logger
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type disableMFARequest struct {
+	Password string `json:"password"`
+}
+
+func NewMFAHandler(mfaStore store.MFAStore, logger *log.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaStore: mfaStore,
+		logger:   logger,
+	}
+}
+
+// verifyMFACode checks a code of the authenticator app or, when code is empty,
+// a recovery code. Both can only be used once.
+func verifyMFACode(mfaStore store.MFAStore, userTOTP *store.TOTP, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		if recoveryCode == "" {
+			return false, nil
+		}
+
+		return mfaStore.UseRecoveryCode(userTOTP.UserID, recoveryCode)
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, code, time.Now())
+
+	if !ok {
+		return false, nil
+	}
+
+	return mfaStore.UseTOTPStep(userTOTP.UserID, step)
+}
+
+func (mh *MFAHandler) HandleGetMFA(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUser(r).ID
+
+	userTOTP, err := mh.mfaStore.GetTOTP(userID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	remaining, err := mh.mfaStore.CountRecoveryCodes(userID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: countRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"mfa": utils.Envelope{
+		"totp_enabled":        userTOTP.Enabled(),
+		"recovery_codes_left": remaining,
+	}})
+}
+
+// HandleEnrollTOTP starts setting up an authenticator app, 2FA isn't on until
+// a code of the app is confirmed. Enrolling again replaces the secret.
+func (mh *MFAHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	userTOTP, err := mh.mfaStore.GetTOTP(user.ID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if userTOTP.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		mh.logger.Printf("ERROR: generateSecret: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = mh.mfaStore.SaveTOTP(user.ID, secret)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: saveTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+// HandleConfirmTOTP turns 2FA on with a code of the app that was just set up.
+// The recovery codes are only in this response.
+func (mh *MFAHandler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: decodingConfirmTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+
+	userTOTP, err := mh.mfaStore.GetTOTP(userID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if userTOTP == nil || userTOTP.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "there is no two-factor enrollment to confirm"})
+		return
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, req.Code, time.Now())
+
+	if !ok {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	recoveryCodes, err := tokens.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: generateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = mh.mfaStore.ConfirmTOTP(userID, step, recoveryCodes)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "there is no two-factor enrollment to confirm"})
+		return
+	}
+
+	if err != nil {
+		mh.logger.Printf("ERROR: confirmTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"message":        "two-factor authentication is enabled, keep the recovery codes somewhere safe",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// HandleDisableTOTP turns 2FA off, it takes the password so a stolen session
+// can't do it
+func (mh *MFAHandler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req disableMFARequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: decodingDisableTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	user := middleware.GetUser(r)
+
+	passwordMatches, err := user.PasswordHash.Matches(req.Password)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: PasswordMatches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !passwordMatches {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "password is incorrect"})
+		return
+	}
+
+	err = mh.mfaStore.DeleteTOTP(user.ID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: deleteTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleRegenerateRecoveryCodes replaces the recovery codes, it takes a code
+// of the app
+func (mh *MFAHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req mfaCodeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: decodingRegenerateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	userID := middleware.GetUser(r).ID
+
+	userTOTP, err := mh.mfaStore.GetTOTP(userID)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !userTOTP.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := verifyMFACode(mh.mfaStore, userTOTP, req.Code, "")
+
+	if err != nil {
+		mh.logger.Printf("ERROR: verifyMFACode: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !valid {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	recoveryCodes, err := tokens.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: generateRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = mh.mfaStore.ReplaceRecoveryCodes(userID, recoveryCodes)
+
+	if err != nil {
+		mh.logger.Printf("ERROR: replaceRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": recoveryCodes})
+}
@@ -0,0 +1,646 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/analytics"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// OrganizationHandler is for organizations like a gym or a squad, every member
+// can see them and their admins manage the members
+type OrganizationHandler struct {
+	organizationStore store.OrganizationStore
+	userStore         store.UserStore
+	workoutStore      store.WorkoutStore
+	statsStore        analytics.StatsStore
+	logger            *log.Logger
+}
+
+type organizationRequest struct {
+	Name string `json:"name"`
+}
+
+type addMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type updateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// the default range of the attendance, the last 4 weeks
+const defaultAttendanceDays = 28
+
+func NewOrganizationHandler(organizationStore store.OrganizationStore, userStore store.UserStore, workoutStore store.WorkoutStore, statsStore analytics.StatsStore, logger *log.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationStore: organizationStore,
+		userStore:         userStore,
+		workoutStore:      workoutStore,
+		statsStore:        statsStore,
+		logger:            logger,
+	}
+}
+
+func validateOrganizationName(name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(name) > 100 {
+		return errors.New("name can't be longer than 100 characters")
+	}
+
+	return nil
+}
+
+func validateOrgRole(role string) error {
+	for _, r := range store.OrgRoles {
+		if role == r {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("role must be one of %s", strings.Join(store.OrgRoles, ", "))
+}
+
+// lookupOrganization writes the error response itself and returns nil when
+// the organization of the id param doesn't exist or the current user isn't a
+// member or invited, outsiders don't get to know it exists
+func (oh *OrganizationHandler) lookupOrganization(w http.ResponseWriter, r *http.Request) *store.Organization {
+	orgID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid organization id"})
+		return nil
+	}
+
+	org, err := oh.organizationStore.GetOrganization(orgID, middleware.GetUser(r).ID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: getOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if org == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "organization not found"})
+		return nil
+	}
+
+	return org
+}
+
+// getOrganization is lookupOrganization for the members, an invitation that
+// wasn't accepted doesn't show anything of the organization yet
+func (oh *OrganizationHandler) getOrganization(w http.ResponseWriter, r *http.Request) *store.Organization {
+	org := oh.lookupOrganization(w, r)
+
+	if org != nil && org.Status != store.OrgMemberAccepted {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "organization not found"})
+		return nil
+	}
+
+	return org
+}
+
+// getAdminOrganization is getOrganization for the routes of the org admins
+func (oh *OrganizationHandler) getAdminOrganization(w http.ResponseWriter, r *http.Request) *store.Organization {
+	org := oh.getOrganization(w, r)
+
+	if org != nil && org.Role != store.OrgRoleAdmin {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must be an admin of this organization"})
+		return nil
+	}
+
+	return org
+}
+
+// getMember writes the error response itself and returns nil when userID
+// isn't a member of the organization
+func (oh *OrganizationHandler) getMember(w http.ResponseWriter, orgID int64, userID int) *store.OrganizationMember {
+	members, err := oh.organizationStore.ListMembers(orgID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: listMembers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	for _, member := range members {
+		if member.UserID == userID {
+			return member
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member not found"})
+	return nil
+}
+
+// isLastAdmin tells whether the member is the only admin left, an
+// organization always keeps one
+func (oh *OrganizationHandler) isLastAdmin(orgID int64, member *store.OrganizationMember) (bool, error) {
+	if member.Role != store.OrgRoleAdmin || member.Status != store.OrgMemberAccepted {
+		return false, nil
+	}
+
+	admins, err := oh.organizationStore.CountAdmins(orgID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return admins <= 1, nil
+}
+
+func (oh *OrganizationHandler) HandleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req organizationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: decodingCreateOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	org := &store.Organization{Name: strings.TrimSpace(req.Name)}
+
+	err = validateOrganizationName(org.Name)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = oh.organizationStore.CreateOrganization(org, middleware.GetUser(r).ID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: createOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"organization": org})
+}
+
+func (oh *OrganizationHandler) HandleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := oh.organizationStore.ListOrganizations(middleware.GetUser(r).ID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: listOrganizations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organizations": orgs})
+}
+
+func (oh *OrganizationHandler) HandleGetOrganization(w http.ResponseWriter, r *http.Request) {
+	org := oh.getOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organization": org})
+}
+
+func (oh *OrganizationHandler) HandleUpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	org := oh.getAdminOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	var req organizationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: decodingUpdateOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	org.Name = strings.TrimSpace(req.Name)
+
+	err = validateOrganizationName(org.Name)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = oh.organizationStore.UpdateOrganization(org)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: updateOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organization": org})
+}
+
+func (oh *OrganizationHandler) HandleDeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	org := oh.getAdminOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	err := oh.organizationStore.DeleteOrganization(org.ID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: deleteOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (oh *OrganizationHandler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	org := oh.getOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	members, err := oh.organizationStore.ListMembers(org.ID)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: listMembers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"members": members})
+}
+
+// HandleAddMember invites a user to the organization by their username, they
+// only become a member once they accept
+func (oh *OrganizationHandler) HandleAddMember(w http.ResponseWriter, r *http.Request) {
+	org := oh.getAdminOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	var req addMemberRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: decodingAddMember: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = store.OrgRoleMember
+	}
+
+	err = validateOrgRole(req.Role)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user, err := oh.userStore.GetUserByUsername(strings.TrimSpace(req.Username))
+
+	if err != nil {
+		oh.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil || user.IsDisabled() {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	member := &store.OrganizationMember{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     req.Role,
+	}
+
+	err = oh.organizationStore.AddMember(org.ID, member)
+
+	if errors.Is(err, store.ErrDuplicateMember) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: addMember: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"member": member})
+}
+
+// HandleAcceptInvitation lets the current user join an organization they were
+// invited to
+func (oh *OrganizationHandler) HandleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	org := oh.lookupOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	if org.Status == store.OrgMemberAccepted {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organization": org})
+		return
+	}
+
+	err := oh.organizationStore.AcceptMembership(org.ID, middleware.GetUser(r).ID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "invitation not found"})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: acceptMembership: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	org.Status = store.OrgMemberAccepted
+	org.Members++
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"organization": org})
+}
+
+func (oh *OrganizationHandler) HandleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	org := oh.getAdminOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	userID, err := utils.ReadInt64Param(r, "userID")
+
+	if err != nil {
+		oh.logger.Printf("ERROR: readInt64Param %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid userID"})
+		return
+	}
+
+	var req updateMemberRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: decodingUpdateMember: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateOrgRole(req.Role)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	member := oh.getMember(w, org.ID, int(userID))
+
+	if member == nil {
+		return
+	}
+
+	if req.Role != store.OrgRoleAdmin {
+		lastAdmin, err := oh.isLastAdmin(org.ID, member)
+
+		if err != nil {
+			oh.logger.Printf("ERROR: countAdmins: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if lastAdmin {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "an organization needs at least one admin"})
+			return
+		}
+	}
+
+	err = oh.organizationStore.UpdateMemberRole(org.ID, member.UserID, req.Role)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member not found"})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: updateMemberRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	member.Role = req.Role
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"member": member})
+}
+
+// HandleRemoveMember removes a member, admins remove anyone and members can
+// remove themselves to leave or to decline an invitation
+func (oh *OrganizationHandler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	org := oh.lookupOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	userID, err := utils.ReadInt64Param(r, "userID")
+
+	if err != nil {
+		oh.logger.Printf("ERROR: readInt64Param %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid userID"})
+		return
+	}
+
+	isAdmin := org.Role == store.OrgRoleAdmin && org.Status == store.OrgMemberAccepted
+
+	if !isAdmin && int(userID) != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must be an admin of this organization"})
+		return
+	}
+
+	member := oh.getMember(w, org.ID, int(userID))
+
+	if member == nil {
+		return
+	}
+
+	lastAdmin, err := oh.isLastAdmin(org.ID, member)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: countAdmins: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if lastAdmin {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "an organization needs at least one admin, delete it instead"})
+		return
+	}
+
+	err = oh.organizationStore.RemoveMember(org.ID, member.UserID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member not found"})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: removeMember: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleGetLeaderboard ranks the members by their volume in the week of the
+// week parameter, the current week by default
+func (oh *OrganizationHandler) HandleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	org := oh.getOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	week, err := utils.ReadTimeQuery(r, "week")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	from := analytics.WeekStart(time.Now())
+	if week != nil {
+		from = analytics.WeekStart(*week)
+	}
+
+	leaderboard, err := oh.statsStore.Leaderboard(org.ID, from, from.AddDate(0, 0, 7))
+
+	if err != nil {
+		oh.logger.Printf("ERROR: leaderboard: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"week_start": from, "leaderboard": leaderboard})
+}
+
+// HandleGetAttendance counts the workouts and training days of the members,
+// over the last 4 weeks by default
+func (oh *OrganizationHandler) HandleGetAttendance(w http.ResponseWriter, r *http.Request) {
+	org := oh.getOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	from, err := utils.ReadTimeQuery(r, "from")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	to, err := utils.ReadEndTimeQuery(r, "to")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+
+	start := end.AddDate(0, 0, -defaultAttendanceDays)
+	if from != nil {
+		start = *from
+	}
+
+	if !start.Before(end) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be before to"})
+		return
+	}
+
+	attendance, err := oh.statsStore.Attendance(org.ID, start, end)
+
+	if err != nil {
+		oh.logger.Printf("ERROR: attendance: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"from": start, "to": end, "attendance": attendance})
+}
+
+// HandleGetFeed lists the workouts the members share with the organization,
+// most recent first
+func (oh *OrganizationHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	org := oh.getOrganization(w, r)
+
+	if org == nil {
+		return
+	}
+
+	filter := store.WorkoutFilter{
+		OrganizationID: int(org.ID),
+		Sort:           store.WorkoutSortPerformedAt,
+		Descending:     true,
+		Cursor:         r.URL.Query().Get("cursor"),
+		Limit:          defaultListLimit,
+	}
+
+	limit, err := utils.ReadIntQuery(r, "limit")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if limit != nil {
+		if *limit < 1 || *limit > maxListLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	workouts, nextCursor, err := oh.workoutStore.ListWorkouts(filter)
+
+	if errors.Is(err, store.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid cursor"})
+		return
+	}
+
+	if err != nil {
+		oh.logger.Printf("ERROR: listWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts, "next_cursor": nextCursor})
+}
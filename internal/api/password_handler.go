@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/mailer"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/throttle"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+type PasswordHandler struct {
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	issuer     *TokenIssuer
+	throttler  *throttle.Throttler
+	logger     *log.Logger
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewPasswordHandler(userStore store.UserStore, tokenStore store.TokenStore, mailer mailer.Mailer, issuer *TokenIssuer, throttler *throttle.Throttler, logger *log.Logger) *PasswordHandler {
+	return &PasswordHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     mailer,
+		issuer:     issuer,
+		throttler:  throttler,
+		logger:     logger,
+	}
+}
+
+// HandleChangePassword sets a new password for the current user. Every auth
+// token of the user is revoked, the response holds a fresh one for the client
+// that made the change.
+func (ph *PasswordHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingChangePassword: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	user := *middleware.GetUser(r)
+
+	passwordMatches, err := user.PasswordHash.Matches(req.CurrentPassword)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: PasswordMatches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !passwordMatches {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "current password is incorrect"})
+		return
+	}
+
+	err = validatePassword(req.NewPassword)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = ph.setPassword(&user, req.NewPassword)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	pair, err := ph.issuer.Issue(r, &user)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: create new token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password changed, all other sessions are signed out", "auth_token": pair.Access, "refresh_token": pair.Refresh})
+}
+
+// HandleRequestPasswordReset mails a reset token to the owner of the email.
+// The response is the same whether the email is known or not so the endpoint
+// can't be used to find out who has an account, the lookup and the mail
+// happen after it so its timing doesn't tell either. Requests are throttled
+// per email and per ip.
+func (ph *PasswordHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingPasswordReset: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateEmail(req.Email)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	limits := []throttle.Limit{throttle.PasswordReset(req.Email), throttle.PasswordResetIP(ip)}
+
+	if writeThrottled(w, ph.throttler, ph.logger, "too many password reset requests, try again later", limits...) {
+		return
+	}
+
+	err = ph.throttler.Fail(ip, limits...)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: fail: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	go ph.requestPasswordReset(req.Email)
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": "if the email belongs to an account, a password reset token is on its way"})
+}
+
+// requestPasswordReset mails a reset token when the email belongs to an
+// account, it runs after the response so it logs its errors itself
+func (ph *PasswordHandler) requestPasswordReset(email string) {
+	user, err := ph.userStore.GetUserByEmail(email)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getUserByEmail: %v", err)
+		return
+	}
+
+	if user != nil {
+		// sendPasswordReset logs its own errors
+		_ = ph.sendPasswordReset(user)
+	}
+}
+
+// HandleResetPassword consumes a reset token and sets the new password. The
+// user is signed out everywhere, so they log in again with the new password.
+func (ph *PasswordHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingResetPassword: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	err = validatePassword(req.Password)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user, err := ph.userStore.GetUserToken(tokens.ScopePasswordReset, req.Token)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired password reset token"})
+		return
+	}
+
+	err = ph.setPassword(user, req.Password)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "password has been reset, log in with your new password"})
+}
+
+// setPassword stores the new password and revokes the auth and reset tokens
+// of the user, it logs the error itself
+func (ph *PasswordHandler) setPassword(user *store.User, plaintext string) error {
+	err := user.PasswordHash.SetPassword(plaintext)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: hashingPassword: %v", err)
+		return err
+	}
+
+	err = ph.userStore.UpdatePassword(user)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: updatePassword: %v", err)
+		return err
+	}
+
+	err = ph.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		return err
+	}
+
+	err = ph.issuer.RevokeAll(user.ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: revokeAll: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// sendPasswordReset replaces any earlier reset token of the user, only the
+// newest mail works
+func (ph *PasswordHandler) sendPasswordReset(user *store.User) error {
+	err := ph.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopePasswordReset)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		return err
+	}
+
+	token, err := ph.tokenStore.CreateNewToken(user.ID, passwordResetTTL, tokens.ScopePasswordReset)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: create new token: %v", err)
+		return err
+	}
+
+	err = ph.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse this token to choose a new password:\n\n%s\n\nIt expires at %s. If you didn't ask for a reset you can ignore this mail.\n",
+			user.Username, token.Plaintext, token.Expiry.UTC().Format(time.RFC1123),
+		),
+	})
+
+	if err != nil {
+		ph.logger.Printf("ERROR: sendPasswordReset: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type PersonalRecordHandler struct {
+	recordStore   store.PersonalRecordStore
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewPersonalRecordHandler(recordStore store.PersonalRecordStore, exerciseStore store.ExerciseStore, logger *log.Logger) *PersonalRecordHandler {
+	return &PersonalRecordHandler{
+		recordStore:   recordStore,
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func (ph *PersonalRecordHandler) HandleGetRecords(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	records, err := ph.recordStore.GetCurrentRecords(currentUser.ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getCurrentRecords: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"records": records})
+}
+
+func (ph *PersonalRecordHandler) HandleGetRecordHistory(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	exercise := chi.URLParam(r, "exercise")
+
+	if exercise == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "missing exercise parameter"})
+		return
+	}
+
+	// aliases are looked up in the catalog, records of catalog exercises are kept by id
+	if _, err := strconv.Atoi(exercise); err != nil {
+		catalogExercise, err := ph.exerciseStore.FindExerciseByName(exercise)
+
+		if err != nil {
+			ph.logger.Printf("ERROR: findExerciseByName: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if catalogExercise != nil {
+			exercise = strconv.Itoa(catalogExercise.ID)
+		}
+	}
+
+	records, err := ph.recordStore.GetRecordHistory(currentUser.ID, exercise)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getRecordHistory: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"records": records})
+}
@@ -0,0 +1,402 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+const (
+	defaultScheduleDays = 14
+	maxScheduleDays     = 90
+)
+
+type ProgramHandler struct {
+	programStore  store.ProgramStore
+	templateStore store.TemplateStore
+	recordStore   store.PersonalRecordStore
+	logger        *log.Logger
+}
+
+type enrollRequest struct {
+	StartDate string `json:"start_date"`
+}
+
+func NewProgramHandler(programStore store.ProgramStore, templateStore store.TemplateStore, recordStore store.PersonalRecordStore, logger *log.Logger) *ProgramHandler {
+	return &ProgramHandler{
+		programStore:  programStore,
+		templateStore: templateStore,
+		recordStore:   recordStore,
+		logger:        logger,
+	}
+}
+
+func validateProgram(program *store.Program) error {
+	if program.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if program.Weeks < 1 || program.Weeks > 52 {
+		return errors.New("weeks must be between 1 and 52")
+	}
+
+	if len(program.Sessions) == 0 {
+		return errors.New("a program needs at least one session")
+	}
+
+	seen := map[[2]int]bool{}
+
+	for i := range program.Sessions {
+		session := &program.Sessions[i]
+
+		if session.Week < 1 || session.Week > program.Weeks {
+			return fmt.Errorf("week must be between 1 and %d", program.Weeks)
+		}
+
+		if session.Day < 1 || session.Day > 7 {
+			return errors.New("day must be between 1 and 7")
+		}
+
+		if seen[[2]int{session.Week, session.Day}] {
+			return fmt.Errorf("week %d day %d is scheduled twice", session.Week, session.Day)
+		}
+
+		seen[[2]int{session.Week, session.Day}] = true
+
+		progression := &session.Progression
+
+		switch progression.Type {
+		case "":
+			progression.Type = store.ProgressionNone
+		case store.ProgressionNone:
+		case store.ProgressionPercentTrainingMax:
+			if progression.Percent == nil || *progression.Percent <= 0 || *progression.Percent > 1.5 {
+				return errors.New("percent_training_max needs a percent between 0 and 1.5")
+			}
+
+			if progression.TrainingMaxPercent != nil && (*progression.TrainingMaxPercent <= 0 || *progression.TrainingMaxPercent > 1) {
+				return errors.New("training_max_percent must be between 0 and 1")
+			}
+		case store.ProgressionLinear:
+			if progression.Increment == nil || *progression.Increment <= 0 {
+				return errors.New("linear progression needs a positive increment")
+			}
+		default:
+			return fmt.Errorf("invalid progression type %q", progression.Type)
+		}
+	}
+
+	return nil
+}
+
+func (ph *ProgramHandler) HandleListPrograms(w http.ResponseWriter, r *http.Request) {
+	programs, err := ph.programStore.ListPrograms()
+
+	if err != nil {
+		ph.logger.Printf("ERROR: listPrograms: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"programs": programs})
+}
+
+func (ph *ProgramHandler) HandleGetProgramByID(w http.ResponseWriter, r *http.Request) {
+	programID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid programID"})
+		return
+	}
+
+	program, err := ph.programStore.GetProgramByID(programID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getProgramByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if program == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"program": program})
+}
+
+func (ph *ProgramHandler) HandleCreateProgram(w http.ResponseWriter, r *http.Request) {
+	var program store.Program
+
+	err := json.NewDecoder(r.Body).Decode(&program)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: decodingCreateProgram: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateProgram(&program)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	// a program can only be built from your own templates
+	for _, session := range program.Sessions {
+		template, err := ph.templateStore.GetTemplateByID(int64(session.TemplateID))
+
+		if err != nil {
+			ph.logger.Printf("ERROR: getTemplateByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if template == nil || template.UserID != currentUser.ID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("unknown template_id %d", session.TemplateID)})
+			return
+		}
+	}
+
+	program.UserID = currentUser.ID
+
+	createdProgram, err := ph.programStore.CreateProgram(&program)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: createProgram: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create program"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"program": createdProgram})
+}
+
+func (ph *ProgramHandler) HandleDeleteProgramByID(w http.ResponseWriter, r *http.Request) {
+	programID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid programID"})
+		return
+	}
+
+	program, err := ph.programStore.GetProgramByID(programID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getProgramByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if program == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return
+	}
+
+	if program.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to delete this program"})
+		return
+	}
+
+	err = ph.programStore.DeleteProgram(programID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: deleteProgram %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (ph *ProgramHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	programID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid programID"})
+		return
+	}
+
+	var req enrollRequest
+
+	// without a start date the program starts today
+	err = json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		ph.logger.Printf("ERROR: decodingEnroll: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	startDate := today()
+
+	if req.StartDate != "" {
+		startDate, err = time.Parse(time.DateOnly, req.StartDate)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "start_date must be formatted as 2006-01-02"})
+			return
+		}
+	}
+
+	program, err := ph.programStore.GetProgramByID(programID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getProgramByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if program == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "program not found"})
+		return
+	}
+
+	enrollment, err := ph.programStore.Enroll(middleware.GetUser(r).ID, programID, startDate)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: enroll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"enrollment": enrollment})
+}
+
+func (ph *ProgramHandler) HandleUnenroll(w http.ResponseWriter, r *http.Request) {
+	programID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid programID"})
+		return
+	}
+
+	err = ph.programStore.Unenroll(middleware.GetUser(r).ID, programID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you are not enrolled in this program"})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("ERROR: unenroll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleGetSchedule returns the upcoming sessions of every program the user is enrolled in
+func (ph *ProgramHandler) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	days, err := utils.ReadIntQuery(r, "days")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	scheduleDays := defaultScheduleDays
+
+	if days != nil {
+		if *days < 1 || *days > maxScheduleDays {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("days must be between 1 and %d", maxScheduleDays)})
+			return
+		}
+		scheduleDays = *days
+	}
+
+	from := today()
+	to := from.AddDate(0, 0, scheduleDays)
+
+	enrollments, err := ph.programStore.GetEnrollments(currentUser.ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getEnrollments: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	records, err := ph.recordStore.GetCurrentRecords(currentUser.ID)
+
+	if err != nil {
+		ph.logger.Printf("ERROR: getCurrentRecords: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	bests := store.CurrentBests(records)
+	templates := map[int]*store.Template{}
+	schedule := []store.ScheduledSession{}
+
+	for _, enrollment := range enrollments {
+		program, err := ph.programStore.GetProgramByID(int64(enrollment.ProgramID))
+
+		if err != nil {
+			ph.logger.Printf("ERROR: getProgramByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if program == nil {
+			continue
+		}
+
+		for _, session := range program.Sessions {
+			if _, ok := templates[session.TemplateID]; ok {
+				continue
+			}
+
+			template, err := ph.templateStore.GetTemplateByID(int64(session.TemplateID))
+
+			if err != nil {
+				ph.logger.Printf("ERROR: getTemplateByID: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+				return
+			}
+
+			if template != nil {
+				templates[template.ID] = template
+			}
+		}
+
+		startRecords, err := ph.recordStore.GetRecordsBefore(currentUser.ID, enrollment.StartDate)
+
+		if err != nil {
+			ph.logger.Printf("ERROR: getRecordsBefore: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		schedule = append(schedule, program.Schedule(enrollment, templates, bests, store.CurrentBests(startRecords), from, to)...)
+	}
+
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].Date.Before(schedule[j].Date)
+	})
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"schedule": schedule})
+}
+
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// ShareHandler is for the share links of workouts, the owner creates and
+// revokes them and anyone with a link can view the workout
+type ShareHandler struct {
+	shareStore   store.ShareStore
+	workoutStore store.WorkoutStore
+	userStore    store.UserStore
+	authorizer   *authz.Authorizer
+	logger       *log.Logger
+}
+
+func NewShareHandler(shareStore store.ShareStore, workoutStore store.WorkoutStore, userStore store.UserStore, authorizer *authz.Authorizer, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		shareStore:   shareStore,
+		workoutStore: workoutStore,
+		userStore:    userStore,
+		authorizer:   authorizer,
+		logger:       logger,
+	}
+}
+
+// getOwnWorkout reads the workout of the id param and writes the error
+// response itself when it isn't a workout of the current user, it returns the
+// visibility of the workout
+func (sh *ShareHandler) getOwnWorkout(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workoutID"})
+		return 0, "", false
+	}
+
+	ownerID, visibility, err := sh.workoutStore.GetWorkoutVisibility(workoutID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return 0, "", false
+	}
+
+	if err != nil {
+		sh.logger.Printf("ERROR: getWorkoutVisibility: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, "", false
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	if ownerID == currentUser.ID {
+		return workoutID, visibility, true
+	}
+
+	// only the people that can see the workout learn that it exists
+	err = sh.authorizer.AuthorizeWorkout(currentUser, authz.ReadWorkouts, workoutID)
+
+	if err == nil {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can share this workout"})
+		return 0, "", false
+	}
+
+	if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return 0, "", false
+	}
+
+	sh.logger.Printf("ERROR: authorizeWorkout: %v", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	return 0, "", false
+}
+
+// HandleCreateShare creates a share link, the token is only returned now.
+// Private workouts can't be shared, their links stop working when a workout
+// is made private.
+func (sh *ShareHandler) HandleCreateShare(w http.ResponseWriter, r *http.Request) {
+	workoutID, visibility, ok := sh.getOwnWorkout(w, r)
+
+	if !ok {
+		return
+	}
+
+	if visibility == store.VisibilityPrivate {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "a private workout can't be shared, change its visibility to unlisted first"})
+		return
+	}
+
+	share := &store.WorkoutShare{WorkoutID: workoutID}
+
+	err := sh.shareStore.CreateShare(share)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: createShare: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"share": share, "path": "/shared/" + share.Token})
+}
+
+func (sh *ShareHandler) HandleListShares(w http.ResponseWriter, r *http.Request) {
+	workoutID, _, ok := sh.getOwnWorkout(w, r)
+
+	if !ok {
+		return
+	}
+
+	shares, err := sh.shareStore.ListShares(workoutID)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: listShares: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"shares": shares})
+}
+
+// HandleDeleteShare revokes a share link
+func (sh *ShareHandler) HandleDeleteShare(w http.ResponseWriter, r *http.Request) {
+	workoutID, _, ok := sh.getOwnWorkout(w, r)
+
+	if !ok {
+		return
+	}
+
+	shareID, err := utils.ReadInt64Param(r, "shareID")
+
+	if err != nil {
+		sh.logger.Printf("ERROR: readInt64Param %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid shareID"})
+		return
+	}
+
+	err = sh.shareStore.DeleteShare(workoutID, shareID)
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share not found"})
+		return
+	}
+
+	if err != nil {
+		sh.logger.Printf("ERROR: deleteShare: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleGetSharedWorkout is the read-only view of a share link, it doesn't
+// need a login
+func (sh *ShareHandler) HandleGetSharedWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := sh.shareStore.GetSharedWorkoutID(chi.URLParam(r, "token"))
+
+	if err != nil {
+		sh.logger.Printf("ERROR: getSharedWorkoutID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if workoutID == 0 {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share link not found"})
+		return
+	}
+
+	workout, err := sh.workoutStore.GetWorkoutByID(workoutID)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: getWorkoutByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share link not found"})
+		return
+	}
+
+	owner, err := sh.userStore.GetUserByID(workout.UserID)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: getUserByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if owner == nil || owner.IsDisabled() {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "share link not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout, "owner": owner.Profile()})
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/analytics"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+type StatsHandler struct {
+	statsStore analytics.StatsStore
+	logger     *log.Logger
+}
+
+func NewStatsHandler(statsStore analytics.StatsStore, logger *log.Logger) *StatsHandler {
+	return &StatsHandler{
+		statsStore: statsStore,
+		logger:     logger,
+	}
+}
+
+func (sh *StatsHandler) HandleGetStats(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	query := analytics.StatsQuery{
+		UserID:      currentUser.ID,
+		Granularity: r.URL.Query().Get("granularity"),
+	}
+
+	if query.Granularity == "" {
+		query.Granularity = analytics.GranularityWeek
+	}
+
+	if query.Granularity != analytics.GranularityWeek && query.Granularity != analytics.GranularityMonth {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": analytics.ErrInvalidGranularity.Error()})
+		return
+	}
+
+	from, err := utils.ReadTimeQuery(r, "from")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	to, err := utils.ReadEndTimeQuery(r, "to")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// default to the last 12 weeks or months
+	query.To = time.Now()
+	if to != nil {
+		query.To = *to
+	}
+
+	query.From = query.To.AddDate(0, 0, -7*12)
+	if query.Granularity == analytics.GranularityMonth {
+		query.From = query.To.AddDate(0, -12, 0)
+	}
+
+	if from != nil {
+		query.From = *from
+	}
+
+	if !query.From.Before(query.To) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be before to"})
+		return
+	}
+
+	stats, err := sh.statsStore.GetStats(query)
+
+	if err != nil {
+		sh.logger.Printf("ERROR: getStats: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"stats": stats})
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+type TemplateHandler struct {
+	templateStore store.TemplateStore
+	workoutStore  store.WorkoutStore
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+type instantiateTemplateRequest struct {
+	CarryForwardWeights bool `json:"carry_forward_weights"`
+}
+
+func NewTemplateHandler(templateStore store.TemplateStore, workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, logger *log.Logger) *TemplateHandler {
+	return &TemplateHandler{
+		templateStore: templateStore,
+		workoutStore:  workoutStore,
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+func validateTemplate(template *store.Template) error {
+	if template.Name == "" {
+		return errors.New("name is required")
+	}
+
+	for _, entry := range template.Entries {
+		if entry.ExerciseName == "" && entry.ExerciseID == nil {
+			return errors.New("exercise_name or exercise_id is required")
+		}
+
+		if entry.Sets < 1 {
+			return fmt.Errorf("sets must be at least 1 for %s", entry.ExerciseName)
+		}
+
+		if entry.TargetRepsMin == nil && entry.TargetRepsMax == nil && entry.DurationSeconds == nil {
+			return fmt.Errorf("%s needs target reps or duration_seconds", entry.ExerciseName)
+		}
+
+		if entry.TargetRepsMin != nil && entry.TargetRepsMax != nil && *entry.TargetRepsMin > *entry.TargetRepsMax {
+			return fmt.Errorf("target_reps_min can't be larger than target_reps_max for %s", entry.ExerciseName)
+		}
+
+		if entry.TargetWeightMin != nil && entry.TargetWeightMax != nil && *entry.TargetWeightMin > *entry.TargetWeightMax {
+			return fmt.Errorf("target_weight_min can't be larger than target_weight_max for %s", entry.ExerciseName)
+		}
+	}
+
+	return nil
+}
+
+func (th *TemplateHandler) resolveExercises(entries []store.TemplateEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+
+		exercise, err := resolveExercise(th.exerciseStore, entry.ExerciseID, entry.ExerciseName)
+
+		if err != nil {
+			return err
+		}
+
+		if exercise == nil {
+			continue
+		}
+
+		entry.ExerciseID = &exercise.ID
+		entry.ExerciseName = exercise.Name
+	}
+
+	return nil
+}
+
+// getOwnTemplate writes the error response itself and returns nil when the
+// template can't be used by the current user
+func (th *TemplateHandler) getOwnTemplate(w http.ResponseWriter, r *http.Request) *store.Template {
+	templateID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		th.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid templateID"})
+		return nil
+	}
+
+	template, err := th.templateStore.GetTemplateByID(templateID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: getTemplateByID: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil
+	}
+
+	if template == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return nil
+	}
+
+	if template.UserID != middleware.GetUser(r).ID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to use this template"})
+		return nil
+	}
+
+	return template
+}
+
+func (th *TemplateHandler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	templates, err := th.templateStore.ListTemplates(currentUser.ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: listTemplates: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"templates": templates})
+}
+
+func (th *TemplateHandler) HandleGetTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template := th.getOwnTemplate(w, r)
+
+	if template == nil {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (th *TemplateHandler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var template store.Template
+
+	err := json.NewDecoder(r.Body).Decode(&template)
+
+	if err != nil {
+		th.logger.Printf("ERROR: decodingCreateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	err = validateTemplate(&template)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.resolveExercises(template.Entries)
+
+	if errors.Is(err, errUnknownExercise) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: resolveExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	template.UserID = middleware.GetUser(r).ID
+
+	createdTemplate, err := th.templateStore.CreateTemplate(&template)
+
+	if err != nil {
+		th.logger.Printf("ERROR: createTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create template"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"template": createdTemplate})
+}
+
+func (th *TemplateHandler) HandleUpdateTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template := th.getOwnTemplate(w, r)
+
+	if template == nil {
+		return
+	}
+
+	var updateTemplateRequest struct {
+		Name            *string               `json:"name"`
+		Description     *string               `json:"description"`
+		DurationMinutes *int                  `json:"duration_minutes"`
+		Entries         []store.TemplateEntry `json:"entries"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&updateTemplateRequest)
+
+	if err != nil {
+		th.logger.Printf("ERROR: decodingUpdateTemplate %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if updateTemplateRequest.Name != nil {
+		template.Name = *updateTemplateRequest.Name
+	}
+
+	if updateTemplateRequest.Description != nil {
+		template.Description = *updateTemplateRequest.Description
+	}
+
+	if updateTemplateRequest.DurationMinutes != nil {
+		template.DurationMinutes = *updateTemplateRequest.DurationMinutes
+	}
+
+	if updateTemplateRequest.Entries != nil {
+		template.Entries = updateTemplateRequest.Entries
+	}
+
+	err = validateTemplate(template)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = th.resolveExercises(template.Entries)
+
+	if errors.Is(err, errUnknownExercise) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: resolveExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = th.templateStore.UpdateTemplate(template)
+
+	if err != nil {
+		th.logger.Printf("ERROR: updatingTemplate %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"template": template})
+}
+
+func (th *TemplateHandler) HandleDeleteTemplateByID(w http.ResponseWriter, r *http.Request) {
+	template := th.getOwnTemplate(w, r)
+
+	if template == nil {
+		return
+	}
+
+	err := th.templateStore.DeleteTemplate(int64(template.ID))
+
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "template not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrTemplateInUse) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "this template is used by a program, remove it from the program first"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: deleteTemplate %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleInstantiateTemplate creates a new workout that is prefilled from the template
+func (th *TemplateHandler) HandleInstantiateTemplate(w http.ResponseWriter, r *http.Request) {
+	template := th.getOwnTemplate(w, r)
+
+	if template == nil {
+		return
+	}
+
+	var req instantiateTemplateRequest
+
+	// the request body is optional
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		th.logger.Printf("ERROR: decodingInstantiateTemplate: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	lastWeights := map[string]float64{}
+
+	if req.CarryForwardWeights {
+		lastWeights, err = th.templateStore.GetLastPerformedWeights(template.UserID, int64(template.ID))
+
+		if err != nil {
+			th.logger.Printf("ERROR: getLastPerformedWeights: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	workout, err := th.workoutStore.CreateWorkout(template.Instantiate(lastWeights))
+
+	if err != nil {
+		th.logger.Printf("ERROR: createWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": workout})
+}
@@ -2,18 +2,38 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
 	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/throttle"
 	"github.com/edwinboon/workout-tracking-api/internal/tokens"
 	"github.com/edwinboon/workout-tracking-api/internal/utils"
 )
 
+// mfaChallengeTTL is how long a login has to come up with the second factor
+const mfaChallengeTTL = 5 * time.Minute
+
+// timingUser stands in for unknown usernames, its password is checked so a
+// login with an unknown username takes as long as one with a wrong password
+var timingUser = sync.OnceValue(func() *store.User {
+	user := &store.User{}
+	_ = user.PasswordHash.SetPassword("timing-only")
+	return user
+})
+
 type TokenHandler struct {
 	tokenStore store.TokenStore
 	userStore  store.UserStore
+	mfaStore   store.MFAStore
+	issuer     *TokenIssuer
+	throttler  *throttle.Throttler
 	logger     *log.Logger
 }
 
@@ -22,14 +42,29 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+type mfaTokenRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, mfaStore store.MFAStore, issuer *TokenIssuer, throttler *throttle.Throttler, logger *log.Logger) *TokenHandler {
 	return &TokenHandler{
 		tokenStore: tokenStore,
 		userStore:  userStore,
+		mfaStore:   mfaStore,
+		issuer:     issuer,
+		throttler:  throttler,
 		logger:     logger,
 	}
 }
 
+// HandleCreateToken logs in with a username and password. Users with 2FA get
+// an mfa_token instead of an auth token, see HandleCreateTokenMFA.
 func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var req createTokenRequest
 
@@ -41,16 +76,30 @@ func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// get user
+	ip := utils.ClientIP(r)
+	limits := []throttle.Limit{throttle.Username(req.Username), throttle.IP(ip)}
+
+	if th.throttled(w, limits...) {
+		return
+	}
+
 	user, err := th.userStore.GetUserByUsername(req.Username)
 
-	if err != nil || user == nil {
+	if err != nil {
 		th.logger.Printf("ERROR: get user by username: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	passwordMatches, err := user.PasswordHash.Matches(req.Password)
+	// an unknown username takes as long and gets the same answer as a wrong
+	// password, so usernames can't be found out this way
+	passwordUser := user
+
+	if passwordUser == nil {
+		passwordUser = timingUser()
+	}
+
+	passwordMatches, err := passwordUser.PasswordHash.Matches(req.Password)
 
 	if err != nil {
 		th.logger.Printf("ERROR: PasswordMatches: %v", err)
@@ -58,13 +107,180 @@ func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if !passwordMatches {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+	if user == nil || !passwordMatches {
+		th.failed(w, ip, "invalid credentials", limits...)
+		return
+	}
+
+	if user.IsDisabled() {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this account is disabled"})
+		return
+	}
+
+	// only the username starts over, or a single account of an attacker could
+	// keep resetting the ip
+	err = th.throttler.Succeed(throttle.Username(req.Username))
+
+	if err != nil {
+		th.logger.Printf("ERROR: succeed: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	userTOTP, err := th.mfaStore.GetTOTP(user.ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if userTOTP.Enabled() {
+		challenge, err := th.tokenStore.CreateNewToken(user.ID, mfaChallengeTTL, tokens.ScopeMFAChallenge)
+
+		if err != nil {
+			th.logger.Printf("ERROR: create new token: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"mfa_required": true, "mfa_token": challenge})
 		return
 	}
-	// create token
 
-	token, err := th.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	th.issue(w, r, user)
+}
+
+// HandleCreateTokenMFA finishes a login with 2FA, it trades the mfa_token and
+// a code of the authenticator app or a recovery code for an auth token
+func (th *TokenHandler) HandleCreateTokenMFA(w http.ResponseWriter, r *http.Request) {
+	var req mfaTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		th.logger.Printf("ERROR: mfaTokenRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.MFAToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "mfa_token and a code or recovery_code are required"})
+		return
+	}
+
+	ip := utils.ClientIP(r)
+
+	if th.throttled(w, throttle.IP(ip)) {
+		return
+	}
+
+	user, err := th.userStore.GetUserToken(tokens.ScopeMFAChallenge, req.MFAToken)
+
+	if err != nil {
+		th.logger.Printf("ERROR: getUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		th.failed(w, ip, "mfa token expired or invalid, log in again", throttle.IP(ip))
+		return
+	}
+
+	limits := []throttle.Limit{throttle.MFA(user.ID), throttle.IP(ip)}
+
+	if th.throttled(w, limits...) {
+		return
+	}
+
+	userTOTP, err := th.mfaStore.GetTOTP(user.ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: getTOTP: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// 2FA was turned off since the password was checked
+	if !userTOTP.Enabled() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "mfa token expired or invalid, log in again"})
+		return
+	}
+
+	valid, err := verifyMFACode(th.mfaStore, userTOTP, req.Code, req.RecoveryCode)
+
+	if err != nil {
+		th.logger.Printf("ERROR: verifyMFACode: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !valid {
+		th.failed(w, ip, "invalid code", limits...)
+		return
+	}
+
+	err = th.throttler.Succeed(throttle.MFA(user.ID))
+
+	if err != nil {
+		th.logger.Printf("ERROR: succeed: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = th.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeMFAChallenge)
+
+	if err != nil {
+		th.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	th.issue(w, r, user)
+}
+
+// throttled answers 429 when the limits don't allow another attempt yet
+func (th *TokenHandler) throttled(w http.ResponseWriter, limits ...throttle.Limit) bool {
+	return writeThrottled(w, th.throttler, th.logger, "too many failed attempts, try again later", limits...)
+}
+
+// writeThrottled answers 429 with message and a Retry-After when the limits
+// don't allow another attempt yet
+func writeThrottled(w http.ResponseWriter, throttler *throttle.Throttler, logger *log.Logger, message string, limits ...throttle.Limit) bool {
+	wait, err := throttler.Check(limits...)
+
+	if err != nil {
+		logger.Printf("ERROR: checkThrottle: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return true
+	}
+
+	if wait <= 0 {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": message})
+	return true
+}
+
+// failed records a failed attempt and answers 401 with message
+func (th *TokenHandler) failed(w http.ResponseWriter, ip, message string, limits ...throttle.Limit) {
+	err := th.throttler.Fail(ip, limits...)
+
+	if err != nil {
+		th.logger.Printf("ERROR: fail: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": message})
+}
+
+// issue responds with a new login for the user
+func (th *TokenHandler) issue(w http.ResponseWriter, r *http.Request, user *store.User) {
+	pair, err := th.issuer.Issue(r, user)
 
 	if err != nil {
 		th.logger.Printf("ERROR: create new token: %v", err)
@@ -72,5 +288,101 @@ func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"auth_token": token})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"auth_token": pair.Access, "refresh_token": pair.Refresh})
+}
+
+// HandleRefreshToken trades a refresh token for a new pair, the refresh token
+// can't be used again
+func (th *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		th.logger.Printf("ERROR: refreshTokenRequest: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "refresh_token is required"})
+		return
+	}
+
+	pair, err := th.issuer.Refresh(r, req.RefreshToken)
+
+	var reusedErr *store.RefreshTokenReusedError
+
+	if errors.As(err, &reusedErr) {
+		th.logger.Printf("WARNING: a rotated refresh token was reused, its session is revoked")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "refresh token was already used, log in again"})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("ERROR: rotateRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if pair == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "refresh token expired or invalid"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"auth_token": pair.Access, "refresh_token": pair.Refresh})
+}
+
+// HandleRevokeToken logs out the client, the token of the request and the
+// refresh token that came with it are revoked
+func (th *TokenHandler) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := th.issuer.RevokeSession(r)
+
+	if err != nil {
+		th.logger.Printf("ERROR: revokeSession: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleRevokeAllTokens logs out every session of the current user
+func (th *TokenHandler) HandleRevokeAllTokens(w http.ResponseWriter, r *http.Request) {
+	err := th.issuer.RevokeAll(middleware.GetUser(r).ID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: revokeAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (th *TokenHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	familyID, err := th.issuer.CurrentFamily(r)
+
+	if err != nil {
+		th.logger.Printf("ERROR: currentFamily: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	sessions, err := th.tokenStore.ListSessions(middleware.GetUser(r).ID, familyID)
+
+	if err != nil {
+		th.logger.Printf("ERROR: listSessions: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+// HandleJWKS publishes the keys JWT access tokens are signed with, the list is
+// empty unless JWTs signed with EdDSA are enabled
+func (th *TokenHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"keys": th.issuer.JWKS()})
 }
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/edwinboon/workout-tracking-api/internal/utils"
+)
+
+// TokenIssuer hands out and revokes the tokens of a login. Access tokens are
+// opaque tokens in the tokens table, unless a JWT key set is configured, then
+// they are JWTs that are revoked through the deny list.
+type TokenIssuer struct {
+	tokenStore      store.TokenStore
+	userStore       store.UserStore
+	revocationStore store.RevocationStore
+	ttls            tokens.TTLs
+	keySet          *tokens.KeySet
+	denyList        *tokens.DenyList
+}
+
+// NewTokenIssuer issues opaque access tokens when keySet is nil
+func NewTokenIssuer(tokenStore store.TokenStore, userStore store.UserStore, revocationStore store.RevocationStore, ttls tokens.TTLs, keySet *tokens.KeySet, denyList *tokens.DenyList) *TokenIssuer {
+	return &TokenIssuer{
+		tokenStore:      tokenStore,
+		userStore:       userStore,
+		revocationStore: revocationStore,
+		ttls:            ttls,
+		keySet:          keySet,
+		denyList:        denyList,
+	}
+}
+
+// newPair creates the next pair of a family for the client of the request
+func (ti *TokenIssuer) newPair(r *http.Request, user *store.User, familyID string) (*tokens.Pair, error) {
+	pair, err := tokens.GeneratePair(user.ID, familyID, ti.ttls, r.UserAgent(), utils.ClientIP(r))
+
+	if err != nil || ti.keySet == nil {
+		return pair, err
+	}
+
+	// swap the opaque access token for a JWT, a login may do everything an
+	// api key can be allowed to do
+	jwt, err := ti.keySet.Sign(&tokens.Claims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Activated: user.Activated,
+		Role:      user.Role,
+		Scopes:    store.APIKeyScopes,
+		FamilyID:  familyID,
+		IssuedAt:  time.Now(),
+		ExpiresAt: pair.Access.Expiry,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	pair.Access = &tokens.Token{
+		Plaintext: jwt,
+		UserID:    user.ID,
+		Expiry:    pair.Access.Expiry,
+		Scope:     tokens.ScopeAuth,
+		FamilyID:  familyID,
+		Stateless: true,
+	}
+
+	return pair, nil
+}
+
+// Issue starts a new login for the user
+func (ti *TokenIssuer) Issue(r *http.Request, user *store.User) (*tokens.Pair, error) {
+	familyID, err := tokens.NewFamilyID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := ti.newPair(r, user, familyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = ti.tokenStore.InsertPair(pair)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Refresh rotates the refresh token, see TokenStore.RotateRefreshToken
+func (ti *TokenIssuer) Refresh(r *http.Request, refreshToken string) (*tokens.Pair, error) {
+	pair, err := ti.tokenStore.RotateRefreshToken(refreshToken, func(userID int, familyID string) (*tokens.Pair, error) {
+		// the claims of a JWT need the current state of the user
+		user, err := ti.userStore.GetUserByID(userID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if user == nil {
+			return nil, errors.New("user of the refresh token doesn't exist")
+		}
+
+		return ti.newPair(r, user, familyID)
+	})
+
+	var reusedErr *store.RefreshTokenReusedError
+
+	if errors.As(err, &reusedErr) {
+		revokeErr := ti.revoke(tokens.Revocation{FamilyID: reusedErr.FamilyID})
+
+		if revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+
+	return pair, err
+}
+
+// RevokeSession logs out the login of the request
+func (ti *TokenIssuer) RevokeSession(r *http.Request) error {
+	claims := middleware.GetClaims(r)
+
+	if claims == nil {
+		return ti.tokenStore.DeleteTokenFamily(middleware.GetToken(r))
+	}
+
+	err := ti.tokenStore.DeleteFamily(claims.FamilyID)
+
+	if err != nil {
+		return err
+	}
+
+	return ti.revoke(tokens.Revocation{FamilyID: claims.FamilyID})
+}
+
+// RevokeAll logs out every login of the user, including logins waiting for 2FA
+func (ti *TokenIssuer) RevokeAll(userID int) error {
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh, tokens.ScopeMFAChallenge} {
+		err := ti.tokenStore.DeleteAllTokensForUser(userID, scope)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return ti.revoke(tokens.Revocation{UserID: userID})
+}
+
+// CurrentFamily returns the family of the login of the request
+func (ti *TokenIssuer) CurrentFamily(r *http.Request) (string, error) {
+	claims := middleware.GetClaims(r)
+
+	if claims != nil {
+		return claims.FamilyID, nil
+	}
+
+	return ti.tokenStore.GetTokenFamily(middleware.GetToken(r))
+}
+
+// revoke puts JWTs on the deny list, opaque tokens are revoked by deleting them
+func (ti *TokenIssuer) revoke(rev tokens.Revocation) error {
+	if ti.keySet == nil {
+		return nil
+	}
+
+	// after that every JWT the revocation covers has expired
+	rev.Expiry = time.Now().Add(ti.ttls.Access + time.Minute)
+
+	err := ti.revocationStore.Revoke(&rev)
+
+	if err != nil {
+		return err
+	}
+
+	ti.denyList.Add(rev)
+	return nil
+}
+
+// SyncDenyList picks up the revocations of the other instances of the api
+func (ti *TokenIssuer) SyncDenyList() error {
+	if ti.keySet == nil {
+		return nil
+	}
+
+	err := ti.revocationStore.DeleteExpiredRevocations()
+
+	if err != nil {
+		return err
+	}
+
+	revs, err := ti.revocationStore.ListRevocations()
+
+	if err != nil {
+		return err
+	}
+
+	ti.denyList.Replace(revs)
+	return nil
+}
+
+// JWKS returns the public keys the JWTs can be verified with, it is empty for
+// opaque tokens and HS256
+func (ti *TokenIssuer) JWKS() []tokens.JWK {
+	if ti.keySet == nil {
+		return []tokens.JWK{}
+	}
+
+	return ti.keySet.JWKS()
+}
@@ -3,12 +3,19 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/edwinboon/workout-tracking-api/internal/mailer"
+	"github.com/edwinboon/workout-tracking-api/internal/middleware"
 	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
 	"github.com/edwinboon/workout-tracking-api/internal/utils"
+	"github.com/go-chi/chi/v5"
 )
 
 type RegisterUserRequest struct {
@@ -19,55 +26,121 @@ type RegisterUserRequest struct {
 	Bio       string `json:"bio"`
 }
 
+const activationTTL = 3 * 24 * time.Hour
+
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	issuer     *TokenIssuer
+	logger     *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, mailer mailer.Mailer, issuer *TokenIssuer, logger *log.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     mailer,
+		issuer:     issuer,
+		logger:     logger,
 	}
 }
 
-func (uh *UserHandler) ValidateRegisterRequest(req *RegisterUserRequest) error {
-	if req.Username == "" {
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+type updateUserRequest struct {
+	Username  *string `json:"username"`
+	Email     *string `json:"email"`
+	AvatarURL *string `json:"avatar_url"`
+	Bio       *string `json:"bio"`
+}
+
+var (
+	emailRegex     = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+	avatarURLRegex = regexp.MustCompile(`^(http|https)://[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(/.*)?$`)
+)
+
+func validateUsername(username string) error {
+	if username == "" {
 		return errors.New("username is required")
 	}
 
-	if len(req.Username) < 3 || len(req.Username) > 20 {
+	if len(username) < 3 || len(username) > 20 {
 		return errors.New("username must be between 3 and 20 characters long")
 	}
 
-	if req.Email == "" {
+	return nil
+}
+
+func validateEmail(email string) error {
+	if email == "" {
 		return errors.New("email is required")
 	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
-	if !emailRegex.MatchString(req.Email) {
+	if !emailRegex.MatchString(email) {
 		return errors.New("invalid email format")
 	}
 
-	if req.Password == "" {
+	return nil
+}
+
+func validatePassword(password string) error {
+	if password == "" {
 		return errors.New("password is required")
 	}
 
 	// @TODO - Add password complexity requirements
-	if len(req.Password) < 8 || len(req.Password) > 20 {
+	if len(password) < 8 || len(password) > 20 {
 		return errors.New("password must be between 8 and 20 characters long")
 	}
 
-	avatarURLRegex := regexp.MustCompile(`^(http|https)://[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(/.*)?$`)
+	return nil
+}
 
-	if req.AvatarURL != "" && !avatarURLRegex.MatchString(req.AvatarURL) {
+func validateAvatarURL(avatarURL string) error {
+	if avatarURL != "" && !avatarURLRegex.MatchString(avatarURL) {
 		return errors.New("invalid avatar URL format")
 	}
 
 	return nil
 }
 
+func (uh *UserHandler) ValidateRegisterRequest(req *RegisterUserRequest) error {
+	if err := validateUsername(req.Username); err != nil {
+		return err
+	}
+
+	if err := validateEmail(req.Email); err != nil {
+		return err
+	}
+
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+
+	return validateAvatarURL(req.AvatarURL)
+}
+
+// writeDuplicateUser writes a 409 with the field that is already taken, it
+// returns false when err isn't a uniqueness violation
+func writeDuplicateUser(w http.ResponseWriter, err error) bool {
+	field := ""
+
+	switch {
+	case errors.Is(err, store.ErrDuplicateUsername):
+		field = "username"
+	case errors.Is(err, store.ErrDuplicateEmail):
+		field = "email"
+	default:
+		return false
+	}
+
+	utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error(), "fields": map[string]string{field: err.Error()}})
+	return true
+}
+
 func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req RegisterUserRequest
 
@@ -110,12 +183,246 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 
 	err = uh.userStore.CreateUser(user)
 
+	if writeDuplicateUser(w, err) {
+		return
+	}
+
 	if err != nil {
 		uh.logger.Printf("ERROR: registering user: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
+	// the account exists at this point, a failed mail can be resent later
+	_ = uh.sendActivation(user)
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
+}
+
+func (uh *UserHandler) HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": middleware.GetUser(r)})
+}
 
+func (uh *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingUpdateUser: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	// work on a copy, the user in the context stays as it was when the update fails
+	user := *middleware.GetUser(r)
+	previousEmail := user.Email
+
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+
+	if req.AvatarURL != nil {
+		user.AvatarURL = *req.AvatarURL
+	}
+
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+
+	err = validateUsername(user.Username)
+
+	if err == nil {
+		err = validateEmail(user.Email)
+	}
+
+	if err == nil {
+		err = validateAvatarURL(user.AvatarURL)
+	}
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// a new email has to be verified again
+	emailChanged := !strings.EqualFold(user.Email, previousEmail)
+
+	if emailChanged {
+		user.Activated = false
+		user.EmailVerifiedAt = nil
+	}
+
+	err = uh.userStore.UpdateUser(&user)
+
+	if writeDuplicateUser(w, err) {
+		return
+	}
+
+	if err != nil {
+		uh.logger.Printf("ERROR: updateUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if !emailChanged {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+		return
+	}
+
+	_ = uh.sendActivation(&user)
+
+	// the logins carry the email and the activation in their claims, they are
+	// revoked so none of them passes as activated anymore
+	err = uh.issuer.RevokeAll(user.ID)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: revokeAll: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	// an api key isn't a login, it stays and sees the new email right away
+	if middleware.GetAPIKey(r) != nil {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+		return
+	}
+
+	pair, err := uh.issuer.Issue(r, &user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: create new token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user, "auth_token": pair.Access, "refresh_token": pair.Refresh})
+}
+
+// HandleGetUserProfile returns the public profile of a user
+func (uh *UserHandler) HandleGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	user, err := uh.userStore.GetUserByUsername(username)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: getUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user.Profile()})
+}
+
+// HandleActivateUser consumes an activation token and marks the email of its
+// user as verified
+func (uh *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: decodingActivateUser: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		return
+	}
+
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := uh.userStore.GetUserToken(tokens.ScopeActivation, req.Token)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: getUserToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid or expired activation token"})
+		return
+	}
+
+	err = uh.userStore.ActivateUser(user)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: activateUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleResendActivation mails a new activation token to the current user,
+// earlier tokens stop working
+func (uh *UserHandler) HandleResendActivation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	if user.Activated {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "your account is already activated"})
+		return
+	}
+
+	err := uh.sendActivation(user)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"message": fmt.Sprintf("an activation token is on its way to %s", user.Email)})
+}
+
+// sendActivation replaces the activation tokens of the user with a new one and
+// mails it, it logs the error itself
+func (uh *UserHandler) sendActivation(user *store.User) error {
+	err := uh.tokenStore.DeleteAllTokensForUser(user.ID, tokens.ScopeActivation)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: deleteAllTokensForUser: %v", err)
+		return err
+	}
+
+	token, err := uh.tokenStore.CreateNewToken(user.ID, activationTTL, tokens.ScopeActivation)
+
+	if err != nil {
+		uh.logger.Printf("ERROR: create new token: %v", err)
+		return err
+	}
+
+	err = uh.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Activate your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse this token to verify your email and activate your account:\n\n%s\n\nIt expires at %s.\n",
+			user.Username, token.Plaintext, token.Expiry.UTC().Format(time.RFC1123),
+		),
+	})
+
+	if err != nil {
+		uh.logger.Printf("ERROR: sendActivation: %v", err)
+		return err
+	}
+
+	return nil
 }
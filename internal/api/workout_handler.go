@@ -4,27 +4,186 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
 	"github.com/edwinboon/workout-tracking-api/internal/middleware"
 	"github.com/edwinboon/workout-tracking-api/internal/store"
 	"github.com/edwinboon/workout-tracking-api/internal/utils"
 )
 
 type WorkoutHandler struct {
-	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	workoutStore  store.WorkoutStore
+	exerciseStore store.ExerciseStore
+	authorizer    *authz.Authorizer
+	logger        *log.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+var errUnknownExercise = errors.New("unknown exercise_id")
+
+func NewWorkoutHandler(workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, authorizer *authz.Authorizer, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		workoutStore: workoutStore,
-		logger:       logger,
+		workoutStore:  workoutStore,
+		exerciseStore: exerciseStore,
+		authorizer:    authorizer,
+		logger:        logger,
 	}
 }
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
 // methods that live on the WorkoutHandler handler
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	wh.listWorkouts(w, r, middleware.GetUser(r).ID)
+}
+
+// HandleListAthleteWorkouts lists the workouts of an athlete for their coach
+func (wh *WorkoutHandler) HandleListAthleteWorkouts(w http.ResponseWriter, r *http.Request) {
+	athleteID, ok := wh.authorizeAthlete(w, r, authz.ReadWorkouts)
+
+	if !ok {
+		return
+	}
+
+	wh.listWorkouts(w, r, athleteID)
+}
+
+// authorizeAthlete reads the athlete of the id param and writes the error
+// response itself when the current user may not use the permission on them
+func (wh *WorkoutHandler) authorizeAthlete(w http.ResponseWriter, r *http.Request, permission authz.Permission) (int, bool) {
+	athleteID, err := utils.ReadIDParam(r)
+
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid athlete id"})
+		return 0, false
+	}
+
+	err = wh.authorizer.AuthorizeUser(middleware.GetUser(r), permission, int(athleteID))
+
+	if errors.Is(err, authz.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you don't have this access to the workouts of this athlete"})
+		return 0, false
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: authorizeUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+
+	return int(athleteID), true
+}
+
+func (wh *WorkoutHandler) listWorkouts(w http.ResponseWriter, r *http.Request, userID int) {
+	query := r.URL.Query()
+
+	filter := store.WorkoutFilter{
+		UserID:       userID,
+		Title:        query.Get("title"),
+		ExerciseName: query.Get("exercise"),
+		Sort:         store.WorkoutSortPerformedAt,
+		Descending:   true,
+		Cursor:       query.Get("cursor"),
+		Limit:        defaultListLimit,
+	}
+
+	var err error
+
+	filter.From, err = utils.ReadTimeQuery(r, "from")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// a date-only to includes that day
+	filter.To, err = utils.ReadEndTimeQuery(r, "to")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "from must be before to"})
+		return
+	}
+
+	filter.MinDuration, err = utils.ReadIntQuery(r, "min_duration")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	filter.MaxDuration, err = utils.ReadIntQuery(r, "max_duration")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	limit, err := utils.ReadIntQuery(r, "limit")
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if limit != nil {
+		if *limit < 1 || *limit > maxListLimit {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit)})
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		switch sort {
+		case store.WorkoutSortPerformedAt, store.WorkoutSortCreatedAt, store.WorkoutSortDuration, store.WorkoutSortCalories:
+			filter.Sort = sort
+		default:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "sort must be one of performed_at, created_at, duration or calories"})
+			return
+		}
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+		filter.Descending = true
+	case "asc":
+		filter.Descending = false
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "order must be asc or desc"})
+		return
+	}
+
+	workouts, nextCursor, err := wh.workoutStore.ListWorkouts(filter)
+
+	if errors.Is(err, store.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid cursor"})
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: listWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts, "next_cursor": nextCursor})
+}
+
 func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 
@@ -34,6 +193,20 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// other people's workouts are reported as missing, not as forbidden
+	err = wh.authorizer.AuthorizeWorkout(middleware.GetUser(r), authz.ReadWorkouts, workoutID)
+
+	if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: authorizeWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
 	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 
 	if err != nil {
@@ -42,10 +215,248 @@ func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if workout == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return
+	}
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
+func validateWorkoutVisibility(visibility string) error {
+	for _, v := range store.WorkoutVisibilities {
+		if visibility == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("visibility must be one of %s", strings.Join(store.WorkoutVisibilities, ", "))
+}
+
+// the length of the title column
+const maxWorkoutTitleLength = 255
+
+func validateWorkoutTitle(title string) error {
+	if utf8.RuneCountInString(title) > maxWorkoutTitleLength {
+		return fmt.Errorf("title can't be longer than %d characters", maxWorkoutTitleLength)
+	}
+
+	return nil
+}
+
+func validateWorkoutEntries(entries []store.WorkoutEntry) error {
+	for _, entry := range entries {
+		if entry.ExerciseName == "" && entry.ExerciseID == nil {
+			return errors.New("exercise_name or exercise_id is required")
+		}
+
+		err := validateEntryMetrics(entry)
+
+		if err != nil {
+			return err
+		}
+
+		// legacy entries without sets carry the values on the entry itself
+		if len(entry.Sets) == 0 {
+			err := validateEntryKind(entry.Kind, entry.ExerciseName, entry.Reps, entry.DurationSeconds, entry.DistanceMeters)
+
+			if err != nil {
+				return err
+			}
+
+			if entry.Reps != nil && entry.DurationSeconds != nil {
+				return fmt.Errorf("%s can't have both reps and duration_seconds", entry.ExerciseName)
+			}
+		}
+
+		for _, set := range entry.Sets {
+			switch set.SetType {
+			case "", store.SetTypeWarmup, store.SetTypeWorking, store.SetTypeDrop, store.SetTypeFailure:
+			default:
+				return fmt.Errorf("invalid set_type %q for %s", set.SetType, entry.ExerciseName)
+			}
+
+			err := validateEntryKind(entry.Kind, entry.ExerciseName, set.Reps, set.DurationSeconds, set.DistanceMeters)
+
+			if err != nil {
+				return err
+			}
+
+			if set.RPE != nil && (*set.RPE < 1 || *set.RPE > 10) {
+				return fmt.Errorf("rpe must be between 1 and 10 for %s", entry.ExerciseName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateEntryKind mirrors the kind checks of the database: strength and
+// mobility work is done for reps or for time, cardio for time and/or distance
+func validateEntryKind(kind, name string, reps, durationSeconds *int, distanceMeters *float64) error {
+	switch kind {
+	case "", store.EntryKindStrength, store.EntryKindMobility:
+		if reps == nil && durationSeconds == nil {
+			return fmt.Errorf("%s needs reps or duration_seconds", name)
+		}
+	case store.EntryKindCardio:
+		if reps != nil {
+			return fmt.Errorf("cardio entry %s can't have reps", name)
+		}
+
+		if durationSeconds == nil && distanceMeters == nil {
+			return fmt.Errorf("cardio entry %s needs duration_seconds or distance_meters", name)
+		}
+	default:
+		return fmt.Errorf("invalid kind %q for %s", kind, name)
+	}
+
+	if durationSeconds != nil && *durationSeconds < 0 {
+		return fmt.Errorf("duration_seconds can't be negative for %s", name)
+	}
+
+	if distanceMeters != nil && *distanceMeters < 0 {
+		return fmt.Errorf("distance_meters can't be negative for %s", name)
+	}
+
+	return nil
+}
+
+func validateEntryMetrics(entry store.WorkoutEntry) error {
+	if entry.ElevationGainMeters != nil && *entry.ElevationGainMeters < 0 {
+		return fmt.Errorf("elevation_gain_meters can't be negative for %s", entry.ExerciseName)
+	}
+
+	if entry.AvgHeartRate != nil && *entry.AvgHeartRate <= 0 {
+		return fmt.Errorf("avg_heart_rate must be positive for %s", entry.ExerciseName)
+	}
+
+	if entry.MaxHeartRate != nil && *entry.MaxHeartRate <= 0 {
+		return fmt.Errorf("max_heart_rate must be positive for %s", entry.ExerciseName)
+	}
+
+	if entry.AvgHeartRate != nil && entry.MaxHeartRate != nil && *entry.AvgHeartRate > *entry.MaxHeartRate {
+		return fmt.Errorf("avg_heart_rate can't be larger than max_heart_rate for %s", entry.ExerciseName)
+	}
+
+	if entry.Cadence != nil && *entry.Cadence <= 0 {
+		return fmt.Errorf("cadence must be positive for %s", entry.ExerciseName)
+	}
+
+	return nil
+}
+
+// resolveExercise looks up an entry in the exercise catalog. An exercise_id
+// wins, otherwise the name is matched against the names and aliases. Unknown
+// names return nil and stay free text.
+func resolveExercise(exerciseStore store.ExerciseStore, exerciseID *int, name string) (*store.Exercise, error) {
+	if exerciseID == nil {
+		return exerciseStore.FindExerciseByName(name)
+	}
+
+	exercise, err := exerciseStore.GetExerciseByID(*exerciseID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exercise == nil {
+		return nil, errUnknownExercise
+	}
+
+	return exercise, nil
+}
+
+func (wh *WorkoutHandler) resolveExercises(entries []store.WorkoutEntry) error {
+	return resolveWorkoutExercises(wh.exerciseStore, entries)
+}
+
+// resolveWorkoutExercises links the entries to the catalog and uses the catalog names
+func resolveWorkoutExercises(exerciseStore store.ExerciseStore, entries []store.WorkoutEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+
+		exercise, err := resolveExercise(exerciseStore, entry.ExerciseID, entry.ExerciseName)
+
+		if err != nil {
+			return err
+		}
+
+		if exercise == nil {
+			continue
+		}
+
+		entry.ExerciseID = &exercise.ID
+		entry.ExerciseName = exercise.Name
+	}
+
+	return nil
+}
+
+// validateWorkoutTimes fills in the defaults for the timestamps of a workout.
+// When both start and end are known the duration is derived from them, a
+// duration that was sent as well has to match.
+func validateWorkoutTimes(workout *store.Workout, durationSent bool) error {
+	if workout.Timezone == "" {
+		workout.Timezone = store.DefaultTimezone
+	}
+
+	if _, err := time.LoadLocation(workout.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", workout.Timezone)
+	}
+
+	if workout.StartedAt != nil && workout.EndedAt != nil {
+		if !workout.EndedAt.After(*workout.StartedAt) {
+			return errors.New("ended_at must be after started_at")
+		}
+
+		duration := int(math.Round(workout.EndedAt.Sub(*workout.StartedAt).Minutes()))
+
+		// allow a minute of rounding difference
+		if durationSent && math.Abs(float64(workout.DurationMinutes-duration)) > 1 {
+			return fmt.Errorf("duration_minutes doesn't match started_at and ended_at, expected %d", duration)
+		}
+
+		workout.DurationMinutes = duration
+	}
+
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+
+		if workout.StartedAt != nil {
+			workout.PerformedAt = *workout.StartedAt
+		}
+	}
+
+	return nil
+}
+
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	if currentUser == nil || currentUser == store.AnonymousUser {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to create a workout"})
+		return
+	}
+
+	wh.createWorkout(w, r, currentUser.ID, nil)
+}
+
+// HandleCreateAthleteWorkout lets a coach plan a workout for an athlete, the
+// athlete completes it later
+func (wh *WorkoutHandler) HandleCreateAthleteWorkout(w http.ResponseWriter, r *http.Request) {
+	athleteID, ok := wh.authorizeAthlete(w, r, authz.WriteWorkouts)
+
+	if !ok {
+		return
+	}
+
+	wh.createWorkout(w, r, athleteID, &middleware.GetUser(r).ID)
+}
+
+// createWorkout creates a workout for userID, a workout planned by someone
+// else is created as planned and private, the visibility is up to the owner
+func (wh *WorkoutHandler) createWorkout(w http.ResponseWriter, r *http.Request, userID int, plannedBy *int) {
 	var workout store.Workout
 	err := json.NewDecoder(r.Body).Decode(&workout)
 
@@ -55,14 +466,58 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	currentUser := middleware.GetUser(r)
+	if workout.Visibility == "" || plannedBy != nil {
+		workout.Visibility = store.VisibilityPrivate
+	}
 
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to create a workout"})
+	err = validateWorkoutVisibility(workout.Visibility)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkoutTitle(workout.Title)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkoutEntries(workout.Entries)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = validateWorkoutTimes(&workout, workout.DurationMinutes != 0)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = wh.resolveExercises(workout.Entries)
+
+	if errors.Is(err, errUnknownExercise) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: resolveExercises: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 		return
 	}
 
-	workout.UserID = currentUser.ID
+	workout.UserID = userID
+	workout.TemplateID = nil // only set when a workout is started from a template
+	workout.PlannedBy = plannedBy
+
+	if plannedBy != nil {
+		workout.Planned = true
+	}
 
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
 
@@ -75,6 +530,37 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
 }
 
+// authorizeWorkoutChange writes the error response itself and returns false
+// when the current user may not change the workout, action is for the message
+func (wh *WorkoutHandler) authorizeWorkoutChange(w http.ResponseWriter, r *http.Request, workoutID int64, action string) bool {
+	currentUser := middleware.GetUser(r)
+
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": fmt.Sprintf("you must be logged in to %s a workout", action)})
+		return false
+	}
+
+	err := wh.authorizer.AuthorizeWorkout(currentUser, authz.WriteWorkouts, workoutID)
+
+	if errors.Is(err, authz.ErrNotFound) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		return false
+	}
+
+	if errors.Is(err, authz.ErrForbidden) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("you are not allowed to %s this workout", action)})
+		return false
+	}
+
+	if err != nil {
+		wh.logger.Printf("ERROR: authorizeWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+
+	return true
+}
+
 func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 
@@ -84,6 +570,10 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
+	if !wh.authorizeWorkoutChange(w, r, workoutID, "update") {
+		return
+	}
+
 	existingWorkout, err := wh.workoutStore.GetWorkoutByID(workoutID)
 
 	if err != nil {
@@ -105,6 +595,12 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		Description     *string              `json:"description"`
 		DurationMinutes *int                 `json:"duration_minutes"`
 		CaloriesBurned  *int                 `json:"calories_burned"`
+		PerformedAt     *time.Time           `json:"performed_at"`
+		StartedAt       *time.Time           `json:"started_at"`
+		EndedAt         *time.Time           `json:"ended_at"`
+		Timezone        *string              `json:"timezone"`
+		Visibility      *string              `json:"visibility"`
+		Planned         *bool                `json:"planned"`
 		Entries         []store.WorkoutEntry `json:"entries"`
 	}
 
@@ -117,6 +613,13 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 	}
 
 	if updateWorkoutRequest.Title != nil {
+		err = validateWorkoutTitle(*updateWorkoutRequest.Title)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
 		existingWorkout.Title = *updateWorkoutRequest.Title
 	}
 
@@ -132,35 +635,77 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		existingWorkout.CaloriesBurned = *updateWorkoutRequest.CaloriesBurned
 	}
 
-	if updateWorkoutRequest.Entries != nil {
-		existingWorkout.Entries = updateWorkoutRequest.Entries
+	if updateWorkoutRequest.PerformedAt != nil {
+		existingWorkout.PerformedAt = *updateWorkoutRequest.PerformedAt
 	}
 
-	currentUser := middleware.GetUser(r)
+	if updateWorkoutRequest.StartedAt != nil {
+		existingWorkout.StartedAt = updateWorkoutRequest.StartedAt
+	}
 
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to update a workout"})
-		return
+	if updateWorkoutRequest.EndedAt != nil {
+		existingWorkout.EndedAt = updateWorkoutRequest.EndedAt
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	if updateWorkoutRequest.Timezone != nil {
+		existingWorkout.Timezone = *updateWorkoutRequest.Timezone
+	}
 
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			wh.logger.Printf("ERROR: workout not found %v", err)
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+	if updateWorkoutRequest.Visibility != nil {
+		err = validateWorkoutVisibility(*updateWorkoutRequest.Visibility)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 			return
 		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-		return
+
+		// who gets to see a workout is up to its owner, not their coach
+		if *updateWorkoutRequest.Visibility != existingWorkout.Visibility && middleware.GetUser(r).ID != existingWorkout.UserID {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "only the owner can change the visibility of this workout"})
+			return
+		}
+
+		existingWorkout.Visibility = *updateWorkoutRequest.Visibility
+	}
+
+	// a planned workout is done once planned is turned off, its sets can be
+	// completed from then on
+	if updateWorkoutRequest.Planned != nil {
+		existingWorkout.Planned = *updateWorkoutRequest.Planned
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to update this workout"})
+	err = validateWorkoutTimes(existingWorkout, updateWorkoutRequest.DurationMinutes != nil)
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	if updateWorkoutRequest.Entries != nil {
+		err = validateWorkoutEntries(updateWorkoutRequest.Entries)
+
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		err = wh.resolveExercises(updateWorkoutRequest.Entries)
+
+		if errors.Is(err, errUnknownExercise) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			wh.logger.Printf("ERROR: resolveExercises: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		existingWorkout.Entries = updateWorkoutRequest.Entries
+	}
+
+	err = wh.workoutStore.UpdateWorkout(existingWorkout, updateWorkoutRequest.Entries != nil)
 
 	if err != nil {
 		wh.logger.Printf("ERROR: updatingWorkout %v", err)
@@ -181,27 +726,7 @@ func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http
 		return
 	}
 
-	currentUser := middleware.GetUser(r)
-
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to delete a workout"})
-		return
-	}
-
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			wh.logger.Printf("ERROR: workout not found %v", err)
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-		return
-	}
-
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to delete this workout"})
+	if !wh.authorizeWorkoutChange(w, r, workoutID, "delete") {
 		return
 	}
 
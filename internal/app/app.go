@@ -2,24 +2,48 @@ package app
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/edwinboon/workout-tracking-api/internal/analytics"
 	"github.com/edwinboon/workout-tracking-api/internal/api"
+	"github.com/edwinboon/workout-tracking-api/internal/authz"
+	"github.com/edwinboon/workout-tracking-api/internal/mailer"
 	"github.com/edwinboon/workout-tracking-api/internal/middleware"
 	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/throttle"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
 	"github.com/edwinboon/workout-tracking-api/migrations"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     *middleware.UserMiddleware
-	DB             *sql.DB
+	Logger                *log.Logger
+	WorkoutHandler        *api.WorkoutHandler
+	ExerciseHandler       *api.ExerciseHandler
+	PersonalRecordHandler *api.PersonalRecordHandler
+	StatsHandler          *api.StatsHandler
+	TemplateHandler       *api.TemplateHandler
+	ProgramHandler        *api.ProgramHandler
+	ImportHandler         *api.ImportHandler
+	ExportHandler         *api.ExportHandler
+	UserHandler           *api.UserHandler
+	TokenHandler          *api.TokenHandler
+	APIKeyHandler         *api.APIKeyHandler
+	MFAHandler            *api.MFAHandler
+	AdminHandler          *api.AdminHandler
+	CoachingHandler       *api.CoachingHandler
+	CommentHandler        *api.CommentHandler
+	OrganizationHandler   *api.OrganizationHandler
+	ShareHandler          *api.ShareHandler
+	FollowHandler         *api.FollowHandler
+	PasswordHandler       *api.PasswordHandler
+	Middleware            *middleware.UserMiddleware
+	DB                    *sql.DB
 }
 
 func NewApplication() (*Application, error) {
@@ -42,25 +66,238 @@ func NewApplication() (*Application, error) {
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	exerciseStore := store.NewPostgresExerciseStore(pgDB)
+	personalRecordStore := store.NewPostgresPersonalRecordStore(pgDB)
+	statsStore := analytics.NewPostgresStatsStore(pgDB)
+	templateStore := store.NewPostgresTemplateStore(pgDB)
+	programStore := store.NewPostgresProgramStore(pgDB)
+	exportStore := store.NewPostgresExportStore(pgDB)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	revocationStore := store.NewPostgresRevocationStore(pgDB)
+	mfaStore := store.NewPostgresMFAStore(pgDB)
+	coachingStore := store.NewPostgresCoachingStore(pgDB)
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	organizationStore := store.NewPostgresOrganizationStore(pgDB)
+	followStore := store.NewPostgresFollowStore(pgDB)
+	shareStore := store.NewPostgresShareStore(pgDB)
+
+	// failed logins are kept in postgres so every instance of the api sees
+	// them, LOGIN_ATTEMPT_STORE=memory keeps them in this instance only
+	var attemptStore store.AttemptStore = store.NewPostgresAttemptStore(pgDB)
+
+	switch os.Getenv("LOGIN_ATTEMPT_STORE") {
+	case "", "postgres":
+	case "memory":
+		attemptStore = store.NewMemoryAttemptStore()
+	default:
+		return nil, fmt.Errorf("LOGIN_ATTEMPT_STORE must be postgres or memory")
+	}
+
+	// mails are logged unless MAILER_DIR points to a directory to write them to
+	var appMailer mailer.Mailer = mailer.NewLogMailer(logger)
+
+	if dir := os.Getenv("MAILER_DIR"); dir != "" {
+		appMailer, err = mailer.NewFileMailer(dir)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ttls, err := tokenTTLs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keySet, err := jwtKeySet(logger)
+
+	if err != nil {
+		return nil, err
+	}
+
+	denyList := tokens.NewDenyList()
+	tokenIssuer := api.NewTokenIssuer(tokenStore, userStore, revocationStore, ttls, keySet, denyList)
+
+	err = tokenIssuer.SyncDenyList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if keySet != nil {
+		go syncDenyList(tokenIssuer, logger)
+	}
+
+	throttler := throttle.NewThrottler(attemptStore, logger)
+	go pruneLoginAttempts(throttler, logger)
+
+	authorizer := authz.NewAuthorizer(workoutStore, coachingStore, followStore, organizationStore)
 
 	// handlers
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
-	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	workoutHandler := api.NewWorkoutHandler(workoutStore, exerciseStore, authorizer, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	personalRecordHandler := api.NewPersonalRecordHandler(personalRecordStore, exerciseStore, logger)
+	statsHandler := api.NewStatsHandler(statsStore, logger)
+	templateHandler := api.NewTemplateHandler(templateStore, workoutStore, exerciseStore, logger)
+	programHandler := api.NewProgramHandler(programStore, templateStore, personalRecordStore, logger)
+	importHandler := api.NewImportHandler(workoutStore, exerciseStore, logger)
+	exportHandler := api.NewExportHandler(exportStore, logger)
+	userHandler := api.NewUserHandler(userStore, tokenStore, appMailer, tokenIssuer, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, mfaStore, tokenIssuer, throttler, logger)
+	passwordHandler := api.NewPasswordHandler(userStore, tokenStore, appMailer, tokenIssuer, throttler, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	mfaHandler := api.NewMFAHandler(mfaStore, logger)
+	adminHandler := api.NewAdminHandler(userStore, tokenIssuer, logger)
+	coachingHandler := api.NewCoachingHandler(coachingStore, userStore, logger)
+	commentHandler := api.NewCommentHandler(commentStore, workoutStore, authorizer, logger)
+	organizationHandler := api.NewOrganizationHandler(organizationStore, userStore, workoutStore, statsStore, logger)
+	shareHandler := api.NewShareHandler(shareStore, workoutStore, userStore, authorizer, logger)
+	followHandler := api.NewFollowHandler(followStore, userStore, workoutStore, logger)
+	middlewareHandler := middleware.UserMiddleware{
+		UserStore:   userStore,
+		TokenStore:  tokenStore,
+		APIKeyStore: apiKeyStore,
+		JWTKeySet:   keySet,
+		DenyList:    denyList,
+		Logger:      logger,
+	}
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     &middlewareHandler,
-		DB:             pgDB,
+		Logger:                logger,
+		WorkoutHandler:        workoutHandler,
+		ExerciseHandler:       exerciseHandler,
+		PersonalRecordHandler: personalRecordHandler,
+		StatsHandler:          statsHandler,
+		TemplateHandler:       templateHandler,
+		ProgramHandler:        programHandler,
+		ImportHandler:         importHandler,
+		ExportHandler:         exportHandler,
+		UserHandler:           userHandler,
+		TokenHandler:          tokenHandler,
+		APIKeyHandler:         apiKeyHandler,
+		MFAHandler:            mfaHandler,
+		AdminHandler:          adminHandler,
+		CoachingHandler:       coachingHandler,
+		CommentHandler:        commentHandler,
+		OrganizationHandler:   organizationHandler,
+		ShareHandler:          shareHandler,
+		FollowHandler:         followHandler,
+		PasswordHandler:       passwordHandler,
+		Middleware:            &middlewareHandler,
+		DB:                    pgDB,
 	}
 
 	return app, nil
 }
 
+// tokenTTLs reads the lifetimes of the access and refresh tokens from
+// ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL, e.g. "15m" or "720h"
+func tokenTTLs() (tokens.TTLs, error) {
+	ttls := tokens.TTLs{
+		Access:  tokens.DefaultAccessTTL,
+		Refresh: tokens.DefaultRefreshTTL,
+	}
+
+	for env, ttl := range map[string]*time.Duration{"ACCESS_TOKEN_TTL": &ttls.Access, "REFRESH_TOKEN_TTL": &ttls.Refresh} {
+		value := os.Getenv(env)
+
+		if value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+
+		if err != nil || duration <= 0 {
+			return ttls, fmt.Errorf("%s must be a positive duration, got %q", env, value)
+		}
+
+		*ttl = duration
+	}
+
+	if ttls.Refresh <= ttls.Access {
+		return ttls, fmt.Errorf("REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+
+	return ttls, nil
+}
+
+// jwtKeySet returns nil unless AUTH_TOKEN_MODE is "jwt". JWT_ALG picks EdDSA
+// (the default) or HS256 and JWT_KEYS holds comma separated base64 Ed25519
+// seeds or HS256 secrets. The first key signs, the others only verify, so a
+// new key is rolled out by putting it in front.
+func jwtKeySet(logger *log.Logger) (*tokens.KeySet, error) {
+	switch os.Getenv("AUTH_TOKEN_MODE") {
+	case "", "opaque":
+		return nil, nil
+	case "jwt":
+	default:
+		return nil, fmt.Errorf("AUTH_TOKEN_MODE must be opaque or jwt")
+	}
+
+	keys := [][]byte{}
+
+	for _, value := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		value = strings.TrimSpace(value)
+
+		if value == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEYS: %w", err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	switch os.Getenv("JWT_ALG") {
+	case "", tokens.AlgEdDSA:
+		if len(keys) == 0 {
+			seed, err := tokens.GenerateEdDSASeed()
+
+			if err != nil {
+				return nil, err
+			}
+
+			logger.Printf("WARNING: JWT_KEYS is empty, tokens are signed with a random key and stop working on a restart")
+			keys = append(keys, seed)
+		}
+
+		return tokens.NewEdDSAKeySet(keys)
+	case tokens.AlgHS256:
+		return tokens.NewHS256KeySet(keys)
+	default:
+		return nil, fmt.Errorf("JWT_ALG must be %s or %s", tokens.AlgEdDSA, tokens.AlgHS256)
+	}
+}
+
+// denyListSyncInterval is how long a JWT revoked by another instance of the
+// api keeps working on this one
+const denyListSyncInterval = 30 * time.Second
+
+func syncDenyList(issuer *api.TokenIssuer, logger *log.Logger) {
+	for range time.Tick(denyListSyncInterval) {
+		err := issuer.SyncDenyList()
+
+		if err != nil {
+			logger.Printf("ERROR: syncDenyList: %v", err)
+		}
+	}
+}
+
+func pruneLoginAttempts(throttler *throttle.Throttler, logger *log.Logger) {
+	for range time.Tick(time.Hour) {
+		err := throttler.Prune()
+
+		if err != nil {
+			logger.Printf("ERROR: pruneLoginAttempts: %v", err)
+		}
+	}
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Status is available\n")
 }
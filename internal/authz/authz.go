@@ -0,0 +1,169 @@
+package authz
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// Permission is something a user may do with the data of another user,
+// everyone may do everything with their own data
+type Permission string
+
+const (
+	ReadWorkouts    Permission = "workouts:read"
+	WriteWorkouts   Permission = "workouts:write"
+	CommentWorkouts Permission = "workouts:comment"
+)
+
+// rolePermissions are the permissions each role has over the data of others
+var rolePermissions = map[string]map[Permission]bool{
+	store.RoleUser:  {},
+	store.RoleCoach: {},
+	store.RoleAdmin: {ReadWorkouts: true},
+}
+
+// coachPermissions are the permissions the access of an accepted coaching
+// gives the coach over the data of the athlete
+var coachPermissions = map[string]map[Permission]bool{
+	store.CoachAccessRead:      {ReadWorkouts: true, CommentWorkouts: true},
+	store.CoachAccessReadWrite: {ReadWorkouts: true, WriteWorkouts: true, CommentWorkouts: true},
+}
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+)
+
+// RoleHas tells whether the role has the permission, unknown roles have none
+func RoleHas(role string, permission Permission) bool {
+	return rolePermissions[role][permission]
+}
+
+// IsCoach tells whether the role may coach, admins can do what coaches do
+func IsCoach(role string) bool {
+	return role == store.RoleCoach || role == store.RoleAdmin
+}
+
+// ValidCoachAccess tells whether access is one of store.CoachAccesses
+func ValidCoachAccess(access string) bool {
+	_, ok := coachPermissions[access]
+	return ok
+}
+
+// ValidRole tells whether role is one of store.Roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Authorizer decides who may do what, the handlers ask it instead of
+// comparing owners themselves
+type Authorizer struct {
+	workoutStore      store.WorkoutStore
+	coachingStore     store.CoachingStore
+	followStore       store.FollowStore
+	organizationStore store.OrganizationStore
+}
+
+func NewAuthorizer(workoutStore store.WorkoutStore, coachingStore store.CoachingStore, followStore store.FollowStore, organizationStore store.OrganizationStore) *Authorizer {
+	return &Authorizer{
+		workoutStore:      workoutStore,
+		coachingStore:     coachingStore,
+		followStore:       followStore,
+		organizationStore: organizationStore,
+	}
+}
+
+// Can tells whether the user may use the permission on data of ownerID, by
+// owning it, by their role or as the coach of the owner
+func (a *Authorizer) Can(user *store.User, permission Permission, ownerID int) (bool, error) {
+	if user == nil || user.IsAnonymous() {
+		return false, nil
+	}
+
+	if user.ID == ownerID || RoleHas(user.Role, permission) {
+		return true, nil
+	}
+
+	// a coach that lost the role loses their athletes too
+	if !IsCoach(user.Role) {
+		return false, nil
+	}
+
+	access, err := a.coachingStore.GetCoachAccess(user.ID, ownerID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return coachPermissions[access][permission], nil
+}
+
+// AuthorizeUser returns ErrForbidden when the user may not use the permission
+// on data of ownerID
+func (a *Authorizer) AuthorizeUser(user *store.User, permission Permission, ownerID int) error {
+	ok, err := a.Can(user, permission, ownerID)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// CanSee tells whether the visibility of a workout of ownerID lets the user
+// read it, even without any permission on the data of ownerID. Unlisted
+// workouts are only seen through their share links.
+func (a *Authorizer) CanSee(user *store.User, ownerID int, visibility string) (bool, error) {
+	if visibility == store.VisibilityPublic {
+		return true, nil
+	}
+
+	if user == nil || user.IsAnonymous() {
+		return false, nil
+	}
+
+	switch visibility {
+	case store.VisibilityFollowers:
+		return a.followStore.IsFollowing(user.ID, ownerID)
+	case store.VisibilityOrg:
+		return a.organizationStore.SharesOrganization(user.ID, ownerID)
+	}
+
+	return false, nil
+}
+
+// AuthorizeWorkout returns ErrNotFound when the workout doesn't exist and
+// ErrForbidden when the user may not use the permission on it, the visibility
+// of the workout can only give ReadWorkouts
+func (a *Authorizer) AuthorizeWorkout(user *store.User, permission Permission, workoutID int64) error {
+	ownerID, visibility, err := a.workoutStore.GetWorkoutVisibility(workoutID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if permission == ReadWorkouts {
+		visible, err := a.CanSee(user, ownerID, visibility)
+
+		if err != nil {
+			return err
+		}
+
+		if visible {
+			return nil
+		}
+	}
+
+	return a.AuthorizeUser(user, permission, ownerID)
+}
@@ -0,0 +1,146 @@
+package authz
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWorkout struct {
+	owner      int
+	visibility string
+}
+
+// fakeWorkoutStore only knows who owns which workout and who may see it
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+	workouts map[int64]fakeWorkout
+}
+
+func (f *fakeWorkoutStore) GetWorkoutVisibility(id int64) (int, string, error) {
+	workout, ok := f.workouts[id]
+
+	if !ok {
+		return 0, "", sql.ErrNoRows
+	}
+
+	return workout.owner, workout.visibility, nil
+}
+
+// fakeFollowStore knows who follows who, by follower and followee
+type fakeFollowStore struct {
+	store.FollowStore
+	follows map[[2]int]bool
+}
+
+func (f *fakeFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	return f.follows[[2]int{followerID, followeeID}], nil
+}
+
+// fakeOrganizationStore puts every user in an organization of their own or
+// none, by user
+type fakeOrganizationStore struct {
+	store.OrganizationStore
+	orgs map[int]int
+}
+
+func (f *fakeOrganizationStore) SharesOrganization(userID, otherID int) (bool, error) {
+	org, ok := f.orgs[userID]
+
+	return ok && f.orgs[otherID] == org, nil
+}
+
+// fakeCoachingStore knows the access of the accepted coachings, by coach and
+// athlete
+type fakeCoachingStore struct {
+	store.CoachingStore
+	access map[[2]int]string
+}
+
+func (f *fakeCoachingStore) GetCoachAccess(coachID, athleteID int) (string, error) {
+	return f.access[[2]int{coachID, athleteID}], nil
+}
+
+func TestAuthorizeWorkout(t *testing.T) {
+	authorizer := NewAuthorizer(
+		&fakeWorkoutStore{workouts: map[int64]fakeWorkout{
+			1: {owner: 10, visibility: store.VisibilityPrivate},
+			3: {owner: 15, visibility: store.VisibilityPrivate},
+			4: {owner: 10, visibility: store.VisibilityPublic},
+			5: {owner: 10, visibility: store.VisibilityFollowers},
+			6: {owner: 10, visibility: store.VisibilityOrg},
+			7: {owner: 10, visibility: store.VisibilityUnlisted},
+		}},
+		&fakeCoachingStore{access: map[[2]int]string{
+			{12, 10}: store.CoachAccessRead,
+			{14, 10}: store.CoachAccessReadWrite,
+			{11, 10}: store.CoachAccessReadWrite,
+		}},
+		&fakeFollowStore{follows: map[[2]int]bool{{11, 10}: true}},
+		&fakeOrganizationStore{orgs: map[int]int{10: 1, 11: 2, 12: 1}},
+	)
+
+	owner := &store.User{ID: 10, Role: store.RoleUser}
+	// other was a coach of the owner but lost the role
+	other := &store.User{ID: 11, Role: store.RoleUser}
+	coach := &store.User{ID: 12, Role: store.RoleCoach}
+	admin := &store.User{ID: 13, Role: store.RoleAdmin}
+	writingCoach := &store.User{ID: 14, Role: store.RoleCoach}
+
+	tests := []struct {
+		name       string
+		user       *store.User
+		permission Permission
+		workoutID  int64
+		want       error
+	}{
+		{name: "owner reads", user: owner, permission: ReadWorkouts, workoutID: 1},
+		{name: "owner writes", user: owner, permission: WriteWorkouts, workoutID: 1},
+		{name: "other user reads", user: other, permission: ReadWorkouts, workoutID: 1, want: ErrForbidden},
+		{name: "other user comments", user: other, permission: CommentWorkouts, workoutID: 1, want: ErrForbidden},
+		{name: "coach reads", user: coach, permission: ReadWorkouts, workoutID: 1},
+		{name: "coach comments", user: coach, permission: CommentWorkouts, workoutID: 1},
+		{name: "read coach writes", user: coach, permission: WriteWorkouts, workoutID: 1, want: ErrForbidden},
+		{name: "read_write coach writes", user: writingCoach, permission: WriteWorkouts, workoutID: 1},
+		{name: "coach reads another athlete", user: coach, permission: ReadWorkouts, workoutID: 3, want: ErrForbidden},
+		{name: "admin reads", user: admin, permission: ReadWorkouts, workoutID: 1},
+		{name: "admin writes", user: admin, permission: WriteWorkouts, workoutID: 1, want: ErrForbidden},
+		{name: "anonymous reads", user: store.AnonymousUser, permission: ReadWorkouts, workoutID: 1, want: ErrForbidden},
+		{name: "missing workout", user: admin, permission: ReadWorkouts, workoutID: 2, want: ErrNotFound},
+		{name: "anonymous reads public", user: store.AnonymousUser, permission: ReadWorkouts, workoutID: 4},
+		{name: "other user writes public", user: other, permission: WriteWorkouts, workoutID: 4, want: ErrForbidden},
+		{name: "follower reads followers", user: other, permission: ReadWorkouts, workoutID: 5},
+		{name: "follower comments followers", user: other, permission: CommentWorkouts, workoutID: 5, want: ErrForbidden},
+		{name: "admin reads followers", user: admin, permission: ReadWorkouts, workoutID: 5},
+		{name: "anonymous reads followers", user: store.AnonymousUser, permission: ReadWorkouts, workoutID: 5, want: ErrForbidden},
+		{name: "org member reads org", user: &store.User{ID: 12, Role: store.RoleUser}, permission: ReadWorkouts, workoutID: 6},
+		{name: "other org reads org", user: other, permission: ReadWorkouts, workoutID: 6, want: ErrForbidden},
+		{name: "follower reads unlisted", user: other, permission: ReadWorkouts, workoutID: 7, want: ErrForbidden},
+		{name: "owner reads unlisted", user: owner, permission: ReadWorkouts, workoutID: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.AuthorizeWorkout(tt.user, tt.permission, tt.workoutID)
+
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.want), "got %v", err)
+		})
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range store.Roles {
+		assert.True(t, ValidRole(role), role)
+	}
+
+	assert.False(t, ValidRole(""))
+	assert.False(t, ValidRole("root"))
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// fitNotesAdapter reads the export of FitNotes, one row per set:
+// Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time,Comment
+// FitNotes has no workouts, every day becomes a workout named after the categories.
+type fitNotesAdapter struct{}
+
+var fitNotesDistanceUnits = map[string]float64{
+	"m":     1,
+	"km":    1000,
+	"mi":    metersPerMile,
+	"miles": metersPerMile,
+	"ft":    0.3048,
+	"yd":    0.9144,
+	"yds":   0.9144,
+}
+
+func (fitNotesAdapter) Parse(r io.Reader, loc *time.Location) ([]*store.Workout, error) {
+	file, err := newCSVFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.require("date", "exercise", "reps")
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{}
+	categories := map[*store.Workout][]string{}
+
+	for {
+		record, err := file.next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		date := record.get("date")
+		performedAt, err := time.ParseInLocation(time.DateOnly, date, loc)
+
+		if err != nil {
+			return nil, record.errorf("invalid date %q", date)
+		}
+
+		workout := b.workout(date, func() *store.Workout {
+			return &store.Workout{PerformedAt: performedAt}
+		})
+
+		if category := record.get("category"); category != "" && !containsFold(categories[workout], category) {
+			categories[workout] = append(categories[workout], category)
+		}
+
+		set, err := fitNotesSet(record)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.addSet(workout, record.get("exercise"), set, record.get("comment"))
+	}
+
+	for workout, names := range categories {
+		workout.Title = strings.Join(names, ", ")
+	}
+
+	for _, workout := range b.workouts {
+		if workout.Title == "" {
+			workout.Title = "Workout"
+		}
+	}
+
+	return b.finish()
+}
+
+func fitNotesSet(record csvRecord) (store.WorkoutSet, error) {
+	var set store.WorkoutSet
+	var err error
+
+	set.Reps, err = record.int("reps")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.Weight, err = record.float("weight (kgs)")
+
+	if err != nil {
+		return set, err
+	}
+
+	if set.Weight == nil {
+		pounds, err := record.float("weight (lbs)")
+
+		if err != nil {
+			return set, err
+		}
+
+		if pounds != nil {
+			kilograms := round2(*pounds * kilogramsPerPound)
+			set.Weight = &kilograms
+		}
+	}
+
+	if value := record.get("time"); value != "" {
+		seconds, err := parseClock(value)
+
+		if err != nil {
+			return set, record.errorf("invalid time %q", value)
+		}
+
+		if seconds > 0 {
+			set.DurationSeconds = &seconds
+		}
+	}
+
+	distance, err := record.float("distance")
+
+	if err != nil {
+		return set, err
+	}
+
+	if distance != nil {
+		unit := strings.ToLower(record.get("distance unit"))
+		factor, ok := fitNotesDistanceUnits[unit]
+
+		if !ok {
+			return set, record.errorf("unknown distance unit %q", unit)
+		}
+
+		meters := round2(*distance * factor)
+		set.DistanceMeters = &meters
+	}
+
+	return set, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
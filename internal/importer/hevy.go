@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"io"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// hevyAdapter reads the export of Hevy, one row per set:
+// title,start_time,end_time,description,exercise_title,superset_id,exercise_notes,set_index,set_type,
+// weight_kg,reps,distance_km,duration_seconds,rpe
+type hevyAdapter struct{}
+
+var hevyDateLayouts = []string{"2 Jan 2006, 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+const (
+	kilogramsPerPound = 0.45359237
+	metersPerMile     = 1609.344
+)
+
+var hevySetTypes = map[string]string{
+	"normal":  store.SetTypeWorking,
+	"warmup":  store.SetTypeWarmup,
+	"dropset": store.SetTypeDrop,
+	"failure": store.SetTypeFailure,
+}
+
+func (hevyAdapter) Parse(r io.Reader, loc *time.Location) ([]*store.Workout, error) {
+	file, err := newCSVFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.require("title", "start_time", "exercise_title", "reps")
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{}
+
+	for {
+		record, err := file.next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		start := record.get("start_time")
+		startedAt, err := parseTimeLayouts(hevyDateLayouts, start, loc)
+
+		if err != nil {
+			return nil, record.errorf("invalid start_time %q", start)
+		}
+
+		var endedAt *time.Time
+
+		if end := record.get("end_time"); end != "" {
+			t, err := parseTimeLayouts(hevyDateLayouts, end, loc)
+
+			if err != nil {
+				return nil, record.errorf("invalid end_time %q", end)
+			}
+
+			if t.After(startedAt) {
+				endedAt = &t
+			}
+		}
+
+		workout := b.workout(start+"|"+record.get("title"), func() *store.Workout {
+			workout := &store.Workout{
+				Title:       record.get("title"),
+				Description: record.get("description"),
+				PerformedAt: startedAt,
+				StartedAt:   &startedAt,
+				EndedAt:     endedAt,
+			}
+
+			if endedAt != nil {
+				workout.DurationMinutes = int(endedAt.Sub(startedAt).Minutes())
+			}
+
+			return workout
+		})
+
+		set, err := hevySet(record)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.addSet(workout, record.get("exercise_title"), set, record.get("exercise_notes"))
+	}
+
+	return b.finish()
+}
+
+func hevySet(record csvRecord) (store.WorkoutSet, error) {
+	var set store.WorkoutSet
+	var err error
+
+	set.SetType = hevySetTypes[record.get("set_type")]
+
+	set.Reps, err = record.int("reps")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.DurationSeconds, err = record.int("duration_seconds")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.RPE, err = record.float("rpe")
+
+	if err != nil {
+		return set, err
+	}
+
+	// imperial accounts export pounds and miles instead
+	set.Weight, err = record.float("weight_kg")
+
+	if err != nil {
+		return set, err
+	}
+
+	if set.Weight == nil {
+		pounds, err := record.float("weight_lbs")
+
+		if err != nil {
+			return set, err
+		}
+
+		if pounds != nil {
+			kilograms := round2(*pounds * kilogramsPerPound)
+			set.Weight = &kilograms
+		}
+	}
+
+	distance, err := record.float("distance_km")
+
+	if err != nil {
+		return set, err
+	}
+
+	if distance != nil {
+		meters := *distance * 1000
+		set.DistanceMeters = &meters
+	}
+
+	miles, err := record.float("distance_miles")
+
+	if err != nil {
+		return set, err
+	}
+
+	if set.DistanceMeters == nil && miles != nil {
+		meters := round2(*miles * metersPerMile)
+		set.DistanceMeters = &meters
+	}
+
+	return set, nil
+}
@@ -0,0 +1,392 @@
+// Package importer reads the csv exports of other workout apps into workouts.
+// Every app gets an Adapter that knows its layout, the rows are grouped into
+// workouts, entries and sets by a shared builder.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+const (
+	SourceStrong   = "strong"
+	SourceHevy     = "hevy"
+	SourceFitNotes = "fitnotes"
+)
+
+var (
+	ErrUnknownSource = errors.New("source must be strong, hevy or fitnotes")
+	ErrNoWorkouts    = errors.New("the file has no workouts")
+)
+
+// Adapter turns the csv export of an app into workouts. Times without a zone
+// are read in loc.
+type Adapter interface {
+	Parse(r io.Reader, loc *time.Location) ([]*store.Workout, error)
+}
+
+func NewAdapter(source string) (Adapter, error) {
+	switch strings.ToLower(source) {
+	case SourceStrong:
+		return strongAdapter{}, nil
+	case SourceHevy:
+		return hevyAdapter{}, nil
+	case SourceFitNotes:
+		return fitNotesAdapter{}, nil
+	}
+
+	return nil, ErrUnknownSource
+}
+
+// WorkoutSummary describes a workout of an import, WorkoutID is set once it is created
+type WorkoutSummary struct {
+	WorkoutID   *int      `json:"workout_id"`
+	Title       string    `json:"title"`
+	PerformedAt time.Time `json:"performed_at"`
+	Entries     int       `json:"entries"`
+	Sets        int       `json:"sets"`
+	Duplicate   bool      `json:"duplicate"`
+}
+
+func Summarize(workout *store.Workout) WorkoutSummary {
+	summary := WorkoutSummary{
+		Title:       workout.Title,
+		PerformedAt: workout.PerformedAt,
+		Entries:     len(workout.Entries),
+	}
+
+	if workout.ID != 0 {
+		id := workout.ID
+		summary.WorkoutID = &id
+	}
+
+	for _, entry := range workout.Entries {
+		summary.Sets += len(entry.Sets)
+	}
+
+	return summary
+}
+
+// DuplicateKey identifies a workout, an import skips workouts of which the key already exists
+func DuplicateKey(workout *store.Workout) string {
+	return workout.PerformedAt.UTC().Format(time.RFC3339) + "|" + strings.ToLower(workout.Title)
+}
+
+// csvFile gives access to the columns of a csv export by their header name
+type csvFile struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVFile(r io.Reader) (*csvFile, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// exports made on windows start with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	// some locales export with semicolons
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return nil, ErrNoWorkouts
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	return &csvFile{reader: reader, columns: columns}, nil
+}
+
+func (f *csvFile) require(names ...string) error {
+	for _, name := range names {
+		if _, ok := f.columns[name]; !ok {
+			return fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	return nil
+}
+
+// next returns the next record and its line number, io.EOF at the end
+func (f *csvFile) next() (csvRecord, error) {
+	values, err := f.reader.Read()
+
+	if err != nil {
+		return csvRecord{}, err
+	}
+
+	line, _ := f.reader.FieldPos(0)
+
+	return csvRecord{file: f, values: values, line: line}, nil
+}
+
+type csvRecord struct {
+	file   *csvFile
+	values []string
+	line   int
+}
+
+func (r csvRecord) get(name string) string {
+	i, ok := r.file.columns[name]
+
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.values[i])
+}
+
+// float returns nil for empty and zero values, apps write 0 for "not logged"
+func (r csvRecord) float(name string) (*float64, error) {
+	value := r.get(name)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+
+	if err != nil {
+		return nil, r.errorf("invalid %s %q", name, value)
+	}
+
+	if f == 0 {
+		return nil, nil
+	}
+
+	return &f, nil
+}
+
+func (r csvRecord) int(name string) (*int, error) {
+	f, err := r.float(name)
+
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	i := int(math.Round(*f))
+
+	return &i, nil
+}
+
+func (r csvRecord) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", r.line, fmt.Sprintf(format, args...))
+}
+
+// builder groups consecutive rows into workouts and consecutive sets of the
+// same exercise into entries
+type builder struct {
+	workouts []*store.Workout
+	key      string
+}
+
+// workout returns the current workout, a different key starts a new one with newWorkout
+func (b *builder) workout(key string, newWorkout func() *store.Workout) *store.Workout {
+	if len(b.workouts) == 0 || key != b.key {
+		b.key = key
+		b.workouts = append(b.workouts, newWorkout())
+	}
+
+	return b.workouts[len(b.workouts)-1]
+}
+
+// addSet skips sets without reps, time or distance, the apps export those for
+// sets that were planned but never done
+func (b *builder) addSet(workout *store.Workout, exercise string, set store.WorkoutSet, notes string) {
+	if set.Reps == nil && set.DurationSeconds == nil && set.DistanceMeters == nil {
+		return
+	}
+
+	set.Completed = true
+
+	if set.SetType == "" {
+		set.SetType = store.SetTypeWorking
+	}
+
+	entries := workout.Entries
+
+	if len(entries) == 0 || entries[len(entries)-1].ExerciseName != exercise {
+		workout.Entries = append(workout.Entries, store.WorkoutEntry{
+			ExerciseName: exercise,
+			Kind:         store.EntryKindStrength,
+			OrderIndex:   len(entries) + 1,
+		})
+	}
+
+	entry := &workout.Entries[len(workout.Entries)-1]
+	entry.Sets = append(entry.Sets, set)
+
+	if entry.Notes == "" {
+		entry.Notes = notes
+	}
+}
+
+// finish drops the workouts without sets and marks the entries that are only
+// logged by distance and time as cardio
+func (b *builder) finish() ([]*store.Workout, error) {
+	workouts := []*store.Workout{}
+
+	for _, workout := range b.workouts {
+		if len(workout.Entries) == 0 {
+			continue
+		}
+
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+			hasReps, hasDistance := false, false
+
+			for _, set := range entry.Sets {
+				hasReps = hasReps || set.Reps != nil
+				hasDistance = hasDistance || set.DistanceMeters != nil
+			}
+
+			if hasDistance && !hasReps {
+				entry.Kind = store.EntryKindCardio
+			}
+		}
+
+		workouts = append(workouts, workout)
+	}
+
+	if len(workouts) == 0 {
+		return nil, ErrNoWorkouts
+	}
+
+	return workouts, nil
+}
+
+// ExerciseFinder looks up catalog exercises by name or alias, store.ExerciseStore implements it
+type ExerciseFinder interface {
+	FindExerciseByName(name string) (*store.Exercise, error)
+}
+
+// "Bench Press (Barbell)" style names of Strong and Hevy
+var equipmentSuffix = regexp.MustCompile(`^(.+?)\s*\(([^)]+)\)$`)
+
+// exerciseCandidates returns the names to try in the catalog, best match first
+func exerciseCandidates(name string) []string {
+	candidates := []string{name}
+
+	if mapped, ok := exerciseNames[strings.ToLower(name)]; ok {
+		candidates = append([]string{mapped}, candidates...)
+	}
+
+	if match := equipmentSuffix.FindStringSubmatch(name); match != nil {
+		exercise, equipment := match[1], match[2]
+		candidates = append(candidates, equipment+" "+exercise, exercise)
+	}
+
+	return candidates
+}
+
+// names of the apps that don't match a catalog name or alias
+var exerciseNames = map[string]string{
+	"flat barbell bench press":    "Bench Press",
+	"flat dumbbell bench press":   "Dumbbell Bench Press",
+	"bench press (dumbbell)":      "Dumbbell Bench Press",
+	"overhead press (barbell)":    "Overhead Press",
+	"shoulder press (dumbbell)":   "Dumbbell Shoulder Press",
+	"bent over row (barbell)":     "Barbell Row",
+	"bent over row (dumbbell)":    "Dumbbell Row",
+	"lat pulldown (cable)":        "Lat Pulldown",
+	"seated row (cable)":          "Seated Cable Row",
+	"bicep curl (barbell)":        "Barbell Curl",
+	"bicep curl (dumbbell)":       "Dumbbell Curl",
+	"hammer curl (dumbbell)":      "Dumbbell Curl",
+	"triceps pushdown (cable)":    "Triceps Pushdown",
+	"romanian deadlift (barbell)": "Romanian Deadlift",
+	"hip thrust (barbell)":        "Hip Thrust",
+	"running (treadmill)":         "Running",
+	"cycling (indoor)":            "Cycling",
+}
+
+// MapExercises links the entries to the catalog. Names that are not in the
+// catalog stay free text, every name is only looked up once.
+func MapExercises(finder ExerciseFinder, workouts []*store.Workout) error {
+	found := map[string]*store.Exercise{}
+
+	for _, workout := range workouts {
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+			key := strings.ToLower(entry.ExerciseName)
+
+			exercise, ok := found[key]
+
+			if !ok {
+				for _, candidate := range exerciseCandidates(entry.ExerciseName) {
+					var err error
+
+					exercise, err = finder.FindExerciseByName(candidate)
+
+					if err != nil {
+						return err
+					}
+
+					if exercise != nil {
+						break
+					}
+				}
+
+				found[key] = exercise
+			}
+
+			if exercise != nil {
+				entry.ExerciseID = &exercise.ID
+				entry.ExerciseName = exercise.Name
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseClock parses durations like 1:02:03 and 02:03 into seconds
+func parseClock(value string) (int, error) {
+	seconds := 0
+
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.Atoi(part)
+
+		if err != nil {
+			return 0, err
+		}
+
+		seconds = seconds*60 + n
+	}
+
+	return seconds, nil
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
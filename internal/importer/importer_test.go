@@ -0,0 +1,201 @@
+package importer
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFixture(t *testing.T, source string) []*store.Workout {
+	adapter, err := NewAdapter(source)
+	require.NoError(t, err)
+
+	file, err := os.Open("testdata/" + source + ".csv")
+	require.NoError(t, err)
+	defer file.Close()
+
+	workouts, err := adapter.Parse(file, time.UTC)
+	require.NoError(t, err)
+
+	return workouts
+}
+
+func entryNames(workout *store.Workout) []string {
+	names := []string{}
+
+	for _, entry := range workout.Entries {
+		names = append(names, entry.ExerciseName)
+	}
+
+	return names
+}
+
+func TestStrongAdapter(t *testing.T) {
+	workouts := parseFixture(t, SourceStrong)
+
+	require.Len(t, workouts, 2)
+
+	push := workouts[0]
+	assert.Equal(t, "Push Day", push.Title)
+	assert.Equal(t, "Felt strong", push.Description)
+	assert.Equal(t, 65, push.DurationMinutes)
+	assert.Equal(t, time.Date(2024, 3, 4, 18, 2, 11, 0, time.UTC), push.PerformedAt)
+	assert.Equal(t, []string{"Bench Press (Barbell)", "Plank", "Cable Fly"}, entryNames(push))
+
+	bench := push.Entries[0]
+	require.Len(t, bench.Sets, 3)
+	assert.Equal(t, store.SetTypeWarmup, bench.Sets[0].SetType)
+	assert.Equal(t, 82.5, *bench.Sets[2].Weight)
+	assert.Equal(t, 9.0, *bench.Sets[2].RPE)
+	assert.Equal(t, "Paused reps", bench.Notes)
+
+	assert.Equal(t, 60, *push.Entries[1].Sets[0].DurationSeconds)
+
+	// the set without reps is skipped
+	assert.Len(t, push.Entries[2].Sets, 1)
+
+	run := workouts[1].Entries[0]
+	assert.Equal(t, store.EntryKindCardio, run.Kind)
+	assert.Equal(t, 5200.0, *run.Sets[0].DistanceMeters)
+	assert.Equal(t, 1920, *run.Sets[0].DurationSeconds)
+}
+
+func TestHevyAdapter(t *testing.T) {
+	workouts := parseFixture(t, SourceHevy)
+
+	require.Len(t, workouts, 2)
+
+	legs := workouts[0]
+	assert.Equal(t, "Legs", legs.Title)
+	assert.Equal(t, 71, legs.DurationMinutes)
+	require.NotNil(t, legs.EndedAt)
+	assert.Equal(t, []string{"Squat (Barbell)", "Leg Extension (Machine)", "Walking"}, entryNames(legs))
+
+	squat := legs.Entries[0]
+	require.Len(t, squat.Sets, 3)
+	assert.Equal(t, store.SetTypeWarmup, squat.Sets[0].SetType)
+	assert.Equal(t, store.SetTypeWorking, squat.Sets[1].SetType)
+	assert.Equal(t, 8.5, *squat.Sets[1].RPE)
+	assert.Equal(t, "Low bar", squat.Notes)
+
+	assert.Equal(t, store.SetTypeDrop, legs.Entries[1].Sets[0].SetType)
+
+	walk := legs.Entries[2]
+	assert.Equal(t, store.EntryKindCardio, walk.Kind)
+	assert.Equal(t, 2500.0, *walk.Sets[0].DistanceMeters)
+
+	pull := workouts[1]
+	assert.Equal(t, "Short one", pull.Description)
+	assert.Nil(t, pull.Entries[0].Sets[0].Weight)
+	assert.Equal(t, store.SetTypeFailure, pull.Entries[0].Sets[1].SetType)
+}
+
+func TestFitNotesAdapter(t *testing.T) {
+	workouts := parseFixture(t, SourceFitNotes)
+
+	require.Len(t, workouts, 2)
+
+	first := workouts[0]
+	assert.Equal(t, "Chest, Back, Abs", first.Title)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), first.PerformedAt)
+	assert.Equal(t, []string{"Flat Barbell Bench Press", "Deadlift", "Plank"}, entryNames(first))
+	assert.Len(t, first.Entries[0].Sets, 2)
+	assert.Equal(t, "Elbows tucked", first.Entries[0].Notes)
+	assert.Equal(t, 90, *first.Entries[2].Sets[0].DurationSeconds)
+
+	cardio := workouts[1]
+	assert.Equal(t, "Cardio", cardio.Title)
+	assert.Equal(t, 2000.0, *cardio.Entries[0].Sets[0].DistanceMeters)
+	assert.Equal(t, 490, *cardio.Entries[0].Sets[0].DurationSeconds)
+	assert.Equal(t, 12500.0, *cardio.Entries[1].Sets[0].DistanceMeters)
+	assert.Equal(t, store.EntryKindCardio, cardio.Entries[1].Kind)
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		csv    string
+		want   string
+	}{
+		{name: "missing column", source: SourceStrong, csv: "Date,Exercise Name\n", want: `missing column "workout name"`},
+		{name: "invalid date", source: SourceStrong, csv: "Date,Workout Name,Exercise Name,Weight,Reps\n2024-03-04 18:00:00,A,Squat,100,5\nyesterday,A,Squat,100,5\n", want: `line 3: invalid date "yesterday"`},
+		{name: "invalid weight", source: SourceHevy, csv: "title,start_time,exercise_title,weight_kg,reps\nA,\"12 Mar 2024, 17:30\",Squat,heavy,5\n", want: `line 2: invalid weight_kg "heavy"`},
+		{name: "unknown distance unit", source: SourceFitNotes, csv: "Date,Exercise,Reps,Distance,Distance Unit\n2024-02-01,Run,,5,parsecs\n", want: `unknown distance unit "parsecs"`},
+		{name: "empty file", source: SourceFitNotes, csv: "", want: ErrNoWorkouts.Error()},
+		{name: "only empty sets", source: SourceFitNotes, csv: "Date,Exercise,Reps\n2024-02-01,Squat,0\n", want: ErrNoWorkouts.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := NewAdapter(tt.source)
+			require.NoError(t, err)
+
+			_, err = adapter.Parse(strings.NewReader(tt.csv), time.UTC)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	_, err := NewAdapter("myfitnesspal")
+	assert.ErrorIs(t, err, ErrUnknownSource)
+}
+
+func TestSemicolonDelimiter(t *testing.T) {
+	adapter, err := NewAdapter(SourceFitNotes)
+	require.NoError(t, err)
+
+	workouts, err := adapter.Parse(strings.NewReader("\xef\xbb\xbfDate;Exercise;Category;Weight (kgs);Reps\n2024-02-01;Deadlift;Back;140,5;5\n"), time.UTC)
+
+	require.NoError(t, err)
+	require.Len(t, workouts, 1)
+	assert.Equal(t, 140.5, *workouts[0].Entries[0].Sets[0].Weight)
+}
+
+type fakeFinder map[string]string
+
+func (f fakeFinder) FindExerciseByName(name string) (*store.Exercise, error) {
+	canonical, ok := f[strings.ToLower(name)]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &store.Exercise{ID: len(canonical), Name: canonical}, nil
+}
+
+func TestMapExercises(t *testing.T) {
+	finder := fakeFinder{
+		"barbell squat":     "Back Squat",
+		"bench press":       "Bench Press",
+		"leg extension":     "Leg Extension",
+		"running":           "Running",
+		"pull up":           "Pull-up",
+		"lat pulldown":      "Lat Pulldown",
+		"romanian deadlift": "Romanian Deadlift",
+	}
+
+	workouts := []*store.Workout{
+		{Entries: []store.WorkoutEntry{
+			{ExerciseName: "Squat (Barbell)"},
+			{ExerciseName: "Leg Extension (Machine)"},
+			{ExerciseName: "Flat Barbell Bench Press"},
+			{ExerciseName: "Running (Treadmill)"},
+			{ExerciseName: "Pull Up"},
+			{ExerciseName: "Cable Fly"},
+		}},
+	}
+
+	err := MapExercises(finder, workouts)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Back Squat", "Leg Extension", "Bench Press", "Running", "Pull-up", "Cable Fly"}, entryNames(workouts[0]))
+	assert.NotNil(t, workouts[0].Entries[0].ExerciseID)
+	assert.Nil(t, workouts[0].Entries[5].ExerciseID)
+}
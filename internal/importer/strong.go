@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// strongAdapter reads the export of Strong, one row per set:
+// Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE
+type strongAdapter struct{}
+
+var strongDateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// durations are written like "1h 5m" or "45m"
+var strongDurationPart = regexp.MustCompile(`(\d+)\s*([hms])`)
+
+func (strongAdapter) Parse(r io.Reader, loc *time.Location) ([]*store.Workout, error) {
+	file, err := newCSVFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.require("date", "workout name", "exercise name", "weight", "reps")
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{}
+
+	for {
+		record, err := file.next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		date := record.get("date")
+		performedAt, err := parseTimeLayouts(strongDateLayouts, date, loc)
+
+		if err != nil {
+			return nil, record.errorf("invalid date %q", date)
+		}
+
+		workout := b.workout(date+"|"+record.get("workout name"), func() *store.Workout {
+			return &store.Workout{
+				Title:           record.get("workout name"),
+				Description:     record.get("workout notes"),
+				DurationMinutes: parseStrongDuration(record.get("duration")),
+				PerformedAt:     performedAt,
+			}
+		})
+
+		set, err := strongSet(record)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.addSet(workout, record.get("exercise name"), set, record.get("notes"))
+	}
+
+	return b.finish()
+}
+
+func strongSet(record csvRecord) (store.WorkoutSet, error) {
+	var set store.WorkoutSet
+	var err error
+
+	switch strings.ToUpper(record.get("set order")) {
+	case "W":
+		set.SetType = store.SetTypeWarmup
+	case "D":
+		set.SetType = store.SetTypeDrop
+	case "F":
+		set.SetType = store.SetTypeFailure
+	}
+
+	set.Weight, err = record.float("weight")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.Reps, err = record.int("reps")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.DurationSeconds, err = record.int("seconds")
+
+	if err != nil {
+		return set, err
+	}
+
+	set.RPE, err = record.float("rpe")
+
+	if err != nil {
+		return set, err
+	}
+
+	// the distance is in kilometers for metric users
+	distance, err := record.float("distance")
+
+	if err != nil {
+		return set, err
+	}
+
+	if distance != nil {
+		meters := *distance * 1000
+		set.DistanceMeters = &meters
+	}
+
+	return set, nil
+}
+
+func parseStrongDuration(value string) int {
+	seconds := 0
+
+	for _, part := range strongDurationPart.FindAllStringSubmatch(value, -1) {
+		n, _ := strconv.Atoi(part[1])
+
+		switch part[2] {
+		case "h":
+			seconds += n * 3600
+		case "m":
+			seconds += n * 60
+		case "s":
+			seconds += n
+		}
+	}
+
+	return seconds / 60
+}
+
+func parseTimeLayouts(layouts []string, value string, loc *time.Location) (time.Time, error) {
+	var err error
+
+	for _, layout := range layouts {
+		var t time.Time
+
+		t, err = time.ParseInLocation(layout, value, loc)
+
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users. There is no SMTP implementation yet, the
+// log and file mailers are meant for running the api locally.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes every message to the logger
+type LogMailer struct {
+	logger *log.Logger
+}
+
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	return &LogMailer{
+		logger: logger,
+	}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.logger.Printf("MAIL: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message as a separate .eml file into a directory
+type FileMailer struct {
+	dir string
+	now func() time.Time
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+
+	if err != nil {
+		return nil, fmt.Errorf("mailer: %w", err)
+	}
+
+	return &FileMailer{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+var (
+	unsafeFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+	// a line break in a header value would start a new header
+	headerLineBreaks = strings.NewReplacer("\r", "", "\n", "")
+)
+
+func (m *FileMailer) Send(msg Message) error {
+	now := m.now()
+	filename := fmt.Sprintf("%d-%s.eml", now.UnixNano(), unsafeFilenameChars.ReplaceAllString(msg.To, "_"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", headerLineBreaks.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerLineBreaks.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	err := os.WriteFile(filepath.Join(m.dir, filename), []byte(b.String()), 0o600)
+
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+
+	return nil
+}
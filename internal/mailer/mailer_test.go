@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	mailer, err := NewFileMailer(dir)
+	require.NoError(t, err)
+
+	mailer.now = func() time.Time {
+		return time.Date(2024, 3, 4, 10, 30, 0, 0, time.UTC)
+	}
+
+	err = mailer.Send(Message{
+		To:      "john doe/../x@example.com",
+		Subject: "Reset your password",
+		Body:    "your token is ABC",
+	})
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// the recipient can't escape the mail directory
+	assert.Equal(t, "1709548200000000000-john_doe_.._x@example.com.eml", files[0].Name())
+
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+
+	assert.Contains(t, string(content), "To: john doe/../x@example.com\r\n")
+	assert.Contains(t, string(content), "Subject: Reset your password\r\n")
+	assert.Contains(t, string(content), "Date: Mon, 04 Mar 2024 10:30:00 +0000\r\n")
+	assert.True(t, bytes.HasSuffix(content, []byte("\r\n\r\nyour token is ABC")))
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := NewLogMailer(log.New(&buf, "", 0)).Send(Message{To: "jane@example.com", Subject: "Hi", Body: "hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "MAIL: to=jane@example.com subject=\"Hi\"\nhello\n", buf.String())
+}
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/edwinboon/workout-tracking-api/internal/store"
 	"github.com/edwinboon/workout-tracking-api/internal/tokens"
@@ -11,12 +14,23 @@ import (
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore   store.UserStore
+	TokenStore  store.TokenStore
+	APIKeyStore store.APIKeyStore
+	// JWTKeySet is nil unless JWT access tokens are enabled
+	JWTKeySet *tokens.KeySet
+	DenyList  *tokens.DenyList
+	Logger    *log.Logger
 }
 
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey   = contextKey("user")
+	TokenContextKey  = contextKey("token")
+	APIKeyContextKey = contextKey("apiKey")
+	ClaimsContextKey = contextKey("claims")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -34,6 +48,27 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// GetToken returns the plaintext token the request was authenticated with, it
+// is empty for anonymous requests
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
+// GetAPIKey returns the api key the request was authenticated with, it is nil
+// for requests with a login token
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key
+}
+
+// GetClaims returns the claims of the JWT the request was authenticated with,
+// it is nil for the other kinds of tokens
+func GetClaims(r *http.Request) *tokens.Claims {
+	claims, _ := r.Context().Value(ClaimsContextKey).(*tokens.Claims)
+	return claims
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// inside this function we can interject any incomming request to our server
@@ -55,6 +90,17 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		token := headerParts[1]
+
+		if tokens.IsAPIKey(token) {
+			um.authenticateAPIKey(w, r, token, next)
+			return
+		}
+
+		if um.JWTKeySet != nil && tokens.IsJWT(token) {
+			um.authenticateJWT(w, r, token, next)
+			return
+		}
+
 		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
 
 		if err != nil {
@@ -67,12 +113,73 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// the last use is only informational, a failed update shouldn't fail the request
+		err = um.TokenStore.TouchToken(token)
+
+		if err != nil {
+			um.Logger.Printf("ERROR: touchToken: %v", err)
+		}
+
 		r = SetUser(r, user)
+		r = r.WithContext(context.WithValue(r.Context(), TokenContextKey, token))
 		next.ServeHTTP(w, r)
 		return
 	})
 }
 
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, plaintext string, next http.Handler) {
+	user, key, err := um.APIKeyStore.GetAPIKeyUser(plaintext)
+
+	if err != nil {
+		um.Logger.Printf("ERROR: getAPIKeyUser: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid api key"})
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "api key expired or invalid"})
+		return
+	}
+
+	err = um.APIKeyStore.TouchAPIKey(key.ID)
+
+	if err != nil {
+		um.Logger.Printf("ERROR: touchAPIKey: %v", err)
+	}
+
+	r = SetUser(r, user)
+	r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key))
+	next.ServeHTTP(w, r)
+}
+
+// authenticateJWT trusts the claims of a valid JWT, the user isn't looked up
+func (um *UserMiddleware) authenticateJWT(w http.ResponseWriter, r *http.Request, token string, next http.Handler) {
+	claims, err := um.JWTKeySet.Verify(token, time.Now())
+
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+		return
+	}
+
+	if um.DenyList.Denied(claims) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token has been revoked"})
+		return
+	}
+
+	user := &store.User{
+		ID:        claims.UserID,
+		Username:  claims.Username,
+		Email:     claims.Email,
+		Activated: claims.Activated,
+		Role:      claims.Role,
+	}
+
+	r = SetUser(r, user)
+	r = r.WithContext(context.WithValue(r.Context(), TokenContextKey, token))
+	r = r.WithContext(context.WithValue(r.Context(), ClaimsContextKey, claims))
+	next.ServeHTTP(w, r)
+}
+
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
@@ -84,3 +191,89 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireActivatedUser is RequireUser for routes that change data, users have
+// to verify their email before they can use them
+func (um *UserMiddleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if !GetUser(r).Activated {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you must verify your email to access this route"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope refuses api keys and JWTs without the scope, opaque login tokens
+// are allowed everything. It doesn't require a user, combine it with RequireUser for that.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := GetAPIKey(r)
+
+		if key != nil && !key.HasScope(scope) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("this api key is missing the %s scope", scope)})
+			return
+		}
+
+		claims := GetClaims(r)
+
+		if claims != nil && !claims.HasScope(scope) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("this token is missing the %s scope", scope)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession is RequireUser for the routes that manage the account itself,
+// like api keys and passwords, they can't be used with an api key
+func (um *UserMiddleware) RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIKey(r) != nil {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api keys can't access this route, log in instead"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole is RequireUser for routes of a role, admins pass every role
+func (um *UserMiddleware) RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return um.RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if user.Role != role && user.Role != store.RoleAdmin {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": fmt.Sprintf("you must be a %s to access this route", role)})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LoadUser replaces the user of a JWT, which only has what the claims say, by
+// the full user for the routes that need all of it
+func (um *UserMiddleware) LoadUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := GetClaims(r)
+
+		if claims == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := um.UserStore.GetUserByID(claims.UserID)
+
+		if err != nil {
+			um.Logger.Printf("ERROR: getUserByID: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+
+		if user == nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+			return
+		}
+
+		next.ServeHTTP(w, SetUser(r, user))
+	})
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireScope(t *testing.T) {
+	um := &UserMiddleware{}
+	user := &store.User{ID: 1, Activated: true}
+
+	tests := []struct {
+		name       string
+		key        *store.APIKey
+		wantStatus int
+	}{
+		{name: "login", wantStatus: http.StatusOK},
+		{name: "key with scope", key: &store.APIKey{Scopes: []string{store.ScopeWorkoutsRead}}, wantStatus: http.StatusOK},
+		{name: "key without scope", key: &store.APIKey{Scopes: []string{store.ScopeProfileRead}}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := SetUser(httptest.NewRequest("GET", "/workouts", nil), user)
+
+			if tt.key != nil {
+				r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, tt.key))
+			}
+
+			rec := httptest.NewRecorder()
+			um.RequireScope(store.ScopeWorkoutsRead, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})(rec, r)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	um := &UserMiddleware{}
+	handler := um.RequireSession(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, SetUser(httptest.NewRequest("GET", "/users/me/api-keys", nil), store.AnonymousUser))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	r := SetUser(httptest.NewRequest("GET", "/users/me/api-keys", nil), &store.User{ID: 1})
+	rec = httptest.NewRecorder()
+	handler(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, &store.APIKey{Scopes: store.APIKeyScopes}))
+	rec = httptest.NewRecorder()
+	handler(rec, r)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	seed, err := tokens.GenerateEdDSASeed()
+	require.NoError(t, err)
+
+	keySet, err := tokens.NewEdDSAKeySet([][]byte{seed})
+	require.NoError(t, err)
+
+	// without stores, a JWT must be handled without the database
+	um := &UserMiddleware{JWTKeySet: keySet, DenyList: tokens.NewDenyList()}
+
+	sign := func(expiresAt time.Time) string {
+		token, err := keySet.Sign(&tokens.Claims{
+			UserID:    7,
+			Username:  "johndoe",
+			Activated: true,
+			Role:      store.RoleAdmin,
+			Scopes:    []string{store.ScopeWorkoutsRead},
+			FamilyID:  "family",
+			IssuedAt:  time.Now(),
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	var gotUser *store.User
+	handler := um.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = GetUser(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(token string) int {
+		r := httptest.NewRequest("GET", "/workouts", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(sign(time.Now().Add(time.Minute))))
+	assert.Equal(t, 7, gotUser.ID)
+	assert.Equal(t, "johndoe", gotUser.Username)
+	assert.True(t, gotUser.Activated)
+	assert.Equal(t, store.RoleAdmin, gotUser.Role)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(sign(time.Now().Add(-time.Hour))))
+
+	um.DenyList.Add(tokens.Revocation{FamilyID: "family", Expiry: time.Now().Add(time.Hour)})
+	assert.Equal(t, http.StatusUnauthorized, serve(sign(time.Now().Add(time.Minute))))
+}
+
+func TestRequireRole(t *testing.T) {
+	um := &UserMiddleware{}
+	handler := um.RequireRole(store.RoleCoach, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		user       *store.User
+		wantStatus int
+	}{
+		{name: "anonymous", user: store.AnonymousUser, wantStatus: http.StatusUnauthorized},
+		{name: "user", user: &store.User{ID: 1, Role: store.RoleUser}, wantStatus: http.StatusForbidden},
+		{name: "coach", user: &store.User{ID: 1, Role: store.RoleCoach}, wantStatus: http.StatusOK},
+		{name: "admin", user: &store.User{ID: 1, Role: store.RoleAdmin}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, SetUser(httptest.NewRequest("GET", "/coach", nil), tt.user))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestRequireActivatedUser(t *testing.T) {
+	um := &UserMiddleware{}
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		handler    http.HandlerFunc
+		user       *store.User
+		wantStatus int
+	}{
+		{name: "anonymous write", method: "POST", handler: um.RequireActivatedUser(ok), user: store.AnonymousUser, wantStatus: http.StatusUnauthorized},
+		{name: "unactivated write", method: "POST", handler: um.RequireActivatedUser(ok), user: &store.User{ID: 1}, wantStatus: http.StatusForbidden},
+		{name: "activated write", method: "POST", handler: um.RequireActivatedUser(ok), user: &store.User{ID: 1, Activated: true}, wantStatus: http.StatusOK},
+		{name: "unactivated read", method: "GET", handler: um.RequireUser(ok), user: &store.User{ID: 1}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, SetUser(httptest.NewRequest(tt.method, "/workouts", nil), tt.user))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/edwinboon/workout-tracking-api/internal/app"
+	"github.com/edwinboon/workout-tracking-api/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -11,19 +12,125 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
 
-		r.Get("/workouts/{id}", app.WorkoutHandler.HandleGetWorkoutByID)
+		r.Get("/workouts", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkouts)))
 
-		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
+		r.Get("/workouts/{id}", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.WorkoutHandler.HandleGetWorkoutByID))
 
-		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
+		r.Post("/workouts", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkout)))
 
-		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutByID))
+		r.Post("/workouts/import", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.ImportHandler.HandleImportWorkout)))
+		r.Post("/workouts/import/csv", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.ImportHandler.HandleImportCSV)))
+
+		r.Put("/workouts/{id}", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleUpdateWorkoutByID)))
+
+		r.Delete("/workouts/{id}", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleDeleteWorkoutByID)))
+
+		r.Post("/workouts/{id}/share", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.ShareHandler.HandleCreateShare)))
+		r.Get("/workouts/{id}/shares", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.ShareHandler.HandleListShares)))
+		r.Delete("/workouts/{id}/shares/{shareID}", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.ShareHandler.HandleDeleteShare)))
+
+		r.Get("/workouts/{id}/comments", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.CommentHandler.HandleListComments)))
+		r.Post("/workouts/{id}/entries/{entryID}/comments", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.CommentHandler.HandleCreateComment)))
+		r.Delete("/workouts/{id}/comments/{commentID}", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.CommentHandler.HandleDeleteComment)))
+
+		r.Delete("/auth/token", app.Middleware.RequireSession(app.TokenHandler.HandleRevokeToken))
+		r.Delete("/auth/tokens", app.Middleware.RequireSession(app.TokenHandler.HandleRevokeAllTokens))
+		r.Get("/auth/sessions", app.Middleware.RequireSession(app.TokenHandler.HandleListSessions))
+
+		r.Get("/users/me", app.Middleware.RequireScope(store.ScopeProfileRead, app.Middleware.RequireUser(app.Middleware.LoadUser(app.UserHandler.HandleGetCurrentUser))))
+		r.Patch("/users/me", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireUser(app.Middleware.LoadUser(app.UserHandler.HandleUpdateCurrentUser))))
+		r.Put("/users/me/password", app.Middleware.RequireSession(app.Middleware.LoadUser(app.PasswordHandler.HandleChangePassword)))
+		r.Post("/users/activate/resend", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireUser(app.Middleware.LoadUser(app.UserHandler.HandleResendActivation))))
+		r.Get("/users/{username}", app.UserHandler.HandleGetUserProfile)
+		r.Get("/users/{username}/workouts", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.FollowHandler.HandleListUserWorkouts))
+		r.Post("/users/{username}/follow", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireActivatedUser(app.FollowHandler.HandleFollow)))
+		r.Delete("/users/{username}/follow", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireUser(app.FollowHandler.HandleUnfollow)))
+		r.Get("/users/me/followers", app.Middleware.RequireScope(store.ScopeProfileRead, app.Middleware.RequireUser(app.FollowHandler.HandleListFollowers)))
+		r.Post("/users/me/followers/{id}/accept", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireUser(app.FollowHandler.HandleAcceptFollower)))
+		r.Delete("/users/me/followers/{id}", app.Middleware.RequireScope(store.ScopeProfileWrite, app.Middleware.RequireUser(app.FollowHandler.HandleRemoveFollower)))
+
+		r.Get("/users/me/api-keys", app.Middleware.RequireSession(app.APIKeyHandler.HandleListAPIKeys))
+		r.Post("/users/me/api-keys", app.Middleware.RequireSession(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Get("/users/me/api-keys/{id}", app.Middleware.RequireSession(app.APIKeyHandler.HandleGetAPIKey))
+		r.Patch("/users/me/api-keys/{id}", app.Middleware.RequireSession(app.APIKeyHandler.HandleUpdateAPIKey))
+		r.Delete("/users/me/api-keys/{id}", app.Middleware.RequireSession(app.APIKeyHandler.HandleDeleteAPIKey))
+
+		r.Get("/users/me/mfa", app.Middleware.RequireSession(app.MFAHandler.HandleGetMFA))
+		r.Post("/users/me/mfa/totp", app.Middleware.RequireSession(app.MFAHandler.HandleEnrollTOTP))
+		r.Post("/users/me/mfa/totp/confirm", app.Middleware.RequireSession(app.MFAHandler.HandleConfirmTOTP))
+		r.Delete("/users/me/mfa/totp", app.Middleware.RequireSession(app.Middleware.LoadUser(app.MFAHandler.HandleDisableTOTP)))
+		r.Post("/users/me/mfa/recovery-codes", app.Middleware.RequireSession(app.MFAHandler.HandleRegenerateRecoveryCodes))
+
+		r.Get("/users/me/coaches", app.Middleware.RequireSession(app.CoachingHandler.HandleListCoaches))
+		r.Post("/users/me/coaches", app.Middleware.RequireSession(app.Middleware.RequireActivatedUser(app.CoachingHandler.HandleInviteCoach)))
+		r.Patch("/users/me/coaches/{id}", app.Middleware.RequireSession(app.CoachingHandler.HandleUpdateCoach))
+		r.Delete("/users/me/coaches/{id}", app.Middleware.RequireSession(app.CoachingHandler.HandleRemoveCoach))
+
+		r.Get("/coach/athletes", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleCoach, app.CoachingHandler.HandleListAthletes)))
+		r.Post("/coach/athletes/{id}/accept", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleCoach, app.CoachingHandler.HandleAcceptAthlete)))
+		r.Delete("/coach/athletes/{id}", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleCoach, app.CoachingHandler.HandleRemoveAthlete)))
+		r.Get("/coach/athletes/{id}/workouts", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireRole(store.RoleCoach, app.WorkoutHandler.HandleListAthleteWorkouts)))
+		r.Post("/coach/athletes/{id}/workouts", app.Middleware.RequireScope(store.ScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.Middleware.RequireRole(store.RoleCoach, app.WorkoutHandler.HandleCreateAthleteWorkout))))
+
+		r.Get("/organizations", app.Middleware.RequireSession(app.OrganizationHandler.HandleListOrganizations))
+		r.Post("/organizations", app.Middleware.RequireSession(app.Middleware.RequireActivatedUser(app.OrganizationHandler.HandleCreateOrganization)))
+		r.Get("/organizations/{id}", app.Middleware.RequireSession(app.OrganizationHandler.HandleGetOrganization))
+		r.Patch("/organizations/{id}", app.Middleware.RequireSession(app.OrganizationHandler.HandleUpdateOrganization))
+		r.Delete("/organizations/{id}", app.Middleware.RequireSession(app.OrganizationHandler.HandleDeleteOrganization))
+		r.Get("/organizations/{id}/members", app.Middleware.RequireSession(app.OrganizationHandler.HandleListMembers))
+		r.Post("/organizations/{id}/members", app.Middleware.RequireSession(app.OrganizationHandler.HandleAddMember))
+		r.Post("/organizations/{id}/accept", app.Middleware.RequireSession(app.OrganizationHandler.HandleAcceptInvitation))
+		r.Patch("/organizations/{id}/members/{userID}", app.Middleware.RequireSession(app.OrganizationHandler.HandleUpdateMember))
+		r.Delete("/organizations/{id}/members/{userID}", app.Middleware.RequireSession(app.OrganizationHandler.HandleRemoveMember))
+		r.Get("/organizations/{id}/leaderboard", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.OrganizationHandler.HandleGetLeaderboard)))
+		r.Get("/organizations/{id}/attendance", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.OrganizationHandler.HandleGetAttendance)))
+		r.Get("/organizations/{id}/feed", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.OrganizationHandler.HandleGetFeed)))
+
+		r.Get("/users/me/records", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.PersonalRecordHandler.HandleGetRecords)))
+		r.Get("/users/me/records/{exercise}/history", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.PersonalRecordHandler.HandleGetRecordHistory)))
+
+		r.Get("/users/me/stats", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.StatsHandler.HandleGetStats)))
+
+		r.Get("/users/me/export", app.Middleware.RequireScope(store.ScopeWorkoutsRead, app.Middleware.RequireUser(app.ExportHandler.HandleExport)))
+
+		r.Get("/templates", app.Middleware.RequireScope(store.ScopeTemplatesRead, app.Middleware.RequireUser(app.TemplateHandler.HandleListTemplates)))
+		r.Post("/templates", app.Middleware.RequireScope(store.ScopeTemplatesWrite, app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleCreateTemplate)))
+		r.Get("/templates/{id}", app.Middleware.RequireScope(store.ScopeTemplatesRead, app.Middleware.RequireUser(app.TemplateHandler.HandleGetTemplateByID)))
+		r.Put("/templates/{id}", app.Middleware.RequireScope(store.ScopeTemplatesWrite, app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleUpdateTemplateByID)))
+		r.Delete("/templates/{id}", app.Middleware.RequireScope(store.ScopeTemplatesWrite, app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleDeleteTemplateByID)))
+		r.Post("/templates/{id}/instantiate", app.Middleware.RequireScope(store.ScopeTemplatesWrite, app.Middleware.RequireActivatedUser(app.TemplateHandler.HandleInstantiateTemplate)))
+
+		r.Get("/programs", app.Middleware.RequireScope(store.ScopeProgramsRead, app.Middleware.RequireUser(app.ProgramHandler.HandleListPrograms)))
+		r.Post("/programs", app.Middleware.RequireScope(store.ScopeProgramsWrite, app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleCreateProgram)))
+		r.Get("/programs/{id}", app.Middleware.RequireScope(store.ScopeProgramsRead, app.Middleware.RequireUser(app.ProgramHandler.HandleGetProgramByID)))
+		r.Delete("/programs/{id}", app.Middleware.RequireScope(store.ScopeProgramsWrite, app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleDeleteProgramByID)))
+		r.Post("/programs/{id}/enroll", app.Middleware.RequireScope(store.ScopeProgramsWrite, app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleEnroll)))
+		r.Delete("/programs/{id}/enroll", app.Middleware.RequireScope(store.ScopeProgramsWrite, app.Middleware.RequireActivatedUser(app.ProgramHandler.HandleUnenroll)))
+		r.Get("/users/me/schedule", app.Middleware.RequireScope(store.ScopeProgramsRead, app.Middleware.RequireUser(app.ProgramHandler.HandleGetSchedule)))
+
+		r.Get("/admin/users", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleListUsers)))
+		r.Get("/admin/users/{id}", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleGetUser)))
+		r.Put("/admin/users/{id}/role", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleSetRole)))
+		r.Post("/admin/users/{id}/disable", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleDisableUser)))
+		r.Post("/admin/users/{id}/enable", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleEnableUser)))
+		r.Delete("/admin/users/{id}/tokens", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.AdminHandler.HandleRevokeTokens)))
+		r.Get("/admin/workouts/{id}", app.Middleware.RequireSession(app.Middleware.RequireRole(store.RoleAdmin, app.WorkoutHandler.HandleGetWorkoutByID)))
 	})
 
 	r.Get("/health", app.HealthCheck)
 
+	r.Get("/exercises", app.ExerciseHandler.HandleListExercises)
+
+	r.Get("/shared/{token}", app.ShareHandler.HandleGetSharedWorkout)
+
 	r.Post("/users", app.UserHandler.HandleRegisterUser)
+	r.Put("/users/activate", app.UserHandler.HandleActivateUser)
 	r.Post("/auth/token", app.TokenHandler.HandleCreateToken)
+	r.Post("/auth/token/mfa", app.TokenHandler.HandleCreateTokenMFA)
+	r.Post("/auth/refresh", app.TokenHandler.HandleRefreshToken)
+	r.Get("/.well-known/jwks.json", app.TokenHandler.HandleJWKS)
+	r.Post("/auth/password-reset", app.PasswordHandler.HandleRequestPasswordReset)
+	r.Put("/auth/password-reset", app.PasswordHandler.HandleResetPassword)
 
 	return r
 
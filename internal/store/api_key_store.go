@@ -0,0 +1,255 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/jackc/pgtype"
+)
+
+// the permissions an api key can be given, a logged in user has all of them
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeWorkoutsRead   = "workouts:read"
+	ScopeWorkoutsWrite  = "workouts:write"
+	ScopeTemplatesRead  = "templates:read"
+	ScopeTemplatesWrite = "templates:write"
+	ScopeProgramsRead   = "programs:read"
+	ScopeProgramsWrite  = "programs:write"
+)
+
+var APIKeyScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeWorkoutsRead,
+	ScopeWorkoutsWrite,
+	ScopeTemplatesRead,
+	ScopeTemplatesWrite,
+	ScopeProgramsRead,
+	ScopeProgramsWrite,
+}
+
+// the length of the start of a key that is kept to recognize it by
+const apiKeyPrefixLength = 10
+
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID int    `json:"-"`
+	Name   string `json:"name"`
+	// Key is only filled in right after creating the key
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{
+		db: db,
+	}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(*APIKey) error
+	GetAPIKeyByID(id int64) (*APIKey, error)
+	ListAPIKeys(userID int) ([]*APIKey, error)
+	UpdateAPIKey(*APIKey) error
+	DeleteAPIKey(id int64) error
+	GetAPIKeyUser(plaintext string) (*User, *APIKey, error)
+	TouchAPIKey(id int64) error
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, scopes, expiry, last_used_at, created_at, updated_at`
+
+func scanAPIKey(row rowScanner, dest ...interface{}) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes pgtype.TextArray
+
+	dest = append([]interface{}{
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	}, dest...)
+
+	err := row.Scan(dest...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = scopes.AssignTo(&key.Scopes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// CreateAPIKey generates the key, it is returned once in Key and only its hash
+// is stored
+func (pg *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) error {
+	plaintext, err := tokens.GenerateAPIKey()
+
+	if err != nil {
+		return err
+	}
+
+	key.Key = plaintext
+	key.Prefix = plaintext[:apiKeyPrefixLength]
+
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+
+	return pg.db.QueryRow(query, key.UserID, key.Name, key.Prefix, tokens.Hash(plaintext), key.Scopes, key.Expiry).Scan(&key.ID, &key.CreatedAt, &key.UpdatedAt)
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeyByID(id int64) (*APIKey, error) {
+	query := `
+	SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE id = $1
+	`
+
+	key, err := scanAPIKey(pg.db.QueryRow(query, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (pg *PostgresAPIKeyStore) ListAPIKeys(userID int) ([]*APIKey, error) {
+	query := `
+	SELECT ` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (pg *PostgresAPIKeyStore) UpdateAPIKey(key *APIKey) error {
+	query := `
+	UPDATE api_keys
+	SET name = $1, scopes = $2, expiry = $3, updated_at = NOW()
+	WHERE id = $4
+	RETURNING updated_at
+	`
+
+	return pg.db.QueryRow(query, key.Name, key.Scopes, key.Expiry, key.ID).Scan(&key.UpdatedAt)
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetAPIKeyUser returns the owner of an api key that didn't expire, both are
+// nil when there is no such key or the owner is disabled
+func (pg *PostgresAPIKeyStore) GetAPIKeyUser(plaintext string) (*User, *APIKey, error) {
+	query := `
+	SELECT ` + prefixColumns("k", apiKeyColumns) + `, ` + prefixColumns("u", userColumns) + `
+	FROM api_keys k
+	INNER JOIN users u ON u.id = k.user_id
+	WHERE k.hash = $1 AND (k.expiry IS NULL OR k.expiry > $2) AND u.disabled_at IS NULL
+	`
+
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	key, err := scanAPIKey(pg.db.QueryRow(query, tokens.Hash(plaintext), time.Now()), userFields(user)...)
+
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, key, nil
+}
+
+// TouchAPIKey records that the key was just used
+func (pg *PostgresAPIKeyStore) TouchAPIKey(id int64) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)
+	`
+
+	_, err := pg.db.Exec(query, id, time.Now().Add(-lastUsedPrecision))
+
+	return err
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// LoginAttempts are the recent failed logins of a key, a username or an ip
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LockoutEvent records that a key was locked out
+type LockoutEvent struct {
+	ID          int64     `json:"id"`
+	Key         string    `json:"key"`
+	IP          string    `json:"ip"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AttemptStore keeps the failed logins. The Postgres store shares them between
+// the instances of the api, the memory store is for a single instance.
+type AttemptStore interface {
+	GetAttempts(key string) (*LoginAttempts, error)
+	RecordFailure(key string, now time.Time, window time.Duration) (*LoginAttempts, error)
+	LockAttempts(key string, until time.Time) error
+	ResetAttempts(key string) error
+	RecordLockout(event *LockoutEvent) error
+	DeleteStaleAttempts(before time.Time) error
+}
+
+type PostgresAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAttemptStore(db *sql.DB) *PostgresAttemptStore {
+	return &PostgresAttemptStore{
+		db: db,
+	}
+}
+
+func (pg *PostgresAttemptStore) GetAttempts(key string) (*LoginAttempts, error) {
+	attempts := &LoginAttempts{}
+
+	query := `
+	SELECT key, failures, last_failure_at, locked_until
+	FROM login_attempts
+	WHERE key = $1
+	`
+
+	err := pg.db.QueryRow(query, key).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &attempts.LockedUntil)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordFailure counts a failure, the count starts over when the last failure
+// is older than window
+func (pg *PostgresAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*LoginAttempts, error) {
+	attempts := &LoginAttempts{}
+
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at)
+	VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE
+	SET failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+		last_failure_at = EXCLUDED.last_failure_at
+	RETURNING key, failures, last_failure_at, locked_until
+	`
+
+	err := pg.db.QueryRow(query, key, now, now.Add(-window)).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &attempts.LockedUntil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func (pg *PostgresAttemptStore) LockAttempts(key string, until time.Time) error {
+	_, err := pg.db.Exec(`UPDATE login_attempts SET locked_until = $2 WHERE key = $1`, key, until)
+
+	return err
+}
+
+func (pg *PostgresAttemptStore) ResetAttempts(key string) error {
+	_, err := pg.db.Exec(`DELETE FROM login_attempts WHERE key = $1`, key)
+
+	return err
+}
+
+func (pg *PostgresAttemptStore) RecordLockout(event *LockoutEvent) error {
+	query := `
+	INSERT INTO lockout_events (key, ip, failures, locked_until)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query, event.Key, event.IP, event.Failures, event.LockedUntil).Scan(&event.ID, &event.CreatedAt)
+}
+
+// DeleteStaleAttempts forgets the keys that didn't fail since before and
+// aren't locked anymore
+func (pg *PostgresAttemptStore) DeleteStaleAttempts(before time.Time) error {
+	query := `
+	DELETE FROM login_attempts
+	WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $1)
+	`
+
+	_, err := pg.db.Exec(query, before)
+
+	return err
+}
+
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+	lockouts []LockoutEvent
+	nextID   int64
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		attempts: map[string]LoginAttempts{},
+	}
+}
+
+func (m *MemoryAttemptStore) GetAttempts(key string) (*LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+
+	if !ok {
+		return nil, nil
+	}
+
+	return &attempts, nil
+}
+
+func (m *MemoryAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+
+	if !ok || attempts.LastFailureAt.Before(now.Add(-window)) {
+		attempts.Failures = 0
+	}
+
+	attempts.Key = key
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	m.attempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (m *MemoryAttemptStore) LockAttempts(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+
+	if ok {
+		attempts.LockedUntil = &until
+		m.attempts[key] = attempts
+	}
+
+	return nil
+}
+
+func (m *MemoryAttemptStore) ResetAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+func (m *MemoryAttemptStore) RecordLockout(event *LockoutEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	event.ID = m.nextID
+	event.CreatedAt = time.Now()
+	m.lockouts = append(m.lockouts, *event)
+
+	return nil
+}
+
+func (m *MemoryAttemptStore) DeleteStaleAttempts(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, attempts := range m.attempts {
+		if attempts.LastFailureAt.Before(before) && (attempts.LockedUntil == nil || attempts.LockedUntil.Before(before)) {
+			delete(m.attempts, key)
+		}
+	}
+
+	// unlike the table there is no one to read old lockouts, they would only
+	// pile up in memory
+	lockouts := m.lockouts[:0]
+
+	for _, event := range m.lockouts {
+		if !event.LockedUntil.Before(before) {
+			lockouts = append(lockouts, event)
+		}
+	}
+
+	m.lockouts = lockouts
+
+	return nil
+}
+
+// Lockouts returns the lockout events that weren't pruned yet
+func (m *MemoryAttemptStore) Lockouts() []LockoutEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]LockoutEvent{}, m.lockouts...)
+}
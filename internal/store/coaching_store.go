@@ -0,0 +1,223 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// the access an athlete gives their coach to their workouts
+const (
+	CoachAccessRead      = "read"
+	CoachAccessReadWrite = "read_write"
+)
+
+var CoachAccesses = []string{CoachAccessRead, CoachAccessReadWrite}
+
+const (
+	CoachingPending  = "pending"
+	CoachingAccepted = "accepted"
+)
+
+var ErrDuplicateCoaching = errors.New("this coach was already invited")
+
+// Coaching is an athlete giving a coach access to their workouts, the access
+// starts once the coach accepts
+type Coaching struct {
+	ID              int64      `json:"id"`
+	CoachID         int        `json:"coach_id"`
+	CoachUsername   string     `json:"coach_username"`
+	AthleteID       int        `json:"athlete_id"`
+	AthleteUsername string     `json:"athlete_username"`
+	Access          string     `json:"access"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	AcceptedAt      *time.Time `json:"accepted_at"`
+}
+
+type PostgresCoachingStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCoachingStore(db *sql.DB) *PostgresCoachingStore {
+	return &PostgresCoachingStore{
+		db: db,
+	}
+}
+
+type CoachingStore interface {
+	CreateCoaching(*Coaching) error
+	GetCoaching(coachID, athleteID int) (*Coaching, error)
+	ListCoaches(athleteID int) ([]*Coaching, error)
+	ListAthletes(coachID int) ([]*Coaching, error)
+	AcceptCoaching(*Coaching) error
+	UpdateCoachingAccess(*Coaching) error
+	DeleteCoaching(coachID, athleteID int) error
+	GetCoachAccess(coachID, athleteID int) (string, error)
+}
+
+const coachingColumns = `c.id, c.coach_id, coach.username, c.athlete_id, athlete.username, c.access, c.status, c.created_at, c.accepted_at`
+
+const coachingJoins = `
+	INNER JOIN users coach ON coach.id = c.coach_id
+	INNER JOIN users athlete ON athlete.id = c.athlete_id`
+
+func scanCoaching(row rowScanner) (*Coaching, error) {
+	coaching := &Coaching{}
+
+	err := row.Scan(
+		&coaching.ID,
+		&coaching.CoachID,
+		&coaching.CoachUsername,
+		&coaching.AthleteID,
+		&coaching.AthleteUsername,
+		&coaching.Access,
+		&coaching.Status,
+		&coaching.CreatedAt,
+		&coaching.AcceptedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return coaching, nil
+}
+
+func (pg *PostgresCoachingStore) CreateCoaching(coaching *Coaching) error {
+	coaching.Status = CoachingPending
+
+	query := `
+	INSERT INTO coachings (coach_id, athlete_id, access)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`
+
+	err := pg.db.QueryRow(query, coaching.CoachID, coaching.AthleteID, coaching.Access).Scan(&coaching.ID, &coaching.CreatedAt)
+
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrDuplicateCoaching
+	}
+
+	return err
+}
+
+func (pg *PostgresCoachingStore) GetCoaching(coachID, athleteID int) (*Coaching, error) {
+	query := `
+	SELECT ` + coachingColumns + `
+	FROM coachings c` + coachingJoins + `
+	WHERE c.coach_id = $1 AND c.athlete_id = $2
+	`
+
+	coaching, err := scanCoaching(pg.db.QueryRow(query, coachID, athleteID))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return coaching, nil
+}
+
+func (pg *PostgresCoachingStore) listCoachings(where string, userID int) ([]*Coaching, error) {
+	query := `
+	SELECT ` + coachingColumns + `
+	FROM coachings c` + coachingJoins + `
+	WHERE ` + where + `
+	ORDER BY c.created_at DESC, c.id DESC
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	coachings := []*Coaching{}
+
+	for rows.Next() {
+		coaching, err := scanCoaching(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		coachings = append(coachings, coaching)
+	}
+
+	return coachings, rows.Err()
+}
+
+func (pg *PostgresCoachingStore) ListCoaches(athleteID int) ([]*Coaching, error) {
+	return pg.listCoachings("c.athlete_id = $1", athleteID)
+}
+
+func (pg *PostgresCoachingStore) ListAthletes(coachID int) ([]*Coaching, error) {
+	return pg.listCoachings("c.coach_id = $1", coachID)
+}
+
+func (pg *PostgresCoachingStore) AcceptCoaching(coaching *Coaching) error {
+	query := `
+	UPDATE coachings
+	SET status = $1, accepted_at = NOW()
+	WHERE id = $2
+	RETURNING status, accepted_at
+	`
+
+	return pg.db.QueryRow(query, CoachingAccepted, coaching.ID).Scan(&coaching.Status, &coaching.AcceptedAt)
+}
+
+func (pg *PostgresCoachingStore) UpdateCoachingAccess(coaching *Coaching) error {
+	_, err := pg.db.Exec(`UPDATE coachings SET access = $1 WHERE id = $2`, coaching.Access, coaching.ID)
+
+	return err
+}
+
+func (pg *PostgresCoachingStore) DeleteCoaching(coachID, athleteID int) error {
+	result, err := pg.db.Exec(`DELETE FROM coachings WHERE coach_id = $1 AND athlete_id = $2`, coachID, athleteID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetCoachAccess returns the access the coach has to the workouts of the
+// athlete, it is empty when there is no accepted coaching
+func (pg *PostgresCoachingStore) GetCoachAccess(coachID, athleteID int) (string, error) {
+	var access string
+
+	query := `
+	SELECT access
+	FROM coachings
+	WHERE coach_id = $1 AND athlete_id = $2 AND status = $3
+	`
+
+	err := pg.db.QueryRow(query, coachID, athleteID, CoachingAccepted).Scan(&access)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return access, err
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WorkoutComment is a comment on an entry of a workout, EntryID is nil once
+// the entry is gone
+type WorkoutComment struct {
+	ID        int64     `json:"id"`
+	WorkoutID int64     `json:"workout_id"`
+	EntryID   *int      `json:"entry_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{
+		db: db,
+	}
+}
+
+type CommentStore interface {
+	CreateComment(*WorkoutComment) error
+	GetComment(id int64) (*WorkoutComment, error)
+	ListComments(workoutID int64) ([]*WorkoutComment, error)
+	DeleteComment(id int64) error
+}
+
+const commentColumns = `c.id, c.workout_id, c.entry_id, c.user_id, u.username, c.body, c.created_at`
+
+func scanComment(row rowScanner) (*WorkoutComment, error) {
+	comment := &WorkoutComment{}
+
+	err := row.Scan(
+		&comment.ID,
+		&comment.WorkoutID,
+		&comment.EntryID,
+		&comment.UserID,
+		&comment.Username,
+		&comment.Body,
+		&comment.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// CreateComment returns sql.ErrNoRows when the entry isn't part of the workout
+func (pg *PostgresCommentStore) CreateComment(comment *WorkoutComment) error {
+	query := `
+	INSERT INTO workout_comments (workout_id, entry_id, user_id, body)
+	SELECT e.workout_id, e.id, $3, $4
+	FROM workout_entries e
+	WHERE e.id = $2 AND e.workout_id = $1
+	RETURNING id, created_at, (SELECT username FROM users WHERE id = $3)
+	`
+
+	return pg.db.QueryRow(query, comment.WorkoutID, comment.EntryID, comment.UserID, comment.Body).Scan(&comment.ID, &comment.CreatedAt, &comment.Username)
+}
+
+func (pg *PostgresCommentStore) GetComment(id int64) (*WorkoutComment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM workout_comments c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.id = $1
+	`
+
+	comment, err := scanComment(pg.db.QueryRow(query, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (pg *PostgresCommentStore) ListComments(workoutID int64) ([]*WorkoutComment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM workout_comments c
+	INNER JOIN users u ON u.id = c.user_id
+	WHERE c.workout_id = $1
+	ORDER BY c.created_at, c.id
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	comments := []*WorkoutComment{}
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+func (pg *PostgresCommentStore) DeleteComment(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM workout_comments WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
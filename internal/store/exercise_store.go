@@ -0,0 +1,179 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgtype"
+)
+
+type Exercise struct {
+	ID               int      `json:"id"`
+	Name             string   `json:"name"`
+	Aliases          []string `json:"aliases"`
+	PrimaryMuscles   []string `json:"primary_muscles"`
+	SecondaryMuscles []string `json:"secondary_muscles"`
+	Equipment        string   `json:"equipment"`
+	MovementPattern  string   `json:"movement_pattern"`
+}
+
+type ExerciseFilter struct {
+	Search      string
+	MuscleGroup string
+	Equipment   string
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{
+		db: db,
+	}
+}
+
+type ExerciseStore interface {
+	ListExercises(filter ExerciseFilter) ([]*Exercise, error)
+	GetExerciseByID(id int) (*Exercise, error)
+	FindExerciseByName(name string) (*Exercise, error)
+}
+
+const exerciseColumns = `id, name, aliases, primary_muscles, secondary_muscles, equipment, movement_pattern`
+
+func (pg *PostgresExerciseStore) ListExercises(filter ExerciseFilter) ([]*Exercise, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	if filter.Search != "" {
+		args = append(args, filter.Search)
+		conditions = append(conditions, fmt.Sprintf(`(
+		name ILIKE '%%' || $%d || '%%'
+		OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE alias ILIKE '%%' || $%d || '%%')
+	)`, len(args), len(args)))
+	}
+
+	if filter.MuscleGroup != "" {
+		args = append(args, strings.ToLower(filter.MuscleGroup))
+		conditions = append(conditions, fmt.Sprintf("($%d = ANY(primary_muscles) OR $%d = ANY(secondary_muscles))", len(args), len(args)))
+	}
+
+	if filter.Equipment != "" {
+		args = append(args, strings.ToLower(filter.Equipment))
+		conditions = append(conditions, fmt.Sprintf("equipment = $%d", len(args)))
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM exercises
+	WHERE %s
+	ORDER BY name
+	`, exerciseColumns, strings.Join(conditions, " AND "))
+
+	rows, err := pg.db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, rows.Err()
+}
+
+func (pg *PostgresExerciseStore) GetExerciseByID(id int) (*Exercise, error) {
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM exercises
+	WHERE id = $1
+	`, exerciseColumns)
+
+	exercise, err := scanExercise(pg.db.QueryRow(query, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// FindExerciseByName matches the canonical name or one of the aliases, ignoring case
+func (pg *PostgresExerciseStore) FindExerciseByName(name string) (*Exercise, error) {
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM exercises
+	WHERE LOWER(name) = LOWER($1)
+	   OR EXISTS (SELECT 1 FROM unnest(aliases) alias WHERE LOWER(alias) = LOWER($1))
+	ORDER BY LOWER(name) = LOWER($1) DESC
+	LIMIT 1
+	`, exerciseColumns)
+
+	exercise, err := scanExercise(pg.db.QueryRow(query, strings.TrimSpace(name)))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExercise(row rowScanner) (*Exercise, error) {
+	exercise := &Exercise{}
+	var aliases, primaryMuscles, secondaryMuscles pgtype.TextArray
+
+	err := row.Scan(
+		&exercise.ID,
+		&exercise.Name,
+		&aliases,
+		&primaryMuscles,
+		&secondaryMuscles,
+		&exercise.Equipment,
+		&exercise.MovementPattern,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, array := range []struct {
+		src *pgtype.TextArray
+		dst *[]string
+	}{
+		{&aliases, &exercise.Aliases},
+		{&primaryMuscles, &exercise.PrimaryMuscles},
+		{&secondaryMuscles, &exercise.SecondaryMuscles},
+	} {
+		err = array.src.AssignTo(array.dst)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return exercise, nil
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindExerciseByName(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresExerciseStore(db)
+
+	// the catalog is seeded by the migrations
+	benchPress, err := store.FindExerciseByName("Bench Press")
+	require.NoError(t, err)
+	require.NotNil(t, benchPress)
+
+	tests := []struct {
+		name   string
+		input  string
+		wantID *int
+	}{
+		{name: "alias", input: "BP", wantID: &benchPress.ID},
+		{name: "case variant", input: "bench press", wantID: &benchPress.ID},
+		{name: "case variant of an alias", input: "flat bench", wantID: &benchPress.ID},
+		{name: "surrounding spaces", input: "  Bench Press ", wantID: &benchPress.ID},
+		{name: "not in the catalog", input: "Zercher Squat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exercise, err := store.FindExerciseByName(tt.input)
+			require.NoError(t, err)
+
+			if tt.wantID == nil {
+				assert.Nil(t, exercise)
+				return
+			}
+
+			require.NotNil(t, exercise)
+			assert.Equal(t, *tt.wantID, exercise.ID)
+			assert.Equal(t, "Bench Press", exercise.Name)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// ExportRow is a single set of a workout together with its entry and workout.
+// Entries without sets and workouts without entries get a row of their own
+// with the missing columns left empty.
+type ExportRow struct {
+	WorkoutID           int        `json:"workout_id"`
+	Title               string     `json:"title"`
+	Description         string     `json:"description"`
+	PerformedAt         time.Time  `json:"performed_at"`
+	StartedAt           *time.Time `json:"started_at"`
+	EndedAt             *time.Time `json:"ended_at"`
+	Timezone            string     `json:"timezone"`
+	DurationMinutes     int        `json:"duration_minutes"`
+	CaloriesBurned      int        `json:"calories_burned"`
+	EntryID             *int       `json:"entry_id"`
+	ExerciseID          *int       `json:"exercise_id"`
+	ExerciseName        *string    `json:"exercise_name"`
+	Kind                *string    `json:"kind"`
+	OrderIndex          *int       `json:"order_index"`
+	Notes               *string    `json:"notes"`
+	ElevationGainMeters *float64   `json:"elevation_gain_meters"`
+	AvgHeartRate        *int       `json:"avg_heart_rate"`
+	MaxHeartRate        *int       `json:"max_heart_rate"`
+	Cadence             *int       `json:"cadence"`
+	SetIndex            *int       `json:"set_index"`
+	SetType             *string    `json:"set_type"`
+	Reps                *int       `json:"reps"`
+	Weight              *float64   `json:"weight"`
+	DurationSeconds     *int       `json:"duration_seconds"`
+	DistanceMeters      *float64   `json:"distance_meters"`
+	RPE                 *float64   `json:"rpe"`
+	Completed           *bool      `json:"completed"`
+}
+
+// ExportColumns is the csv header, in the same order as ExportRow.CSVRecord
+var ExportColumns = []string{
+	"workout_id", "title", "description", "performed_at", "started_at", "ended_at", "timezone", "duration_minutes",
+	"calories_burned", "entry_id", "exercise_id", "exercise_name", "kind", "order_index", "notes",
+	"elevation_gain_meters", "avg_heart_rate", "max_heart_rate", "cadence", "set_index", "set_type", "reps", "weight",
+	"duration_seconds", "distance_meters", "rpe", "completed",
+}
+
+func (row *ExportRow) CSVRecord() []string {
+	return []string{
+		strconv.Itoa(row.WorkoutID),
+		row.Title,
+		row.Description,
+		row.PerformedAt.Format(time.RFC3339),
+		formatTime(row.StartedAt),
+		formatTime(row.EndedAt),
+		row.Timezone,
+		strconv.Itoa(row.DurationMinutes),
+		strconv.Itoa(row.CaloriesBurned),
+		formatInt(row.EntryID),
+		formatInt(row.ExerciseID),
+		formatString(row.ExerciseName),
+		formatString(row.Kind),
+		formatInt(row.OrderIndex),
+		formatString(row.Notes),
+		formatFloat(row.ElevationGainMeters),
+		formatInt(row.AvgHeartRate),
+		formatInt(row.MaxHeartRate),
+		formatInt(row.Cadence),
+		formatInt(row.SetIndex),
+		formatString(row.SetType),
+		formatInt(row.Reps),
+		formatFloat(row.Weight),
+		formatInt(row.DurationSeconds),
+		formatFloat(row.DistanceMeters),
+		formatFloat(row.RPE),
+		formatBool(row.Completed),
+	}
+}
+
+type PostgresExportStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExportStore(db *sql.DB) *PostgresExportStore {
+	return &PostgresExportStore{
+		db: db,
+	}
+}
+
+type ExportStore interface {
+	ExportWorkouts(userID int, fn func(*ExportRow) error) error
+}
+
+// ExportWorkouts calls fn for every row of the export of a user, oldest workout
+// first. The rows are read one by one so the export is never held in memory,
+// an error of fn stops the export.
+func (pg *PostgresExportStore) ExportWorkouts(userID int, fn func(*ExportRow) error) error {
+	query := `
+	SELECT w.id, w.title, COALESCE(w.description, ''), w.performed_at, w.started_at, w.ended_at, w.timezone,
+		w.duration_minutes, COALESCE(w.calories_burned, 0),
+		we.id, we.exercise_id, we.exercise_name, we.kind, we.order_index, we.notes,
+		we.elevation_gain_meters, we.avg_heart_rate, we.max_heart_rate, we.cadence,
+		s.set_index, s.set_type, s.reps, s.weight, s.duration_seconds, s.distance_meters,
+		s.rpe, s.completed
+	FROM workouts w
+	LEFT JOIN workout_entries we ON we.workout_id = w.id
+	LEFT JOIN workout_sets s ON s.workout_entry_id = we.id
+	WHERE w.user_id = $1
+	ORDER BY w.performed_at, w.id, we.order_index, we.id, s.set_index
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var row ExportRow
+
+		err := rows.Scan(
+			&row.WorkoutID,
+			&row.Title,
+			&row.Description,
+			&row.PerformedAt,
+			&row.StartedAt,
+			&row.EndedAt,
+			&row.Timezone,
+			&row.DurationMinutes,
+			&row.CaloriesBurned,
+			&row.EntryID,
+			&row.ExerciseID,
+			&row.ExerciseName,
+			&row.Kind,
+			&row.OrderIndex,
+			&row.Notes,
+			&row.ElevationGainMeters,
+			&row.AvgHeartRate,
+			&row.MaxHeartRate,
+			&row.Cadence,
+			&row.SetIndex,
+			&row.SetType,
+			&row.Reps,
+			&row.Weight,
+			&row.DurationSeconds,
+			&row.DistanceMeters,
+			&row.RPE,
+			&row.Completed,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(&row)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func formatInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*value)
+}
+
+func formatFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+func formatString(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func formatBool(value *bool) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatBool(*value)
+}
+
+func formatTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+
+	return value.Format(time.RFC3339)
+}
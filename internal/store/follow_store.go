@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// a follow is a request until the followee accepts it
+const (
+	FollowPending  = "pending"
+	FollowAccepted = "accepted"
+)
+
+// Follower is a user that follows, or asked to follow, another user
+type Follower struct {
+	UserID     int        `json:"user_id"`
+	Username   string     `json:"username"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+type PostgresFollowStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFollowStore(db *sql.DB) *PostgresFollowStore {
+	return &PostgresFollowStore{
+		db: db,
+	}
+}
+
+// FollowStore keeps who follows who, followers see the workouts with the
+// followers visibility once the followee accepted them
+type FollowStore interface {
+	Follow(followerID, followeeID int) (string, error)
+	Unfollow(followerID, followeeID int) error
+	IsFollowing(followerID, followeeID int) (bool, error)
+	ListFollowers(followeeID int) ([]*Follower, error)
+	AcceptFollower(followeeID, followerID int) error
+	RemoveFollower(followeeID, followerID int) error
+}
+
+// Follow asks to follow followeeID, it doesn't mind when followerID already
+// did and returns the status of the follow
+func (pg *PostgresFollowStore) Follow(followerID, followeeID int) (string, error) {
+	var status string
+
+	query := `
+	INSERT INTO follows (follower_id, followee_id, status)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (follower_id, followee_id) DO UPDATE SET status = follows.status
+	RETURNING status
+	`
+
+	err := pg.db.QueryRow(query, followerID, followeeID, FollowPending).Scan(&status)
+
+	return status, err
+}
+
+func (pg *PostgresFollowStore) Unfollow(followerID, followeeID int) error {
+	_, err := pg.db.Exec(`DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2`, followerID, followeeID)
+
+	return err
+}
+
+// IsFollowing only counts the follows the followee accepted
+func (pg *PostgresFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	var following bool
+
+	query := `
+	SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2 AND status = $3)
+	`
+
+	err := pg.db.QueryRow(query, followerID, followeeID, FollowAccepted).Scan(&following)
+
+	return following, err
+}
+
+// ListFollowers lists the followers and the follow requests of followeeID,
+// the requests first
+func (pg *PostgresFollowStore) ListFollowers(followeeID int) ([]*Follower, error) {
+	query := `
+	SELECT f.follower_id, u.username, f.status, f.created_at, f.accepted_at
+	FROM follows f
+	INNER JOIN users u ON u.id = f.follower_id
+	WHERE f.followee_id = $1
+	ORDER BY f.status DESC, f.created_at DESC, f.follower_id
+	`
+
+	rows, err := pg.db.Query(query, followeeID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	followers := []*Follower{}
+
+	for rows.Next() {
+		follower := &Follower{}
+
+		err := rows.Scan(&follower.UserID, &follower.Username, &follower.Status, &follower.CreatedAt, &follower.AcceptedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		followers = append(followers, follower)
+	}
+
+	return followers, rows.Err()
+}
+
+// AcceptFollower returns sql.ErrNoRows when followerID didn't ask to follow
+func (pg *PostgresFollowStore) AcceptFollower(followeeID, followerID int) error {
+	query := `
+	UPDATE follows
+	SET status = $3, accepted_at = COALESCE(accepted_at, NOW())
+	WHERE followee_id = $1 AND follower_id = $2
+	`
+
+	result, err := pg.db.Exec(query, followeeID, followerID, FollowAccepted)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RemoveFollower declines a follow request or removes a follower, it returns
+// sql.ErrNoRows when followerID doesn't follow followeeID
+func (pg *PostgresFollowStore) RemoveFollower(followeeID, followerID int) error {
+	result, err := pg.db.Exec(`DELETE FROM follows WHERE followee_id = $1 AND follower_id = $2`, followeeID, followerID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+)
+
+// TOTP is the authenticator app of a user, 2FA is on once it is confirmed
+type TOTP struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+type PostgresMFAStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMFAStore(db *sql.DB) *PostgresMFAStore {
+	return &PostgresMFAStore{
+		db: db,
+	}
+}
+
+type MFAStore interface {
+	GetTOTP(userID int) (*TOTP, error)
+	SaveTOTP(userID int, secret string) error
+	ConfirmTOTP(userID int, step int64, recoveryCodes []string) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	DeleteTOTP(userID int) error
+	ReplaceRecoveryCodes(userID int, recoveryCodes []string) error
+	UseRecoveryCode(userID int, code string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+}
+
+func (pg *PostgresMFAStore) GetTOTP(userID int) (*TOTP, error) {
+	totp := &TOTP{}
+
+	query := `
+	SELECT user_id, secret, confirmed_at, last_used_step, created_at
+	FROM user_totp
+	WHERE user_id = $1
+	`
+
+	err := pg.db.QueryRow(query, userID).Scan(&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep, &totp.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+// SaveTOTP starts an enrollment, it replaces an enrollment that wasn't
+// confirmed but leaves a confirmed one alone
+func (pg *PostgresMFAStore) SaveTOTP(userID int, secret string) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+	WHERE user_totp.confirmed_at IS NULL
+	`
+
+	_, err := pg.db.Exec(query, userID, secret)
+
+	return err
+}
+
+// ConfirmTOTP turns 2FA on with the step of the code that confirmed it and
+// stores the recovery codes. It returns sql.ErrNoRows when there is no
+// enrollment waiting to be confirmed.
+func (pg *PostgresMFAStore) ConfirmTOTP(userID int, step int64, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	UPDATE user_totp
+	SET confirmed_at = NOW(), last_used_step = $2
+	WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+
+	result, err := tx.Exec(query, userID, step)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodes)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that a code of step was used, it returns false when a
+// code of that step or a later one was used already
+func (pg *PostgresMFAStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `
+	UPDATE user_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	result, err := pg.db.Exec(query, userID, step)
+
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// DeleteTOTP turns 2FA off, the recovery codes go with it
+func (pg *PostgresMFAStore) DeleteTOTP(userID int) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresMFAStore) ReplaceRecoveryCodes(userID int, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(tx, userID, recoveryCodes)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes stores the hashes of the codes, the earlier codes stop
+// working
+func replaceRecoveryCodes(db execer, userID int, recoveryCodes []string) error {
+	_, err := db.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = db.Exec(
+			`INSERT INTO mfa_recovery_codes (user_id, hash) VALUES ($1, $2)`,
+			userID, tokens.Hash(tokens.NormalizeRecoveryCode(code)),
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses up a recovery code, it returns false when the code
+// doesn't exist or was used before
+func (pg *PostgresMFAStore) UseRecoveryCode(userID int, code string) (bool, error) {
+	query := `
+	UPDATE mfa_recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+	`
+
+	result, err := pg.db.Exec(query, userID, tokens.Hash(tokens.NormalizeRecoveryCode(code)))
+
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns how many recovery codes weren't used yet
+func (pg *PostgresMFAStore) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+
+	err := pg.db.QueryRow(`SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+
+	return count, err
+}
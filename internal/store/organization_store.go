@@ -0,0 +1,330 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// the roles of the members of an organization
+const (
+	OrgRoleMember = "member"
+	OrgRoleAdmin  = "admin"
+)
+
+var OrgRoles = []string{OrgRoleMember, OrgRoleAdmin}
+
+// a member is invited by an admin and only joins once they accept
+const (
+	OrgMemberPending  = "pending"
+	OrgMemberAccepted = "accepted"
+)
+
+var ErrDuplicateMember = errors.New("user is already a member")
+
+type Organization struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+	// Role and Status are the membership of the user the organization was
+	// looked up for
+	Role      string    `json:"role,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationMember struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Status   string    `json:"status"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type PostgresOrganizationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOrganizationStore(db *sql.DB) *PostgresOrganizationStore {
+	return &PostgresOrganizationStore{
+		db: db,
+	}
+}
+
+type OrganizationStore interface {
+	CreateOrganization(org *Organization, adminID int) error
+	GetOrganization(id int64, userID int) (*Organization, error)
+	ListOrganizations(userID int) ([]*Organization, error)
+	UpdateOrganization(*Organization) error
+	DeleteOrganization(id int64) error
+	ListMembers(orgID int64) ([]*OrganizationMember, error)
+	AddMember(orgID int64, member *OrganizationMember) error
+	AcceptMembership(orgID int64, userID int) error
+	UpdateMemberRole(orgID int64, userID int, role string) error
+	RemoveMember(orgID int64, userID int) error
+	CountAdmins(orgID int64) (int, error)
+	SharesOrganization(userID, otherID int) (bool, error)
+}
+
+// CreateOrganization creates the organization with adminID as its first admin
+func (pg *PostgresOrganizationStore) CreateOrganization(org *Organization, adminID int) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO organizations (name) VALUES ($1) RETURNING id, created_at`, org.Name).Scan(&org.ID, &org.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO organization_members (organization_id, user_id, role, status) VALUES ($1, $2, $3, $4)`, org.ID, adminID, OrgRoleAdmin, OrgMemberAccepted)
+
+	if err != nil {
+		return err
+	}
+
+	org.Members = 1
+	org.Role = OrgRoleAdmin
+	org.Status = OrgMemberAccepted
+
+	return tx.Commit()
+}
+
+const organizationColumns = `o.id, o.name, (SELECT COUNT(*) FROM organization_members c WHERE c.organization_id = o.id AND c.status = 'accepted'), m.role, m.status, o.created_at`
+
+func scanOrganization(row rowScanner) (*Organization, error) {
+	org := &Organization{}
+
+	err := row.Scan(&org.ID, &org.Name, &org.Members, &org.Role, &org.Status, &org.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// GetOrganization returns nil unless userID is a member of the organization or
+// was invited to it, Status tells which
+func (pg *PostgresOrganizationStore) GetOrganization(id int64, userID int) (*Organization, error) {
+	query := `
+	SELECT ` + organizationColumns + `
+	FROM organizations o
+	INNER JOIN organization_members m ON m.organization_id = o.id
+	WHERE o.id = $1 AND m.user_id = $2
+	`
+
+	org, err := scanOrganization(pg.db.QueryRow(query, id, userID))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+func (pg *PostgresOrganizationStore) ListOrganizations(userID int) ([]*Organization, error) {
+	query := `
+	SELECT ` + organizationColumns + `
+	FROM organizations o
+	INNER JOIN organization_members m ON m.organization_id = o.id
+	WHERE m.user_id = $1
+	ORDER BY o.name, o.id
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	orgs := []*Organization{}
+
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+func (pg *PostgresOrganizationStore) UpdateOrganization(org *Organization) error {
+	_, err := pg.db.Exec(`UPDATE organizations SET name = $1 WHERE id = $2`, org.Name, org.ID)
+
+	return err
+}
+
+func (pg *PostgresOrganizationStore) DeleteOrganization(id int64) error {
+	_, err := pg.db.Exec(`DELETE FROM organizations WHERE id = $1`, id)
+
+	return err
+}
+
+func (pg *PostgresOrganizationStore) ListMembers(orgID int64) ([]*OrganizationMember, error) {
+	query := `
+	SELECT m.user_id, u.username, m.role, m.status, m.joined_at
+	FROM organization_members m
+	INNER JOIN users u ON u.id = m.user_id
+	WHERE m.organization_id = $1
+	ORDER BY u.username
+	`
+
+	rows, err := pg.db.Query(query, orgID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	members := []*OrganizationMember{}
+
+	for rows.Next() {
+		member := &OrganizationMember{}
+
+		err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.Status, &member.JoinedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember invites the user, they become a member once they accept
+func (pg *PostgresOrganizationStore) AddMember(orgID int64, member *OrganizationMember) error {
+	member.Status = OrgMemberPending
+
+	query := `
+	INSERT INTO organization_members (organization_id, user_id, role, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING joined_at
+	`
+
+	err := pg.db.QueryRow(query, orgID, member.UserID, member.Role, member.Status).Scan(&member.JoinedAt)
+
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrDuplicateMember
+	}
+
+	return err
+}
+
+// AcceptMembership returns sql.ErrNoRows when userID wasn't invited
+func (pg *PostgresOrganizationStore) AcceptMembership(orgID int64, userID int) error {
+	query := `
+	UPDATE organization_members
+	SET status = $3, joined_at = NOW()
+	WHERE organization_id = $1 AND user_id = $2
+	`
+
+	result, err := pg.db.Exec(query, orgID, userID, OrgMemberAccepted)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UpdateMemberRole returns sql.ErrNoRows when userID isn't a member
+func (pg *PostgresOrganizationStore) UpdateMemberRole(orgID int64, userID int, role string) error {
+	result, err := pg.db.Exec(`UPDATE organization_members SET role = $3 WHERE organization_id = $1 AND user_id = $2`, orgID, userID, role)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RemoveMember returns sql.ErrNoRows when userID isn't a member
+func (pg *PostgresOrganizationStore) RemoveMember(orgID int64, userID int) error {
+	result, err := pg.db.Exec(`DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2`, orgID, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresOrganizationStore) CountAdmins(orgID int64) (int, error) {
+	var admins int
+
+	err := pg.db.QueryRow(`SELECT COUNT(*) FROM organization_members WHERE organization_id = $1 AND role = $2 AND status = $3`, orgID, OrgRoleAdmin, OrgMemberAccepted).Scan(&admins)
+
+	return admins, err
+}
+
+// SharesOrganization tells whether both users are a member of the same
+// organization, invitations that weren't accepted don't count
+func (pg *PostgresOrganizationStore) SharesOrganization(userID, otherID int) (bool, error) {
+	var shares bool
+
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM organization_members a
+		INNER JOIN organization_members b ON b.organization_id = a.organization_id
+		WHERE a.user_id = $1 AND b.user_id = $2 AND a.status = $3 AND b.status = $3
+	)
+	`
+
+	err := pg.db.QueryRow(query, userID, otherID, OrgMemberAccepted).Scan(&shares)
+
+	return shares, err
+}
@@ -0,0 +1,440 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// record types that are tracked per exercise
+const (
+	RecordMaxWeight    = "max_weight"
+	RecordMaxReps      = "max_reps" // best reps at a given weight
+	RecordEstimated1RM = "estimated_1rm"
+	RecordMaxDuration  = "max_duration"
+	RecordMaxVolume    = "max_volume" // weight x reps of a single session
+)
+
+type PersonalRecord struct {
+	ID             int       `json:"id"`
+	ExerciseID     *int      `json:"exercise_id"`
+	ExerciseName   string    `json:"exercise_name"`
+	RecordType     string    `json:"record_type"`
+	Value          float64   `json:"value"`
+	Weight         *float64  `json:"weight,omitempty"`
+	WorkoutID      int       `json:"workout_id"`
+	WorkoutEntryID int       `json:"workout_entry_id"`
+	AchievedAt     time.Time `json:"achieved_at"`
+}
+
+type PostgresPersonalRecordStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPersonalRecordStore(db *sql.DB) *PostgresPersonalRecordStore {
+	return &PostgresPersonalRecordStore{
+		db: db,
+	}
+}
+
+type PersonalRecordStore interface {
+	GetCurrentRecords(userID int) ([]*PersonalRecord, error)
+	GetRecordsBefore(userID int, before time.Time) ([]*PersonalRecord, error)
+	GetRecordHistory(userID int, exercise string) ([]*PersonalRecord, error)
+}
+
+const personalRecordColumns = `id, exercise_id, exercise_name, record_type, value, weight, workout_id, workout_entry_id, achieved_at`
+
+// GetCurrentRecords returns the best value of every record type per exercise
+func (pg *PostgresPersonalRecordStore) GetCurrentRecords(userID int) ([]*PersonalRecord, error) {
+	query := `
+	SELECT DISTINCT ON (COALESCE(exercise_id::text, LOWER(exercise_name)), record_type, weight) ` + personalRecordColumns + `
+	FROM personal_records
+	WHERE user_id = $1
+	ORDER BY COALESCE(exercise_id::text, LOWER(exercise_name)), record_type, weight, value DESC, achieved_at
+	`
+
+	return pg.queryRecords(query, userID)
+}
+
+// GetRecordsBefore returns the best value of every record type per exercise
+// as it was before a point in time
+func (pg *PostgresPersonalRecordStore) GetRecordsBefore(userID int, before time.Time) ([]*PersonalRecord, error) {
+	query := `
+	SELECT DISTINCT ON (COALESCE(exercise_id::text, LOWER(exercise_name)), record_type, weight) ` + personalRecordColumns + `
+	FROM personal_records
+	WHERE user_id = $1 AND achieved_at < $2
+	ORDER BY COALESCE(exercise_id::text, LOWER(exercise_name)), record_type, weight, value DESC, achieved_at
+	`
+
+	return pg.queryRecords(query, userID, before)
+}
+
+// GetRecordHistory returns every record that was set for an exercise, the
+// exercise can be given as catalog id or as name
+func (pg *PostgresPersonalRecordStore) GetRecordHistory(userID int, exercise string) ([]*PersonalRecord, error) {
+	match := "LOWER(exercise_name) = LOWER($2)"
+	var arg interface{} = exercise
+
+	if exerciseID, err := strconv.Atoi(exercise); err == nil {
+		match = "exercise_id = $2"
+		arg = exerciseID
+	}
+
+	query := `
+	SELECT ` + personalRecordColumns + `
+	FROM personal_records
+	WHERE user_id = $1 AND ` + match + `
+	ORDER BY achieved_at, id
+	`
+
+	return pg.queryRecords(query, userID, arg)
+}
+
+func (pg *PostgresPersonalRecordStore) queryRecords(query string, args ...interface{}) ([]*PersonalRecord, error) {
+	rows, err := pg.db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	records := []*PersonalRecord{}
+
+	for rows.Next() {
+		record := &PersonalRecord{}
+
+		err := rows.Scan(
+			&record.ID,
+			&record.ExerciseID,
+			&record.ExerciseName,
+			&record.RecordType,
+			&record.Value,
+			&record.Weight,
+			&record.WorkoutID,
+			&record.WorkoutEntryID,
+			&record.AchievedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// exerciseRef identifies an exercise either by catalog id or by free text name
+type exerciseRef struct {
+	ID   *int
+	Name string
+}
+
+func (ref exerciseRef) key() string {
+	if ref.ID != nil {
+		return strconv.Itoa(*ref.ID)
+	}
+
+	return strings.ToLower(ref.Name)
+}
+
+func entryExercises(entries []WorkoutEntry) []exerciseRef {
+	refs := []exerciseRef{}
+
+	for _, entry := range entries {
+		refs = append(refs, exerciseRef{ID: entry.ExerciseID, Name: entry.ExerciseName})
+	}
+
+	return refs
+}
+
+func workoutExercises(tx *sql.Tx, workoutID int64) ([]exerciseRef, error) {
+	rows, err := tx.Query(`SELECT DISTINCT exercise_id, exercise_name FROM workout_entries WHERE workout_id = $1`, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	refs := []exerciseRef{}
+
+	for rows.Next() {
+		var ref exerciseRef
+
+		err := rows.Scan(&ref.ID, &ref.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
+
+// recordSet is a single completed set in the training history of an exercise
+type recordSet struct {
+	WorkoutID       int
+	EntryID         int
+	ExerciseName    string
+	PerformedAt     time.Time
+	Reps            *int
+	Weight          *float64
+	DurationSeconds *int
+}
+
+// recomputePersonalRecords rebuilds the record history of the given exercises
+// for a user. Rebuilding instead of comparing against the stored records keeps
+// the history correct when older workouts are edited or deleted.
+func recomputePersonalRecords(tx *sql.Tx, userID int, exercises []exerciseRef) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+
+	// two transactions of the same user would otherwise both delete and insert
+	// the records and end up with duplicates. NO KEY UPDATE because the
+	// workouts the transaction already inserted hold a key share lock on the user
+	var lockedID int
+
+	err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID).Scan(&lockedID)
+
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+
+	for _, exercise := range exercises {
+		if seen[exercise.key()] {
+			continue
+		}
+
+		seen[exercise.key()] = true
+
+		match := "we.exercise_id IS NULL AND LOWER(we.exercise_name) = LOWER($2)"
+		deleteQuery := `DELETE FROM personal_records WHERE user_id = $1 AND exercise_id IS NULL AND LOWER(exercise_name) = LOWER($2)`
+		var arg interface{} = exercise.Name
+
+		if exercise.ID != nil {
+			match = "we.exercise_id = $2"
+			deleteQuery = `DELETE FROM personal_records WHERE user_id = $1 AND exercise_id = $2`
+			arg = *exercise.ID
+		}
+
+		query := `
+		SELECT w.id, we.id, we.exercise_name, w.performed_at, s.reps, s.weight, s.duration_seconds
+		FROM workout_sets s
+		INNER JOIN workout_entries we ON we.id = s.workout_entry_id
+		INNER JOIN workouts w ON w.id = we.workout_id
+		WHERE w.user_id = $1 AND ` + match + ` AND s.completed AND s.set_type <> 'warmup'
+		ORDER BY w.performed_at, w.id, we.order_index, we.id, s.set_index
+		`
+
+		rows, err := tx.Query(query, userID, arg)
+
+		if err != nil {
+			return err
+		}
+
+		sets := []recordSet{}
+
+		for rows.Next() {
+			var set recordSet
+
+			err := rows.Scan(&set.WorkoutID, &set.EntryID, &set.ExerciseName, &set.PerformedAt, &set.Reps, &set.Weight, &set.DurationSeconds)
+
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			sets = append(sets, set)
+		}
+
+		rows.Close()
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(deleteQuery, userID, arg)
+
+		if err != nil {
+			return err
+		}
+
+		for _, record := range computePersonalRecords(sets) {
+			query := `
+			INSERT INTO personal_records (user_id, exercise_id, exercise_name, record_type, value, weight, workout_id, workout_entry_id, achieved_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`
+
+			_, err := tx.Exec(query, userID, exercise.ID, record.ExerciseName, record.RecordType, record.Value, record.Weight, record.WorkoutID, record.WorkoutEntryID, record.AchievedAt)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// computePersonalRecords walks the sets of one exercise in chronological order
+// and returns a record every time a previous best is beaten
+func computePersonalRecords(sets []recordSet) []*PersonalRecord {
+	records := []*PersonalRecord{}
+	best := map[string]float64{}
+	bestRepsAtWeight := map[float64]int{}
+
+	improve := func(recordType string, value float64, set recordSet, weight *float64) {
+		if current, ok := best[recordType]; ok && value <= current {
+			return
+		}
+
+		best[recordType] = value
+		records = append(records, &PersonalRecord{
+			ExerciseName:   set.ExerciseName,
+			RecordType:     recordType,
+			Value:          math.Round(value*100) / 100,
+			Weight:         weight,
+			WorkoutID:      set.WorkoutID,
+			WorkoutEntryID: set.EntryID,
+			AchievedAt:     set.PerformedAt,
+		})
+	}
+
+	// session volume is only known once all sets of a workout have been seen
+	var volume float64
+	var volumeSet *recordSet
+
+	flushVolume := func() {
+		if volumeSet != nil && volume > 0 {
+			improve(RecordMaxVolume, volume, *volumeSet, nil)
+		}
+
+		volume = 0
+		volumeSet = nil
+	}
+
+	for i, set := range sets {
+		if volumeSet != nil && volumeSet.WorkoutID != set.WorkoutID {
+			flushVolume()
+		}
+
+		if volumeSet == nil {
+			volumeSet = &sets[i]
+		}
+
+		if set.DurationSeconds != nil && *set.DurationSeconds > 0 {
+			improve(RecordMaxDuration, float64(*set.DurationSeconds), set, nil)
+		}
+
+		if set.Reps == nil || *set.Reps < 1 || set.Weight == nil || *set.Weight <= 0 {
+			continue
+		}
+
+		reps, weight := *set.Reps, *set.Weight
+		volume += float64(reps) * weight
+
+		improve(RecordMaxWeight, weight, set, nil)
+		improve(RecordEstimated1RM, epley(weight, reps), set, nil)
+
+		// the first set at a weight only sets the bar, beating it is a record
+		current, ok := bestRepsAtWeight[weight]
+
+		if !ok {
+			bestRepsAtWeight[weight] = reps
+			continue
+		}
+
+		if reps > current {
+			bestRepsAtWeight[weight] = reps
+			w := weight
+			records = append(records, &PersonalRecord{
+				ExerciseName:   set.ExerciseName,
+				RecordType:     RecordMaxReps,
+				Value:          float64(reps),
+				Weight:         &w,
+				WorkoutID:      set.WorkoutID,
+				WorkoutEntryID: set.EntryID,
+				AchievedAt:     set.PerformedAt,
+			})
+		}
+	}
+
+	flushVolume()
+
+	return records
+}
+
+// epley estimates the one rep max, a single rep is the max itself
+func epley(weight float64, reps int) float64 {
+	if reps == 1 {
+		return weight
+	}
+
+	return weight * (1 + float64(reps)/30)
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadRecordFlags marks the entries of the given workouts with the records they set
+func loadRecordFlags(q queryer, workouts []*Workout) error {
+	entryIDs := []int64{}
+	byID := map[int]*WorkoutEntry{}
+
+	for _, workout := range workouts {
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+			entry.PersonalRecords = []string{}
+			entryIDs = append(entryIDs, int64(entry.ID))
+			byID[entry.ID] = entry
+		}
+	}
+
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT DISTINCT workout_entry_id, record_type
+	FROM personal_records
+	WHERE workout_entry_id = ANY($1)
+	ORDER BY workout_entry_id, record_type
+	`
+
+	rows, err := q.Query(query, entryIDs)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		var recordType string
+
+		err := rows.Scan(&entryID, &recordType)
+
+		if err != nil {
+			return err
+		}
+
+		if entry, ok := byID[entryID]; ok {
+			entry.PersonalRecords = append(entry.PersonalRecords, recordType)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputePersonalRecords(t *testing.T) {
+	day1 := time.Date(2025, 5, 1, 8, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 7)
+
+	sets := []recordSet{
+		{WorkoutID: 1, EntryID: 10, ExerciseName: "Bench Press", PerformedAt: day1, Reps: IntPtr(10), Weight: FloatPtr(60)},
+		{WorkoutID: 1, EntryID: 10, ExerciseName: "Bench Press", PerformedAt: day1, Reps: IntPtr(8), Weight: FloatPtr(70)},
+		{WorkoutID: 2, EntryID: 20, ExerciseName: "Bench Press", PerformedAt: day2, Reps: IntPtr(12), Weight: FloatPtr(60)},
+		{WorkoutID: 2, EntryID: 20, ExerciseName: "Bench Press", PerformedAt: day2, Reps: IntPtr(5), Weight: FloatPtr(70)},
+	}
+
+	records := computePersonalRecords(sets)
+
+	byType := map[string][]*PersonalRecord{}
+	for _, record := range records {
+		byType[record.RecordType] = append(byType[record.RecordType], record)
+	}
+
+	// 60kg and then 70kg in the first workout, nothing heavier in the second
+	assert.Len(t, byType[RecordMaxWeight], 2)
+	assert.Equal(t, 70.0, byType[RecordMaxWeight][1].Value)
+
+	// 60x10 -> 80, 70x8 -> 88.67, 60x12 -> 84 is not better
+	assert.Len(t, byType[RecordEstimated1RM], 2)
+	assert.Equal(t, 88.67, byType[RecordEstimated1RM][1].Value)
+
+	// the first sets at 60kg and 70kg only set the bar, 12 reps at 60kg beat it
+	assert.Len(t, byType[RecordMaxReps], 1)
+	assert.Equal(t, 20, byType[RecordMaxReps][0].WorkoutEntryID)
+	assert.Equal(t, FloatPtr(60), byType[RecordMaxReps][0].Weight)
+
+	// 1160kg of volume in the first workout, 1070kg in the second is less
+	assert.Len(t, byType[RecordMaxVolume], 1)
+	assert.Equal(t, 1160.0, byType[RecordMaxVolume][0].Value)
+	assert.Equal(t, 1, byType[RecordMaxVolume][0].WorkoutID)
+
+	assert.Empty(t, byType[RecordMaxDuration])
+}
+
+func TestEpley(t *testing.T) {
+	assert.Equal(t, 100.0, epley(100, 1))
+	assert.InDelta(t, 116.67, epley(100, 5), 0.01)
+}
@@ -0,0 +1,520 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// progression rules that turn template targets into concrete weights
+const (
+	ProgressionNone               = "none"
+	ProgressionPercentTrainingMax = "percent_training_max"
+	ProgressionLinear             = "linear"
+)
+
+const (
+	// 5/3/1 style training max, a percentage of the estimated one rep max
+	defaultTrainingMaxPercent = 0.9
+	// target weights are rounded to what can be loaded with the smallest plates
+	weightIncrement = 2.5
+)
+
+type Program struct {
+	ID          int              `json:"id"`
+	UserID      int              `json:"user_id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Weeks       int              `json:"weeks"`
+	Sessions    []ProgramSession `json:"sessions"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// ProgramSession schedules a template on a day (1-7) of a week of the program
+type ProgramSession struct {
+	ID          int         `json:"id"`
+	Week        int         `json:"week"`
+	Day         int         `json:"day"`
+	TemplateID  int         `json:"template_id"`
+	Progression Progression `json:"progression"`
+}
+
+type Progression struct {
+	Type string `json:"type"`
+	// percentage of the training max, used by percent_training_max
+	Percent *float64 `json:"percent,omitempty"`
+	// percentage of the estimated one rep max that is used as training max
+	TrainingMaxPercent *float64 `json:"training_max_percent,omitempty"`
+	// weight that is added every week, used by linear
+	Increment *float64 `json:"increment,omitempty"`
+}
+
+type Enrollment struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ProgramID int       `json:"program_id"`
+	StartDate time.Time `json:"start_date"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ScheduledSession struct {
+	ProgramID   int              `json:"program_id"`
+	ProgramName string           `json:"program_name"`
+	Week        int              `json:"week"`
+	Day         int              `json:"day"`
+	Date        time.Time        `json:"date"`
+	TemplateID  int              `json:"template_id"`
+	Name        string           `json:"name"`
+	Entries     []ScheduledEntry `json:"entries"`
+}
+
+type ScheduledEntry struct {
+	ExerciseID      *int     `json:"exercise_id"`
+	ExerciseName    string   `json:"exercise_name"`
+	Sets            int      `json:"sets"`
+	TargetRepsMin   *int     `json:"target_reps_min"`
+	TargetRepsMax   *int     `json:"target_reps_max"`
+	TargetWeight    *float64 `json:"target_weight"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Notes           string   `json:"notes"`
+	OrderIndex      int      `json:"order_index"`
+}
+
+// ExerciseBests are the current records of an exercise that progressions are based on
+type ExerciseBests struct {
+	Estimated1RM float64
+	MaxWeight    float64
+}
+
+type PostgresProgramStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProgramStore(db *sql.DB) *PostgresProgramStore {
+	return &PostgresProgramStore{
+		db: db,
+	}
+}
+
+type ProgramStore interface {
+	CreateProgram(*Program) (*Program, error)
+	GetProgramByID(id int64) (*Program, error)
+	ListPrograms() ([]*Program, error)
+	DeleteProgram(id int64) error
+	Enroll(userID int, programID int64, startDate time.Time) (*Enrollment, error)
+	Unenroll(userID int, programID int64) error
+	GetEnrollments(userID int) ([]*Enrollment, error)
+}
+
+func (pg *PostgresProgramStore) CreateProgram(program *Program) (*Program, error) {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO programs (user_id, name, description, weeks)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, program.UserID, program.Name, program.Description, program.Weeks).Scan(&program.ID, &program.CreatedAt, &program.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range program.Sessions {
+		session := &program.Sessions[i]
+
+		query := `
+		INSERT INTO program_sessions (program_id, week, day, template_id, progression_type, percent, training_max_percent, increment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+		`
+
+		err := tx.QueryRow(query,
+			program.ID,
+			session.Week,
+			session.Day,
+			session.TemplateID,
+			session.Progression.Type,
+			session.Progression.Percent,
+			session.Progression.TrainingMaxPercent,
+			session.Progression.Increment,
+		).Scan(&session.ID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+func (pg *PostgresProgramStore) GetProgramByID(id int64) (*Program, error) {
+	program := &Program{}
+
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), weeks, created_at, updated_at
+	FROM programs
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(
+		&program.ID,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.CreatedAt,
+		&program.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.loadSessions([]*Program{program})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return program, nil
+}
+
+func (pg *PostgresProgramStore) ListPrograms() ([]*Program, error) {
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), weeks, created_at, updated_at
+	FROM programs
+	ORDER BY name, id
+	`
+
+	rows, err := pg.db.Query(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	programs := []*Program{}
+
+	for rows.Next() {
+		program := &Program{}
+
+		err := rows.Scan(
+			&program.ID,
+			&program.UserID,
+			&program.Name,
+			&program.Description,
+			&program.Weeks,
+			&program.CreatedAt,
+			&program.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		programs = append(programs, program)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.loadSessions(programs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return programs, nil
+}
+
+func (pg *PostgresProgramStore) DeleteProgram(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM programs WHERE id = $1`, id)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Enroll starts a program for a user, enrolling again moves the start date
+func (pg *PostgresProgramStore) Enroll(userID int, programID int64, startDate time.Time) (*Enrollment, error) {
+	enrollment := &Enrollment{
+		UserID:    userID,
+		ProgramID: int(programID),
+	}
+
+	query := `
+	INSERT INTO program_enrollments (user_id, program_id, start_date)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, program_id) DO UPDATE SET start_date = EXCLUDED.start_date
+	RETURNING id, start_date, created_at
+	`
+
+	err := pg.db.QueryRow(query, userID, programID, startDate).Scan(&enrollment.ID, &enrollment.StartDate, &enrollment.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment, nil
+}
+
+func (pg *PostgresProgramStore) Unenroll(userID int, programID int64) error {
+	result, err := pg.db.Exec(`DELETE FROM program_enrollments WHERE user_id = $1 AND program_id = $2`, userID, programID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (pg *PostgresProgramStore) GetEnrollments(userID int) ([]*Enrollment, error) {
+	query := `
+	SELECT id, user_id, program_id, start_date, created_at
+	FROM program_enrollments
+	WHERE user_id = $1
+	ORDER BY start_date
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	enrollments := []*Enrollment{}
+
+	for rows.Next() {
+		enrollment := &Enrollment{}
+
+		err := rows.Scan(&enrollment.ID, &enrollment.UserID, &enrollment.ProgramID, &enrollment.StartDate, &enrollment.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		enrollments = append(enrollments, enrollment)
+	}
+
+	return enrollments, rows.Err()
+}
+
+func (pg *PostgresProgramStore) loadSessions(programs []*Program) error {
+	if len(programs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(programs))
+	byID := make(map[int]*Program, len(programs))
+
+	for _, program := range programs {
+		program.Sessions = []ProgramSession{}
+		ids = append(ids, int64(program.ID))
+		byID[program.ID] = program
+	}
+
+	query := `
+	SELECT program_id, id, week, day, template_id, progression_type, percent, training_max_percent, increment
+	FROM program_sessions
+	WHERE program_id = ANY($1)
+	ORDER BY program_id, week, day
+	`
+
+	rows, err := pg.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var programID int
+		var session ProgramSession
+
+		err := rows.Scan(
+			&programID,
+			&session.ID,
+			&session.Week,
+			&session.Day,
+			&session.TemplateID,
+			&session.Progression.Type,
+			&session.Progression.Percent,
+			&session.Progression.TrainingMaxPercent,
+			&session.Progression.Increment,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if program, ok := byID[programID]; ok {
+			program.Sessions = append(program.Sessions, session)
+		}
+	}
+
+	return rows.Err()
+}
+
+// CurrentBests indexes the current records by lower case exercise name
+func CurrentBests(records []*PersonalRecord) map[string]ExerciseBests {
+	bests := map[string]ExerciseBests{}
+
+	for _, record := range records {
+		key := strings.ToLower(record.ExerciseName)
+		best := bests[key]
+
+		switch record.RecordType {
+		case RecordEstimated1RM:
+			best.Estimated1RM = math.Max(best.Estimated1RM, record.Value)
+		case RecordMaxWeight:
+			best.MaxWeight = math.Max(best.MaxWeight, record.Value)
+		}
+
+		bests[key] = best
+	}
+
+	return bests
+}
+
+// Schedule returns the sessions of an enrollment that fall between from and to
+// (inclusive) with the target weights worked out from the current records.
+// Linear progression adds up from the records at the start of the enrollment,
+// otherwise every new record would move all the following weeks up as well
+func (p *Program) Schedule(enrollment *Enrollment, templates map[int]*Template, bests, startBests map[string]ExerciseBests, from, to time.Time) []ScheduledSession {
+	sessions := []ScheduledSession{}
+
+	for _, session := range p.Sessions {
+		date := enrollment.StartDate.AddDate(0, 0, (session.Week-1)*7+session.Day-1)
+
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+
+		template, ok := templates[session.TemplateID]
+
+		if !ok {
+			continue
+		}
+
+		scheduled := ScheduledSession{
+			ProgramID:   p.ID,
+			ProgramName: p.Name,
+			Week:        session.Week,
+			Day:         session.Day,
+			Date:        date,
+			TemplateID:  template.ID,
+			Name:        template.Name,
+			Entries:     []ScheduledEntry{},
+		}
+
+		for _, entry := range template.Entries {
+			key := strings.ToLower(entry.ExerciseName)
+
+			scheduled.Entries = append(scheduled.Entries, ScheduledEntry{
+				ExerciseID:      entry.ExerciseID,
+				ExerciseName:    entry.ExerciseName,
+				Sets:            entry.Sets,
+				TargetRepsMin:   entry.TargetRepsMin,
+				TargetRepsMax:   entry.TargetRepsMax,
+				TargetWeight:    session.Progression.targetWeight(entry, session.Week, bests[key], startBests[key]),
+				DurationSeconds: entry.DurationSeconds,
+				Notes:           entry.Notes,
+				OrderIndex:      entry.OrderIndex,
+			})
+		}
+
+		sessions = append(sessions, scheduled)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Date.Before(sessions[j].Date)
+	})
+
+	return sessions
+}
+
+func (p Progression) targetWeight(entry TemplateEntry, week int, best, startBest ExerciseBests) *float64 {
+	switch p.Type {
+	case ProgressionPercentTrainingMax:
+		// without a record there is no training max, fall back to the template
+		if p.Percent == nil || best.Estimated1RM == 0 {
+			return entry.TargetWeightMin
+		}
+
+		trainingMaxPercent := defaultTrainingMaxPercent
+		if p.TrainingMaxPercent != nil {
+			trainingMaxPercent = *p.TrainingMaxPercent
+		}
+
+		weight := roundWeight(best.Estimated1RM * trainingMaxPercent * *p.Percent)
+		return &weight
+	case ProgressionLinear:
+		// progress from your heaviest weight when you started, the template
+		// target is only for exercises without a record
+		base := startBest.MaxWeight
+		if base == 0 && entry.TargetWeightMin != nil {
+			base = *entry.TargetWeightMin
+		}
+
+		if p.Increment == nil || base == 0 {
+			return entry.TargetWeightMin
+		}
+
+		weight := roundWeight(base + *p.Increment*float64(week-1))
+		return &weight
+	default:
+		return entry.TargetWeightMin
+	}
+}
+
+func roundWeight(weight float64) float64 {
+	return math.Round(weight/weightIncrement) * weightIncrement
+}
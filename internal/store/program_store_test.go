@@ -0,0 +1,76 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgramSchedule(t *testing.T) {
+	squatDay := &Template{
+		ID:   1,
+		Name: "Squat day",
+		Entries: []TemplateEntry{
+			{ExerciseName: "Back Squat", Sets: 3, TargetRepsMin: IntPtr(5), TargetWeightMin: FloatPtr(80), OrderIndex: 1},
+		},
+	}
+
+	program := &Program{
+		ID:    1,
+		Name:  "5/3/1",
+		Weeks: 3,
+		Sessions: []ProgramSession{
+			{Week: 1, Day: 1, TemplateID: 1, Progression: Progression{Type: ProgressionPercentTrainingMax, Percent: FloatPtr(0.85)}},
+			{Week: 2, Day: 1, TemplateID: 1, Progression: Progression{Type: ProgressionPercentTrainingMax, Percent: FloatPtr(0.90)}},
+			{Week: 3, Day: 1, TemplateID: 1, Progression: Progression{Type: ProgressionLinear, Increment: FloatPtr(2.5)}},
+		},
+	}
+
+	start := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	enrollment := &Enrollment{ProgramID: 1, StartDate: start}
+	templates := map[int]*Template{1: squatDay}
+	bests := map[string]ExerciseBests{"back squat": {Estimated1RM: 140, MaxWeight: 120}}
+
+	t.Run("target weights", func(t *testing.T) {
+		schedule := program.Schedule(enrollment, templates, bests, bests, start, start.AddDate(0, 0, 21))
+
+		require.Len(t, schedule, 3)
+		assert.Equal(t, start.AddDate(0, 0, 7), schedule[1].Date)
+
+		// 140 * 0.9 = 126 training max
+		assert.Equal(t, FloatPtr(107.5), schedule[0].Entries[0].TargetWeight)
+		assert.Equal(t, FloatPtr(112.5), schedule[1].Entries[0].TargetWeight)
+		// heaviest weight + 2 weeks of 2.5kg
+		assert.Equal(t, FloatPtr(125), schedule[2].Entries[0].TargetWeight)
+	})
+
+	t.Run("without records the template target is used", func(t *testing.T) {
+		schedule := program.Schedule(enrollment, templates, nil, nil, start, start)
+
+		require.Len(t, schedule, 1)
+		assert.Equal(t, FloatPtr(80), schedule[0].Entries[0].TargetWeight)
+	})
+
+	t.Run("linear progression without records starts from the template target", func(t *testing.T) {
+		week3 := start.AddDate(0, 0, 14)
+		schedule := program.Schedule(enrollment, templates, nil, nil, week3, week3)
+
+		require.Len(t, schedule, 1)
+		// template target + 2 weeks of 2.5kg
+		assert.Equal(t, FloatPtr(85), schedule[0].Entries[0].TargetWeight)
+	})
+
+	t.Run("linear progression does not compound with new records", func(t *testing.T) {
+		week3 := start.AddDate(0, 0, 14)
+		// the record went from 120 to 122.5 by following week 2
+		moved := map[string]ExerciseBests{"back squat": {Estimated1RM: 145, MaxWeight: 122.5}}
+
+		schedule := program.Schedule(enrollment, templates, moved, bests, week3, week3)
+
+		require.Len(t, schedule, 1)
+		// still 120 at the start + 2 weeks of 2.5kg
+		assert.Equal(t, FloatPtr(125), schedule[0].Entries[0].TargetWeight)
+	})
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+)
+
+type PostgresRevocationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{
+		db: db,
+	}
+}
+
+// RevocationStore shares the JWT deny list between the instances of the api
+type RevocationStore interface {
+	Revoke(rev *tokens.Revocation) error
+	ListRevocations() ([]tokens.Revocation, error)
+	DeleteExpiredRevocations() error
+}
+
+func (pg *PostgresRevocationStore) Revoke(rev *tokens.Revocation) error {
+	query := `
+	INSERT INTO jwt_revocations (jti, family_id, user_id, expiry)
+	VALUES (NULLIF($1, ''), NULLIF($2, ''), NULLIF($3, 0), $4)
+	RETURNING revoked_at
+	`
+
+	return pg.db.QueryRow(query, rev.JTI, rev.FamilyID, rev.UserID, rev.Expiry).Scan(&rev.RevokedAt)
+}
+
+// ListRevocations returns the revocations that still revoke tokens that didn't expire
+func (pg *PostgresRevocationStore) ListRevocations() ([]tokens.Revocation, error) {
+	query := `
+	SELECT COALESCE(jti, ''), COALESCE(family_id, ''), COALESCE(user_id, 0), revoked_at, expiry
+	FROM jwt_revocations
+	WHERE expiry > $1
+	`
+
+	rows, err := pg.db.Query(query, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revs := []tokens.Revocation{}
+
+	for rows.Next() {
+		var rev tokens.Revocation
+
+		err := rows.Scan(&rev.JTI, &rev.FamilyID, &rev.UserID, &rev.RevokedAt, &rev.Expiry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		revs = append(revs, rev)
+	}
+
+	return revs, rows.Err()
+}
+
+func (pg *PostgresRevocationStore) DeleteExpiredRevocations() error {
+	_, err := pg.db.Exec(`DELETE FROM jwt_revocations WHERE expiry <= $1`, time.Now())
+
+	return err
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+)
+
+// the length of the start of a share token that is kept to recognize it by
+const shareTokenPrefixLength = 8
+
+// WorkoutShare is a link anyone can view a workout with, until it is revoked
+type WorkoutShare struct {
+	ID        int64 `json:"id"`
+	WorkoutID int64 `json:"workout_id"`
+	// Token is only filled in right after creating the share
+	Token     string    `json:"token,omitempty"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostgresShareStore struct {
+	db *sql.DB
+}
+
+func NewPostgresShareStore(db *sql.DB) *PostgresShareStore {
+	return &PostgresShareStore{
+		db: db,
+	}
+}
+
+type ShareStore interface {
+	CreateShare(*WorkoutShare) error
+	ListShares(workoutID int64) ([]*WorkoutShare, error)
+	DeleteShare(workoutID, id int64) error
+	GetSharedWorkoutID(plaintext string) (int64, error)
+}
+
+// CreateShare generates the token, it is returned once in Token and only its
+// hash is stored
+func (pg *PostgresShareStore) CreateShare(share *WorkoutShare) error {
+	plaintext, err := tokens.GenerateShareToken()
+
+	if err != nil {
+		return err
+	}
+
+	share.Token = plaintext
+	share.Prefix = plaintext[:shareTokenPrefixLength]
+
+	query := `
+	INSERT INTO workout_shares (workout_id, prefix, hash)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`
+
+	return pg.db.QueryRow(query, share.WorkoutID, share.Prefix, tokens.Hash(plaintext)).Scan(&share.ID, &share.CreatedAt)
+}
+
+func (pg *PostgresShareStore) ListShares(workoutID int64) ([]*WorkoutShare, error) {
+	query := `
+	SELECT id, workout_id, prefix, created_at
+	FROM workout_shares
+	WHERE workout_id = $1
+	ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := pg.db.Query(query, workoutID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	shares := []*WorkoutShare{}
+
+	for rows.Next() {
+		share := &WorkoutShare{}
+
+		err := rows.Scan(&share.ID, &share.WorkoutID, &share.Prefix, &share.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// DeleteShare revokes a share link of the workout
+func (pg *PostgresShareStore) DeleteShare(workoutID, id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM workout_shares WHERE id = $1 AND workout_id = $2`, id, workoutID)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetSharedWorkoutID returns the workout of a share token, it is 0 when there
+// is no such share or the workout was made private since
+func (pg *PostgresShareStore) GetSharedWorkoutID(plaintext string) (int64, error) {
+	var workoutID int64
+
+	query := `
+	SELECT s.workout_id
+	FROM workout_shares s
+	INNER JOIN workouts w ON w.id = s.workout_id
+	WHERE s.hash = $1 AND w.visibility <> $2
+	`
+
+	err := pg.db.QueryRow(query, tokens.Hash(plaintext), VisibilityPrivate).Scan(&workoutID)
+
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return workoutID, err
+}
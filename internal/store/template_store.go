@@ -0,0 +1,448 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var ErrTemplateInUse = errors.New("template is used by a program")
+
+type Template struct {
+	ID              int             `json:"id"`
+	UserID          int             `json:"user_id"`
+	Name            string          `json:"name"`
+	Description     string          `json:"description"`
+	DurationMinutes int             `json:"duration_minutes"`
+	Entries         []TemplateEntry `json:"entries"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// TemplateEntry is shaped like a WorkoutEntry but holds target ranges
+type TemplateEntry struct {
+	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
+	ExerciseName    string   `json:"exercise_name"`
+	Sets            int      `json:"sets"`
+	TargetRepsMin   *int     `json:"target_reps_min"`
+	TargetRepsMax   *int     `json:"target_reps_max"`
+	TargetWeightMin *float64 `json:"target_weight_min"`
+	TargetWeightMax *float64 `json:"target_weight_max"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Notes           string   `json:"notes"`
+	OrderIndex      int      `json:"order_index"`
+}
+
+type PostgresTemplateStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTemplateStore(db *sql.DB) *PostgresTemplateStore {
+	return &PostgresTemplateStore{
+		db: db,
+	}
+}
+
+type TemplateStore interface {
+	CreateTemplate(*Template) (*Template, error)
+	GetTemplateByID(id int64) (*Template, error)
+	ListTemplates(userID int) ([]*Template, error)
+	UpdateTemplate(*Template) error
+	DeleteTemplate(id int64) error
+	GetLastPerformedWeights(userID int, templateID int64) (map[string]float64, error)
+}
+
+func (pg *PostgresTemplateStore) CreateTemplate(template *Template) (*Template, error) {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO templates (user_id, name, description, duration_minutes)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, template.UserID, template.Name, template.Description, template.DurationMinutes).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTemplateEntries(tx, template)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) GetTemplateByID(id int64) (*Template, error) {
+	template := &Template{}
+
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), duration_minutes, created_at, updated_at
+	FROM templates
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, id).Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&template.DurationMinutes,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = pg.loadTemplateEntries([]*Template{template})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (pg *PostgresTemplateStore) ListTemplates(userID int) ([]*Template, error) {
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), duration_minutes, created_at, updated_at
+	FROM templates
+	WHERE user_id = $1
+	ORDER BY name, id
+	`
+
+	rows, err := pg.db.Query(query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	templates := []*Template{}
+
+	for rows.Next() {
+		template := &Template{}
+
+		err := rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Name,
+			&template.Description,
+			&template.DurationMinutes,
+			&template.CreatedAt,
+			&template.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = pg.loadTemplateEntries(templates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (pg *PostgresTemplateStore) UpdateTemplate(template *Template) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	UPDATE templates
+	SET name = $1, description = $2, duration_minutes = $3, updated_at = NOW()
+	WHERE id = $4
+	RETURNING updated_at
+	`
+
+	err = tx.QueryRow(query, template.Name, template.Description, template.DurationMinutes, template.ID).Scan(&template.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM template_entries WHERE template_id = $1`, template.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertTemplateEntries(tx, template)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTemplate returns ErrTemplateInUse while a program has a session with
+// the template
+func (pg *PostgresTemplateStore) DeleteTemplate(id int64) error {
+	result, err := pg.db.Exec(`DELETE FROM templates WHERE id = $1`, id)
+
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		return ErrTemplateInUse
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetLastPerformedWeights returns the heaviest completed weight per exercise of
+// the most recent workout that was started from the template, keyed by the
+// lower case exercise name
+func (pg *PostgresTemplateStore) GetLastPerformedWeights(userID int, templateID int64) (map[string]float64, error) {
+	query := `
+	SELECT LOWER(we.exercise_name), MAX(s.weight)
+	FROM workout_entries we
+	INNER JOIN workout_sets s ON s.workout_entry_id = we.id
+	WHERE we.workout_id = (
+		SELECT w.id
+		FROM workouts w
+		WHERE w.user_id = $1 AND w.template_id = $2
+			AND EXISTS (
+				SELECT 1 FROM workout_entries e
+				INNER JOIN workout_sets cs ON cs.workout_entry_id = e.id
+				WHERE e.workout_id = w.id AND cs.completed
+			)
+		ORDER BY w.performed_at DESC, w.id DESC
+		LIMIT 1
+	) AND s.completed AND s.weight IS NOT NULL
+	GROUP BY LOWER(we.exercise_name)
+	`
+
+	rows, err := pg.db.Query(query, userID, templateID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	weights := map[string]float64{}
+
+	for rows.Next() {
+		var name string
+		var weight float64
+
+		err := rows.Scan(&name, &weight)
+
+		if err != nil {
+			return nil, err
+		}
+
+		weights[name] = weight
+	}
+
+	return weights, rows.Err()
+}
+
+func insertTemplateEntries(tx *sql.Tx, template *Template) error {
+	for i := range template.Entries {
+		entry := &template.Entries[i]
+
+		query := `
+		INSERT INTO template_entries (template_id, exercise_id, exercise_name, sets, target_reps_min, target_reps_max,
+			target_weight_min, target_weight_max, duration_seconds, notes, order_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+		`
+
+		err := tx.QueryRow(query,
+			template.ID,
+			entry.ExerciseID,
+			entry.ExerciseName,
+			entry.Sets,
+			entry.TargetRepsMin,
+			entry.TargetRepsMax,
+			entry.TargetWeightMin,
+			entry.TargetWeightMax,
+			entry.DurationSeconds,
+			entry.Notes,
+			entry.OrderIndex,
+		).Scan(&entry.ID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pg *PostgresTemplateStore) loadTemplateEntries(templates []*Template) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(templates))
+	byID := make(map[int]*Template, len(templates))
+
+	for _, template := range templates {
+		template.Entries = []TemplateEntry{}
+		ids = append(ids, int64(template.ID))
+		byID[template.ID] = template
+	}
+
+	query := `
+	SELECT template_id, id, exercise_id, exercise_name, sets, target_reps_min, target_reps_max,
+		target_weight_min, target_weight_max, duration_seconds, COALESCE(notes, ''), order_index
+	FROM template_entries
+	WHERE template_id = ANY($1)
+	ORDER BY template_id, order_index
+	`
+
+	rows, err := pg.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var templateID int
+		var entry TemplateEntry
+
+		err := rows.Scan(
+			&templateID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Sets,
+			&entry.TargetRepsMin,
+			&entry.TargetRepsMax,
+			&entry.TargetWeightMin,
+			&entry.TargetWeightMax,
+			&entry.DurationSeconds,
+			&entry.Notes,
+			&entry.OrderIndex,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if template, ok := byID[templateID]; ok {
+			template.Entries = append(template.Entries, entry)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Instantiate builds a workout from the template. The sets are not completed
+// yet so they don't count towards records until they are actually performed.
+// Weights of lastWeights, keyed by lower case exercise name, win over the
+// template targets.
+func (t *Template) Instantiate(lastWeights map[string]float64) *Workout {
+	workout := &Workout{
+		UserID:          t.UserID,
+		Title:           t.Name,
+		Description:     t.Description,
+		DurationMinutes: t.DurationMinutes,
+		Entries:         []WorkoutEntry{},
+	}
+
+	templateID := t.ID
+	workout.TemplateID = &templateID
+
+	for _, templateEntry := range t.Entries {
+		entry := WorkoutEntry{
+			ExerciseID:   templateEntry.ExerciseID,
+			ExerciseName: templateEntry.ExerciseName,
+			Notes:        templateEntry.Notes,
+			OrderIndex:   templateEntry.OrderIndex,
+		}
+
+		reps := templateEntry.TargetRepsMin
+		if reps == nil {
+			reps = templateEntry.TargetRepsMax
+		}
+
+		weight := templateEntry.TargetWeightMin
+		if lastWeight, ok := lastWeights[strings.ToLower(templateEntry.ExerciseName)]; ok {
+			weight = &lastWeight
+		}
+
+		duration := templateEntry.DurationSeconds
+		if reps != nil {
+			duration = nil
+		}
+
+		sets := templateEntry.Sets
+		if sets < 1 {
+			sets = 1
+		}
+
+		for i := 0; i < sets; i++ {
+			entry.Sets = append(entry.Sets, WorkoutSet{
+				SetType:         SetTypeWorking,
+				Reps:            reps,
+				Weight:          weight,
+				DurationSeconds: duration,
+				Completed:       false,
+			})
+		}
+
+		workout.Entries = append(workout.Entries, entry)
+	}
+
+	return workout
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateInstantiate(t *testing.T) {
+	template := &Template{
+		ID:              7,
+		UserID:          3,
+		Name:            "Push day",
+		DurationMinutes: 60,
+		Entries: []TemplateEntry{
+			{ExerciseName: "Bench Press", Sets: 3, TargetRepsMin: IntPtr(8), TargetRepsMax: IntPtr(12), TargetWeightMin: FloatPtr(60), OrderIndex: 1},
+			{ExerciseName: "Plank", Sets: 2, DurationSeconds: IntPtr(60), OrderIndex: 2},
+		},
+	}
+
+	t.Run("targets from the template", func(t *testing.T) {
+		workout := template.Instantiate(nil)
+
+		assert.Equal(t, "Push day", workout.Title)
+		assert.Equal(t, 3, workout.UserID)
+		require.NotNil(t, workout.TemplateID)
+		assert.Equal(t, 7, *workout.TemplateID)
+		require.Len(t, workout.Entries, 2)
+
+		bench := workout.Entries[0]
+		require.Len(t, bench.Sets, 3)
+		assert.Equal(t, IntPtr(8), bench.Sets[0].Reps)
+		assert.Equal(t, FloatPtr(60), bench.Sets[0].Weight)
+		assert.False(t, bench.Sets[0].Completed)
+
+		plank := workout.Entries[1]
+		require.Len(t, plank.Sets, 2)
+		assert.Nil(t, plank.Sets[0].Reps)
+		assert.Equal(t, IntPtr(60), plank.Sets[0].DurationSeconds)
+	})
+
+	t.Run("carry forward weights", func(t *testing.T) {
+		workout := template.Instantiate(map[string]float64{"bench press": 72.5})
+
+		assert.Equal(t, FloatPtr(72.5), workout.Entries[0].Sets[0].Weight)
+	})
+}
@@ -17,10 +17,40 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	}
 }
 
+// Session is a login as its owner gets to see it, it lives as long as the
+// refresh token of its token family
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
+}
+
+// RefreshTokenReusedError means a refresh token was presented after it was
+// rotated, the family is revoked because the token probably leaked
+type RefreshTokenReusedError struct {
+	UserID   int
+	FamilyID string
+}
+
+func (e *RefreshTokenReusedError) Error() string {
+	return "refresh token was already used"
+}
+
 type TokenStore interface {
 	Insert(token *tokens.Token) error
+	InsertPair(pair *tokens.Pair) error
 	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	RotateRefreshToken(plaintext string, next func(userID int, familyID string) (*tokens.Pair, error)) (*tokens.Pair, error)
+	GetTokenFamily(plaintext string) (string, error)
+	DeleteTokenFamily(plaintext string) error
+	DeleteFamily(familyID string) error
 	DeleteAllTokensForUser(userID int, scope string) error
+	TouchToken(plaintext string) error
+	ListSessions(userID int, currentFamilyID string) ([]*Session, error)
 }
 
 func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
@@ -36,12 +66,173 @@ func (t *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope
 }
 
 func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+	return insertToken(t.db, token)
+}
+
+// execer is what a *sql.DB and a *sql.Tx have in common
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertToken(db execer, token *tokens.Token) error {
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope, family_id, user_agent, ip)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+	`
+
+	_, err := db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope, token.FamilyID, token.UserAgent, token.IP)
+	return err
+}
+
+func (t *PostgresTokenStore) InsertPair(pair *tokens.Pair) error {
+	tx, err := t.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = insertPair(tx, pair)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertPair skips the stateless tokens, they are never looked up
+func insertPair(db execer, pair *tokens.Pair) error {
+	for _, token := range []*tokens.Token{pair.Access, pair.Refresh} {
+		if token.Stateless {
+			continue
+		}
+
+		err := insertToken(db, token)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the refresh token as used and stores the next pair
+// of its family that next creates. It returns nil when the token is unknown,
+// expired or belongs to a disabled user, and a RefreshTokenReusedError after
+// revoking the family when it was used before.
+func (t *PostgresTokenStore) RotateRefreshToken(plaintext string, next func(userID int, familyID string) (*tokens.Pair, error)) (*tokens.Pair, error) {
+	tx, err := t.db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var userID int
+	var familyID string
+	var usedAt *time.Time
+
+	// the row lock makes two refreshes with the same token wait for each other
+	query := `
+	SELECT user_id, family_id, used_at
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3 AND family_id IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = tokens.user_id AND u.disabled_at IS NOT NULL)
+	FOR UPDATE
+	`
+
+	err = tx.QueryRow(query, tokens.Hash(plaintext), tokens.ScopeRefresh, time.Now()).Scan(&userID, &familyID, &usedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(`DELETE FROM tokens WHERE family_id = $1`, familyID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &RefreshTokenReusedError{UserID: userID, FamilyID: familyID}
+	}
+
+	// rotated tokens are kept until they expire so a reuse can be detected
+	_, err = tx.Exec(`UPDATE tokens SET used_at = NOW() WHERE hash = $1`, tokens.Hash(plaintext))
+
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := next(userID, familyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertPair(tx, pair)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// GetTokenFamily returns the family of a token, it is empty for unknown tokens
+// and tokens from before the families
+func (t *PostgresTokenStore) GetTokenFamily(plaintext string) (string, error) {
+	var familyID *string
+
+	err := t.db.QueryRow(`SELECT family_id FROM tokens WHERE hash = $1`, tokens.Hash(plaintext)).Scan(&familyID)
+
+	if err == sql.ErrNoRows || familyID == nil {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return *familyID, nil
+}
+
+func (t *PostgresTokenStore) DeleteFamily(familyID string) error {
+	_, err := t.db.Exec(`DELETE FROM tokens WHERE family_id = $1`, familyID)
+
+	return err
+}
+
+// DeleteTokenFamily logs out a single session, the token and every other
+// token of its family are revoked
+func (t *PostgresTokenStore) DeleteTokenFamily(plaintext string) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)
+	DELETE FROM tokens
+	WHERE hash = $1 OR family_id = (SELECT family_id FROM tokens WHERE hash = $1)
 	`
 
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err := t.db.Exec(query, tokens.Hash(plaintext))
+
 	return err
 }
 
@@ -55,3 +246,68 @@ func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) er
 
 	return err
 }
+
+// lastUsedPrecision keeps TouchToken from writing on every single request
+const lastUsedPrecision = time.Minute
+
+// TouchToken records that the token was just used
+func (t *PostgresTokenStore) TouchToken(plaintext string) error {
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW()
+	WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < $2)
+	`
+
+	_, err := t.db.Exec(query, tokens.Hash(plaintext), time.Now().Add(-lastUsedPrecision))
+
+	return err
+}
+
+// ListSessions returns a session per token family of the user that can still
+// be refreshed, the most recently used first. A refresh counts as a use, JWT
+// access tokens are never touched.
+func (t *PostgresTokenStore) ListSessions(userID int, currentFamilyID string) ([]*Session, error) {
+	query := `
+	SELECT r.id, MIN(f.created_at), GREATEST(MAX(f.last_used_at), MAX(f.created_at)), r.expiry, r.user_agent, r.ip,
+		r.family_id = $4
+	FROM tokens r
+	INNER JOIN tokens f ON f.family_id = r.family_id
+	WHERE r.user_id = $1 AND r.scope = $2 AND r.used_at IS NULL AND r.expiry > $3
+	GROUP BY r.hash
+	ORDER BY GREATEST(MAX(f.last_used_at), MAX(f.created_at)) DESC, r.id DESC
+	`
+
+	rows, err := t.db.Query(query, userID, tokens.ScopeRefresh, time.Now(), currentFamilyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		session := &Session{}
+		var current bool
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.IP,
+			&current,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		session.Current = current
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
@@ -1,11 +1,14 @@
 package store
 
 import (
-	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/edwinboon/workout-tracking-api/internal/tokens"
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -15,31 +18,114 @@ type password struct {
 }
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"-"` // Don't include password hash in JSON response
-	Bio          string    `json:"bio"`
-	AvatarURL    string    `json:"avatar_url"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	PasswordHash    password   `json:"-"` // Don't include password hash in JSON response
+	Bio             string     `json:"bio"`
+	AvatarURL       string     `json:"avatar_url"`
+	Activated       bool       `json:"activated"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Role            string     `json:"role"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
+// UserProfile is the part of a user that everyone can see
+type UserProfile struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatar_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// the roles of a user, see the authz package for what they may do
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleCoach, RoleAdmin}
+
 var AnonymousUser = &User{}
 
+var (
+	ErrDuplicateUsername = errors.New("username is already taken")
+	ErrDuplicateEmail    = errors.New("email is already in use")
+)
+
+// postgres error codes of a unique and a foreign key constraint violation
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u *User) Profile() *UserProfile {
+	return &UserProfile{
+		ID:        u.ID,
+		Username:  u.Username,
+		Bio:       u.Bio,
+		AvatarURL: u.AvatarURL,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// userConstraintError turns the unique violations of the users table into
+// errors that tell which field is taken
+func userConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case "users_username_key":
+		return ErrDuplicateUsername
+	case "users_email_key":
+		return ErrDuplicateEmail
+	}
+
+	return err
+}
+
 type PostgresUserStore struct {
 	db *sql.DB
 }
 
 type UserStore interface {
 	CreateUser(*User) error
+	GetUserByID(id int) (*User, error)
 	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
 	UpdateUser(*User) error
+	UpdatePassword(*User) error
+	ActivateUser(*User) error
 	GetUserToken(scope, tokenPlainText string) (*User, error)
+	SearchUsers(filter UserFilter) ([]*User, int, error)
+	SetUserRole(user *User, role string) error
+	SetUserDisabled(user *User, disabled bool) error
+}
+
+// UserFilter searches users for the admin api, empty fields match everyone
+type UserFilter struct {
+	// Query matches a part of the username or email
+	Query    string
+	Role     string
+	Disabled *bool
+	Limit    int
+	Offset   int
 }
 
 func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
@@ -50,40 +136,46 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 func (s *PostgresUserStore) CreateUser(user *User) error {
 	query := `
-	INSERT INTO users (username, email, password_hash, avatar_url, bio)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, created_at, updated_at
+	INSERT INTO users (username, email, password_hash, avatar_url, bio, activated)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, role, created_at, updated_at
 	`
 
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.AvatarURL, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.AvatarURL, user.Bio, user.Activated).Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		return err
+		return userConstraintError(err)
 	}
 
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
-	user := &User{
-		PasswordHash: password{},
-	}
+// userColumns are the columns userFields scans, in order
+const userColumns = `id, username, email, password_hash, avatar_url, bio, activated, email_verified_at, role, disabled_at, created_at, updated_at`
 
-	query := `
-	SELECT id, username, email, password_hash, avatar_url, bio, created_at, updated_at
-	FROM users
-	WHERE username = $1
-	`
-	err := s.db.QueryRow(query, username).Scan(
+func userFields(user *User) []interface{} {
+	return []interface{}{
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.AvatarURL,
 		&user.Bio,
+		&user.Activated,
+		&user.EmailVerifiedAt,
+		&user.Role,
+		&user.DisabledAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-	)
+	}
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	err := row.Scan(userFields(user)...)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -96,29 +188,80 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	return user, nil
 }
 
+func (s *PostgresUserStore) GetUserByID(id int) (*User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE id = $1
+	`
+
+	return scanUser(s.db.QueryRow(query, id))
+}
+
+func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE username = $1
+	`
+
+	return scanUser(s.db.QueryRow(query, username))
+}
+
+// GetUserByEmail ignores the case of the email, people don't always type it the same way
+func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users
+	WHERE LOWER(email) = LOWER($1)
+	`
+
+	return scanUser(s.db.QueryRow(query, email))
+}
+
 func (s *PostgresUserStore) UpdateUser(user *User) error {
 	query := `
 	UPDATE users
-	SET username = $1, email = $2, avatar_url = $3, bio = $4, updated_at = NOW()
-	WHERE id = $4
+	SET username = $1, email = $2, avatar_url = $3, bio = $4, activated = $5, email_verified_at = $6, updated_at = NOW()
+	WHERE id = $7
 	RETURNING updated_at
 	`
-	result, err := s.db.Exec(query, user.Username, user.Email, user.AvatarURL, user.Bio, user.ID)
+	err := s.db.QueryRow(query, user.Username, user.Email, user.AvatarURL, user.Bio, user.Activated, user.EmailVerifiedAt, user.ID).Scan(&user.UpdatedAt)
 
 	if err != nil {
-		return err
+		return userConstraintError(err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return nil
+}
+
+func (s *PostgresUserStore) UpdatePassword(user *User) error {
+	query := `
+	UPDATE users
+	SET password_hash = $1, updated_at = NOW()
+	WHERE id = $2
+	RETURNING updated_at
+	`
+
+	return s.db.QueryRow(query, user.PasswordHash.hash, user.ID).Scan(&user.UpdatedAt)
+}
+
+// ActivateUser marks the email of the user as verified
+func (s *PostgresUserStore) ActivateUser(user *User) error {
+	query := `
+	UPDATE users
+	SET activated = TRUE, email_verified_at = NOW(), updated_at = NOW()
+	WHERE id = $1
+	RETURNING email_verified_at, updated_at
+	`
+
+	err := s.db.QueryRow(query, user.ID).Scan(&user.EmailVerifiedAt, &user.UpdatedAt)
 
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
+	user.Activated = true
 	return nil
 }
 
@@ -150,38 +293,121 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// prefixColumns qualifies a list of columns with a table alias
+func prefixColumns(alias, columns string) string {
+	fields := strings.Split(columns, ", ")
+
+	for i, field := range fields {
+		fields[i] = alias + "." + field
+	}
+
+	return strings.Join(fields, ", ")
+}
+
+// GetUserToken ignores the tokens of disabled users
 func (s *PostgresUserStore) GetUserToken(scope, plainTextPassword string) (*User, error) {
-	tokenHash := sha256.Sum256([]byte(plainTextPassword))
 
 	query := `
-	SELECT u.id, u.username, u.email, u.password_hash, u.avatar_url, u.bio, u.created_at, u.updated_at
+	SELECT ` + prefixColumns("u", userColumns) + `
 	FROM users u 
 	INNER JOIN tokens t on t.user_id = u.id
-	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
+	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3 AND u.disabled_at IS NULL
 	`
 
-	user := &User{
-		PasswordHash: password{},
+	return scanUser(s.db.QueryRow(query, tokens.Hash(plainTextPassword), scope, time.Now()))
+}
+
+// SearchUsers returns a page of the users that match the filter and how many
+// match in total, the newest first
+func (s *PostgresUserStore) SearchUsers(filter UserFilter) ([]*User, int, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
 	}
 
-	err := s.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash.hash,
-		&user.AvatarURL,
-		&user.Bio,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	if filter.Query != "" {
+		addCondition("(username ILIKE '%%' || $%[1]d || '%%' OR email ILIKE '%%' || $%[1]d || '%%')", filter.Query)
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if filter.Role != "" {
+		addCondition("role = $%d", filter.Role)
+	}
+
+	if filter.Disabled != nil {
+		addCondition("(disabled_at IS NOT NULL) = $%d", *filter.Disabled)
+	}
+
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total)
+
+	if err != nil {
+		return nil, 0, err
 	}
 
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM users
+	WHERE %s
+	ORDER BY created_at DESC, id DESC
+	LIMIT $%d OFFSET $%d
+	`, userColumns, where, len(args)+1, len(args)+2)
+
+	rows, err := s.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return user, nil
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+func (s *PostgresUserStore) SetUserRole(user *User, role string) error {
+	query := `
+	UPDATE users
+	SET role = $1, updated_at = NOW()
+	WHERE id = $2
+	RETURNING updated_at
+	`
+
+	err := s.db.QueryRow(query, role, user.ID).Scan(&user.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	return nil
+}
+
+// SetUserDisabled disables or enables the account, a disabled user can't log
+// in and their tokens and api keys stop working
+func (s *PostgresUserStore) SetUserDisabled(user *User, disabled bool) error {
+	query := `
+	UPDATE users
+	SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+	WHERE id = $2
+	RETURNING disabled_at, updated_at
+	`
+
+	return s.db.QueryRow(query, disabled, user.ID).Scan(&user.DisabledAt, &user.UpdatedAt)
 }
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateUser(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresUserStore(db)
+
+	createTestUser(t, db, "taken")
+
+	tests := []struct {
+		name     string
+		username string
+		update   func(user *User)
+		wantErr  error
+	}{
+		{
+			name:     "valid update",
+			username: "original",
+			update: func(user *User) {
+				user.Username = "renamed"
+				user.Email = "renamed@example.com"
+				user.Bio = "lifting since 2015"
+			},
+		},
+		{
+			name:     "duplicate username",
+			username: "second",
+			update: func(user *User) {
+				user.Username = "taken"
+			},
+			wantErr: ErrDuplicateUsername,
+		},
+		{
+			name:     "duplicate email",
+			username: "third",
+			update: func(user *User) {
+				user.Email = "taken@example.com"
+			},
+			wantErr: ErrDuplicateEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestUser(t, db, tt.username)
+			tt.update(user)
+
+			err := store.UpdateUser(user)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+
+			retrieved, err := store.GetUserByID(user.ID)
+			require.NoError(t, err)
+
+			assert.Equal(t, "renamed", retrieved.Username)
+			assert.Equal(t, "renamed@example.com", retrieved.Email)
+			assert.Equal(t, "lifting since 2015", retrieved.Bio)
+		})
+	}
+}
@@ -1,28 +1,332 @@
 package store
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Workout struct {
-	ID              int            `json:"id"`
-	UserID          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	DurationMinutes int        `json:"duration_minutes"`
+	CaloriesBurned  int        `json:"calories_burned"`
+	TemplateID      *int       `json:"template_id"`
+	PerformedAt     time.Time  `json:"performed_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	Timezone        string     `json:"timezone"`
+	Visibility      string     `json:"visibility"`
+	// Planned workouts were planned by a coach, PlannedBy, and aren't done yet
+	Planned   bool           `json:"planned"`
+	PlannedBy *int           `json:"planned_by"`
+	Entries   []WorkoutEntry `json:"entries"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
 }
 
 type WorkoutEntry struct {
+	ID                  int          `json:"id"`
+	ExerciseID          *int         `json:"exercise_id"`
+	ExerciseName        string       `json:"exercise_name"`
+	Kind                string       `json:"kind"`
+	SetCount            int          `json:"sets"`
+	Reps                *int         `json:"reps"`
+	DurationSeconds     *int         `json:"duration_seconds"`
+	Weight              *float64     `json:"weight"`
+	DistanceMeters      *float64     `json:"distance_meters"`
+	ElevationGainMeters *float64     `json:"elevation_gain_meters"`
+	AvgHeartRate        *int         `json:"avg_heart_rate"`
+	MaxHeartRate        *int         `json:"max_heart_rate"`
+	Cadence             *int         `json:"cadence"`
+	PaceSecondsPerKm    *float64     `json:"pace_seconds_per_km"`
+	SpeedKmh            *float64     `json:"speed_kmh"`
+	Notes               string       `json:"notes"`
+	OrderIndex          int          `json:"order_index"`
+	Sets                []WorkoutSet `json:"set_details"`
+	PersonalRecords     []string     `json:"personal_records"`
+}
+
+// kinds of entries, cardio entries are logged by time and/or distance instead of reps
+const (
+	EntryKindStrength = "strength"
+	EntryKindCardio   = "cardio"
+	EntryKindMobility = "mobility"
+)
+
+// set types a single set can be logged as
+const (
+	SetTypeWarmup  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+type WorkoutSet struct {
 	ID              int      `json:"id"`
-	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
+	SetIndex        int      `json:"set_index"`
+	SetType         string   `json:"set_type"`
 	Reps            *int     `json:"reps"`
-	DurationSeconds *int     `json:"duration_seconds"`
 	Weight          *float64 `json:"weight"`
-	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	DistanceMeters  *float64 `json:"distance_meters"`
+	RPE             *float64 `json:"rpe"`
+	Completed       bool     `json:"completed"`
+}
+
+// UnmarshalJSON counts a set as completed when the client leaves completed
+// out, the same default as the column
+func (s *WorkoutSet) UnmarshalJSON(data []byte) error {
+	type setAlias WorkoutSet
+
+	aux := setAlias{Completed: true}
+
+	err := json.Unmarshal(data, &aux)
+
+	if err != nil {
+		return err
+	}
+
+	*s = WorkoutSet(aux)
+	return nil
+}
+
+// UnmarshalJSON accepts both the per-set array and the legacy numeric "sets"
+// field, older clients send a set count together with reps/weight. Responses
+// keep "sets" as the count and put the array in "set_details", which is
+// accepted as input as well
+func (e *WorkoutEntry) UnmarshalJSON(data []byte) error {
+	type entryAlias WorkoutEntry
+
+	aux := struct {
+		*entryAlias
+		Sets json.RawMessage `json:"sets"`
+	}{
+		entryAlias: (*entryAlias)(e),
+	}
+
+	err := json.Unmarshal(data, &aux)
+
+	if err != nil {
+		return err
+	}
+
+	raw := bytes.TrimSpace(aux.Sets)
+
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+
+	if raw[0] == '[' {
+		return json.Unmarshal(raw, &e.Sets)
+	}
+
+	return json.Unmarshal(raw, &e.SetCount)
+}
+
+// NormalizeSets makes the sets the source of truth for an entry. Legacy entries
+// without sets are expanded into identical working sets, otherwise the summary
+// fields are derived from the sets.
+func (e *WorkoutEntry) NormalizeSets() {
+	if e.Kind == "" {
+		e.Kind = EntryKindStrength
+	}
+
+	legacy := len(e.Sets) == 0
+
+	if legacy {
+		for i := 0; i < e.SetCount; i++ {
+			e.Sets = append(e.Sets, WorkoutSet{
+				SetType:         SetTypeWorking,
+				Reps:            e.Reps,
+				Weight:          e.Weight,
+				DurationSeconds: e.DurationSeconds,
+				DistanceMeters:  e.DistanceMeters,
+				Completed:       true,
+			})
+		}
+	}
+
+	for i := range e.Sets {
+		e.Sets[i].SetIndex = i + 1
+
+		if e.Sets[i].SetType == "" {
+			e.Sets[i].SetType = SetTypeWorking
+		}
+	}
+
+	// legacy entries already carry their summary, the others get it from the sets
+	if !legacy {
+		e.SetCount = len(e.Sets)
+		e.Reps, e.Weight, e.DurationSeconds = summarizeSets(e.Sets)
+		e.DistanceMeters = totalDistance(e.Sets)
+	}
+
+	e.DeriveCardioMetrics()
+}
+
+// DeriveCardioMetrics fills in the pace and speed of entries that have both a
+// distance and a duration
+func (e *WorkoutEntry) DeriveCardioMetrics() {
+	e.PaceSecondsPerKm = nil
+	e.SpeedKmh = nil
+
+	if e.DistanceMeters == nil || e.DurationSeconds == nil || *e.DistanceMeters <= 0 || *e.DurationSeconds <= 0 {
+		return
+	}
+
+	km := *e.DistanceMeters / 1000
+	seconds := float64(*e.DurationSeconds)
+
+	pace := math.Round(seconds/km*100) / 100
+	speed := math.Round(km/(seconds/3600)*100) / 100
+
+	e.PaceSecondsPerKm = &pace
+	e.SpeedKmh = &speed
+}
+
+func totalDistance(sets []WorkoutSet) *float64 {
+	var total *float64
+
+	for _, set := range sets {
+		if set.DistanceMeters == nil {
+			continue
+		}
+
+		if total == nil {
+			total = new(float64)
+		}
+
+		*total += *set.DistanceMeters
+	}
+
+	return total
+}
+
+// summarizeSets picks the top set (heaviest working set) for rep based
+// exercises and the total duration for timed exercises
+func summarizeSets(sets []WorkoutSet) (*int, *float64, *int) {
+	var top *WorkoutSet
+	var totalDuration *int
+	hasReps := false
+
+	for i := range sets {
+		set := &sets[i]
+
+		if set.DurationSeconds != nil {
+			if totalDuration == nil {
+				totalDuration = new(int)
+			}
+
+			*totalDuration += *set.DurationSeconds
+		}
+
+		if set.Reps == nil {
+			continue
+		}
+
+		hasReps = true
+
+		if top == nil || isHeavierSet(set, top) {
+			top = set
+		}
+	}
+
+	if hasReps {
+		return top.Reps, top.Weight, nil
+	}
+
+	var maxWeight *float64
+
+	for i := range sets {
+		if sets[i].Weight != nil && (maxWeight == nil || *sets[i].Weight > *maxWeight) {
+			maxWeight = sets[i].Weight
+		}
+	}
+
+	return nil, maxWeight, totalDuration
+}
+
+func isHeavierSet(set, top *WorkoutSet) bool {
+	// warmups only count when there is nothing else
+	if top.SetType == SetTypeWarmup && set.SetType != SetTypeWarmup {
+		return true
+	}
+
+	if set.SetType == SetTypeWarmup && top.SetType != SetTypeWarmup {
+		return false
+	}
+
+	setWeight, topWeight := 0.0, 0.0
+
+	if set.Weight != nil {
+		setWeight = *set.Weight
+	}
+
+	if top.Weight != nil {
+		topWeight = *top.Weight
+	}
+
+	if setWeight != topWeight {
+		return setWeight > topWeight
+	}
+
+	return *set.Reps > *top.Reps
+}
+
+// sort keys that can be used to order a list of workouts
+const (
+	WorkoutSortPerformedAt = "performed_at"
+	WorkoutSortCreatedAt   = "created_at"
+	WorkoutSortDuration    = "duration"
+	WorkoutSortCalories    = "calories"
+)
+
+const DefaultTimezone = "UTC"
+
+// who can see a workout besides its owner and their coaches
+const (
+	VisibilityPrivate = "private"
+	// the members of the organizations of the owner
+	VisibilityOrg       = "org"
+	VisibilityFollowers = "followers"
+	// everyone, it is listed on the profile of the owner
+	VisibilityPublic = "public"
+	// only the people that got a share link
+	VisibilityUnlisted = "unlisted"
+)
+
+var WorkoutVisibilities = []string{VisibilityPrivate, VisibilityOrg, VisibilityFollowers, VisibilityPublic, VisibilityUnlisted}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type WorkoutFilter struct {
+	UserID int
+	// OrganizationID lists the feed of an organization instead of the
+	// workouts of UserID, the workouts its members share with it
+	OrganizationID int
+	// Visibilities only lists the workouts of UserID that were done and have
+	// one of these visibilities, for the profile of UserID
+	Visibilities []string
+	From         *time.Time
+	To           *time.Time
+	Title        string
+	MinDuration  *int
+	MaxDuration  *int
+	ExerciseName string
+	Sort         string
+	Descending   bool
+	Cursor       string
+	Limit        int
 }
 
 type PostgresWorkoutStore struct {
@@ -38,12 +342,26 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
 	GetWorkoutByID(id int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
+	UpdateWorkout(workout *Workout, withEntries bool) error
 	DeleteWorkout(id int64) error
 	GetWorkoutOwner(id int64) (int, error)
+	GetWorkoutVisibility(id int64) (int, string, error)
+	ListWorkouts(filter WorkoutFilter) ([]*Workout, string, error)
+	ImportWorkout(workout *Workout, track []TrackPoint) (*Workout, error)
+	CreateWorkouts(workouts []*Workout) ([]*Workout, error)
+	FindDuplicateWorkouts(userID int, workouts []*Workout) ([]bool, error)
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
+	return pg.createWorkout(workout, nil)
+}
+
+// ImportWorkout creates a workout together with the track points of the file it was imported from
+func (pg *PostgresWorkoutStore) ImportWorkout(workout *Workout, track []TrackPoint) (*Workout, error) {
+	return pg.createWorkout(workout, track)
+}
+
+func (pg *PostgresWorkoutStore) createWorkout(workout *Workout, track []TrackPoint) (*Workout, error) {
 	// Start a transaction
 	tx, err := pg.db.Begin()
 
@@ -53,30 +371,22 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 
 	defer tx.Rollback()
 
-	query :=
-		`INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id
-	`
+	err = insertWorkout(tx, workout, track)
+
+	if err != nil {
+		return nil, err
+	}
 
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = recomputePersonalRecords(tx, workout.UserID, entryExercises(workout.Entries))
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Insert workout entries
-	for _, entry := range workout.Entries {
-		query :=
-			`INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	RETURNING id
-		`
-		err = tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+	err = loadRecordFlags(tx, []*Workout{workout})
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit() // commit the transactions
@@ -88,162 +398,504 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
-	workout := &Workout{}
-	query := `
-	SELECT id, title, description, duration_minutes, calories_burned
-	FROM workouts
-	WHERE id = $1
-	`
+// CreateWorkouts creates all workouts of a single user in one transaction,
+// either all of them are created or none
+func (pg *PostgresWorkoutStore) CreateWorkouts(workouts []*Workout) ([]*Workout, error) {
+	if len(workouts) == 0 {
+		return workouts, nil
+	}
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	tx, err := pg.db.Begin()
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	exercises := []exerciseRef{}
+
+	for _, workout := range workouts {
+		err = insertWorkout(tx, workout, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		exercises = append(exercises, entryExercises(workout.Entries)...)
 	}
 
+	// the records only have to be worked out once for the whole batch
+	err = recomputePersonalRecords(tx, workouts[0].UserID, exercises)
+
 	if err != nil {
 		return nil, err
 	}
 
-	// Get workout entries
-	entryQuery := `
-	SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-	FROM workout_entries
-	WHERE workout_id = $1
-	ORDER BY order_index
+	err = loadRecordFlags(tx, workouts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return workouts, nil
+}
+
+// FindDuplicateWorkouts reports for every workout whether the user already has
+// a workout with the same title that was performed at the same time
+func (pg *PostgresWorkoutStore) FindDuplicateWorkouts(userID int, workouts []*Workout) ([]bool, error) {
+	duplicates := make([]bool, len(workouts))
+
+	if len(workouts) == 0 {
+		return duplicates, nil
+	}
+
+	performedAt := make([]time.Time, 0, len(workouts))
+	titles := make([]string, 0, len(workouts))
+
+	for _, workout := range workouts {
+		performedAt = append(performedAt, workout.PerformedAt)
+		titles = append(titles, workout.Title)
+	}
+
+	query := `
+	SELECT DISTINCT i.idx
+	FROM unnest($2::timestamptz[], $3::text[]) WITH ORDINALITY AS i(performed_at, title, idx)
+	INNER JOIN workouts w ON w.user_id = $1 AND w.performed_at = i.performed_at AND LOWER(w.title) = LOWER(i.title)
 	`
 
-	rows, err := pg.db.Query(entryQuery, workout.ID)
+	rows, err := pg.db.Query(query, userID, performedAt, titles)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close() // close any connections to the database
+	defer rows.Close()
 
 	for rows.Next() {
-		var entry WorkoutEntry
-		err := rows.Scan(
-			&entry.ID,
-			&entry.ExerciseName,
-			&entry.Sets,
-			&entry.Reps,
-			&entry.DurationSeconds,
-			&entry.Weight,
-			&entry.Notes,
-			&entry.OrderIndex,
-		)
+		var idx int
+
+		err := rows.Scan(&idx)
 
 		if err != nil {
 			return nil, err
 		}
 
-		workout.Entries = append(workout.Entries, entry)
+		// ordinality starts at 1
+		duplicates[idx-1] = true
 	}
 
-	return workout, nil
+	return duplicates, rows.Err()
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	// Start a transaction
-	tx, err := pg.db.Begin()
+// insertWorkout writes a workout with its entries and track inside the given transaction
+func insertWorkout(tx *sql.Tx, workout *Workout, track []TrackPoint) error {
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+	}
+
+	if workout.Timezone == "" {
+		workout.Timezone = DefaultTimezone
+	}
+
+	if workout.Visibility == "" {
+		workout.Visibility = VisibilityPrivate
+	}
+
+	query :=
+		`INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, template_id, performed_at, started_at, ended_at, timezone, visibility, planned, planned_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	RETURNING id, created_at, updated_at
+	`
+
+	err := tx.QueryRow(query,
+		workout.UserID,
+		workout.Title,
+		workout.Description,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.TemplateID,
+		workout.PerformedAt,
+		workout.StartedAt,
+		workout.EndedAt,
+		workout.Timezone,
+		workout.Visibility,
+		workout.Planned,
+		workout.PlannedBy,
+	).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
+
 	if err != nil {
 		return err
 	}
 
-	defer tx.Rollback()
+	// Insert workout entries
+	err = insertEntries(tx, workout)
+
+	if err != nil {
+		return err
+	}
+
+	return insertTrackPoints(tx, workout.ID, track)
+}
 
+func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+	workout := &Workout{}
 	query := `
-	UPDATE workouts
-	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-	WHERE id = $5
+	SELECT ` + workoutColumns + `
+	FROM workouts w
+	WHERE w.id = $1
 	`
 
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	err := scanWorkout(pg.db.QueryRow(query, id), workout)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	// Get workout entries
+	err = pg.loadEntries([]*Workout{workout})
 
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+// insertEntries writes the entries and their sets of a workout inside the given transaction
+func insertEntries(tx *sql.Tx, workout *Workout) error {
+	for i := range workout.Entries {
+		err := insertEntry(tx, workout, &workout.Entries[i])
+
+		if err != nil {
+			return err
+		}
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	return nil
+}
+
+// prepareEntry normalizes the sets of an entry before it is written
+func prepareEntry(workout *Workout, entry *WorkoutEntry) {
+	entry.NormalizeSets()
+
+	// the sets of a planned workout are targets, they count once the
+	// athlete completes them
+	if workout.Planned {
+		for j := range entry.Sets {
+			entry.Sets[j].Completed = false
+		}
 	}
+}
 
-	// Update workout entries
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+func insertEntry(tx *sql.Tx, workout *Workout, entry *WorkoutEntry) error {
+	prepareEntry(workout, entry)
+
+	query :=
+		`INSERT INTO workout_entries (workout_id, exercise_id, exercise_name, kind, sets, reps, duration_seconds, weight,
+		distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate, cadence, notes, order_index)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	RETURNING id
+	`
+	err := tx.QueryRow(query,
+		workout.ID,
+		entry.ExerciseID,
+		entry.ExerciseName,
+		entry.Kind,
+		entry.SetCount,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.DistanceMeters,
+		entry.ElevationGainMeters,
+		entry.AvgHeartRate,
+		entry.MaxHeartRate,
+		entry.Cadence,
+		entry.Notes,
+		entry.OrderIndex,
+	).Scan(&entry.ID)
 
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range workout.Entries {
+	return insertSets(tx, entry)
+}
+
+func insertSets(tx *sql.Tx, entry *WorkoutEntry) error {
+	for j := range entry.Sets {
+		set := &entry.Sets[j]
+
 		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO workout_sets (workout_entry_id, set_index, set_type, reps, weight, duration_seconds, distance_meters, rpe, completed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
 		`
 
-		_, err := tx.Exec(query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		)
+		err := tx.QueryRow(query, entry.ID, set.SetIndex, set.SetType, set.Reps, set.Weight, set.DurationSeconds, set.DistanceMeters, set.RPE, set.Completed).Scan(&set.ID)
 
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
+// updateEntry overwrites an existing entry and replaces its sets, the entry
+// keeps its id so the comments on it stay
+func updateEntry(tx *sql.Tx, workout *Workout, entry *WorkoutEntry) error {
+	prepareEntry(workout, entry)
+
 	query := `
-	 DELETE FROM workouts
-	 WHERE id = $1
-	 `
+	UPDATE workout_entries
+	SET exercise_id = $1, exercise_name = $2, kind = $3, sets = $4, reps = $5, duration_seconds = $6, weight = $7,
+		distance_meters = $8, elevation_gain_meters = $9, avg_heart_rate = $10, max_heart_rate = $11, cadence = $12,
+		notes = $13, order_index = $14
+	WHERE id = $15
+	`
 
-	result, err := pg.db.Exec(query, id)
+	_, err := tx.Exec(query,
+		entry.ExerciseID,
+		entry.ExerciseName,
+		entry.Kind,
+		entry.SetCount,
+		entry.Reps,
+		entry.DurationSeconds,
+		entry.Weight,
+		entry.DistanceMeters,
+		entry.ElevationGainMeters,
+		entry.AvgHeartRate,
+		entry.MaxHeartRate,
+		entry.Cadence,
+		entry.Notes,
+		entry.OrderIndex,
+		entry.ID,
+	)
 
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	_, err = tx.Exec(`DELETE FROM workout_sets WHERE workout_entry_id = $1`, entry.ID)
 
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return insertSets(tx, entry)
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
-	var userID int
+// saveEntries matches the entries to the ones the workout has by their id,
+// known entries are updated, the others are added and the entries that are
+// left out are removed
+func saveEntries(tx *sql.Tx, workout *Workout) error {
+	rows, err := tx.Query(`SELECT id FROM workout_entries WHERE workout_id = $1`, workout.ID)
 
-	query := `
-	SELECT user_id
-	FROM workouts
-	WHERE id = $1
-	`
+	if err != nil {
+		return err
+	}
 
-	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
+	existing := map[int]bool{}
+
+	for rows.Next() {
+		var id int
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		existing[id] = true
+	}
+
+	rows.Close()
+
+	err = rows.Err()
+
+	if err != nil {
+		return err
+	}
+
+	kept := []int64{}
+
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+
+		if existing[entry.ID] {
+			// an id that is sent twice only updates the entry once
+			delete(existing, entry.ID)
+			err = updateEntry(tx, workout, entry)
+		} else {
+			err = insertEntry(tx, workout, entry)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		kept = append(kept, int64(entry.ID))
+	}
+
+	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1 AND NOT (id = ANY($2))`, workout.ID, kept)
+
+	return err
+}
+
+// UpdateWorkout saves the fields of the workout, its entries are only saved
+// when withEntries is set so an edit of the other fields leaves them, and the
+// comments on them, alone
+func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout, withEntries bool) error {
+	// Start a transaction
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	UPDATE workouts
+	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4,
+		performed_at = $5, started_at = $6, ended_at = $7, timezone = $8, visibility = $9, planned = $10, updated_at = NOW()
+	WHERE id = $11
+	RETURNING updated_at
+	`
+
+	err = tx.QueryRow(query,
+		workout.Title,
+		workout.Description,
+		workout.DurationMinutes,
+		workout.CaloriesBurned,
+		workout.PerformedAt,
+		workout.StartedAt,
+		workout.EndedAt,
+		workout.Timezone,
+		workout.Visibility,
+		workout.Planned,
+		workout.ID,
+	).Scan(&workout.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	// the records of exercises that are removed from the workout change as well
+	previousExercises, err := workoutExercises(tx, int64(workout.ID))
+
+	if err != nil {
+		return err
+	}
+
+	if withEntries {
+		err = saveEntries(tx, workout)
+	} else if workout.Planned {
+		err = resetPlannedSets(tx, workout)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = recomputePersonalRecords(tx, workout.UserID, append(previousExercises, entryExercises(workout.Entries)...))
+
+	if err != nil {
+		return err
+	}
+
+	err = loadRecordFlags(tx, []*Workout{workout})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// resetPlannedSets uncompletes the sets of a workout that is planned again
+func resetPlannedSets(tx *sql.Tx, workout *Workout) error {
+	query := `
+	UPDATE workout_sets
+	SET completed = FALSE
+	WHERE workout_entry_id IN (SELECT id FROM workout_entries WHERE workout_id = $1)
+	`
+
+	_, err := tx.Exec(query, workout.ID)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Entries {
+		for j := range workout.Entries[i].Sets {
+			workout.Entries[i].Sets[j].Completed = false
+		}
+	}
+
+	return nil
+}
+
+func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
+	tx, err := pg.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	exercises, err := workoutExercises(tx, id)
+
+	if err != nil {
+		return err
+	}
+
+	var userID int
+
+	query := `
+	 DELETE FROM workouts
+	 WHERE id = $1
+	 RETURNING user_id
+	 `
+
+	err = tx.QueryRow(query, id).Scan(&userID)
+
+	if err != nil {
+		return err
+	}
+
+	// records set in this workout are gone, older ones may be the best again
+	err = recomputePersonalRecords(tx, userID, exercises)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
+	var userID int
+
+	query := `
+	SELECT user_id
+	FROM workouts
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
 
 	if err != nil {
 		return 0, err
@@ -251,3 +903,398 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(workoutID int64) (int, error) {
 
 	return userID, nil
 }
+
+// GetWorkoutVisibility returns the owner and the visibility of a workout, it
+// returns sql.ErrNoRows when the workout doesn't exist
+func (pg *PostgresWorkoutStore) GetWorkoutVisibility(workoutID int64) (int, string, error) {
+	var userID int
+	var visibility string
+
+	query := `
+	SELECT user_id, visibility
+	FROM workouts
+	WHERE id = $1
+	`
+
+	err := pg.db.QueryRow(query, workoutID).Scan(&userID, &visibility)
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	return userID, visibility, nil
+}
+
+// ListWorkouts returns a page of workouts matching the filter together with the
+// cursor for the next page, which is empty when there are no more results.
+func (pg *PostgresWorkoutStore) ListWorkouts(filter WorkoutFilter) ([]*Workout, string, error) {
+	sortColumn, err := workoutSortColumn(filter.Sort)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.OrganizationID != 0 {
+		addCondition("w.user_id IN (SELECT user_id FROM organization_members WHERE organization_id = $%d AND status = 'accepted')", filter.OrganizationID)
+		addCondition("w.visibility = $%d AND NOT w.planned", VisibilityOrg)
+	} else {
+		addCondition("w.user_id = $%d", filter.UserID)
+	}
+
+	if len(filter.Visibilities) > 0 {
+		addCondition("w.visibility = ANY($%d) AND NOT w.planned", filter.Visibilities)
+	}
+
+	if filter.From != nil {
+		addCondition("w.performed_at >= $%d", *filter.From)
+	}
+
+	if filter.To != nil {
+		addCondition("w.performed_at < $%d", *filter.To)
+	}
+
+	if filter.Title != "" {
+		addCondition("w.title ILIKE '%%' || $%d || '%%'", filter.Title)
+	}
+
+	if filter.MinDuration != nil {
+		addCondition("w.duration_minutes >= $%d", *filter.MinDuration)
+	}
+
+	if filter.MaxDuration != nil {
+		addCondition("w.duration_minutes <= $%d", *filter.MaxDuration)
+	}
+
+	if filter.ExerciseName != "" {
+		// match the free text name as well as every alias of a catalog exercise
+		addCondition(`EXISTS (
+		SELECT 1 FROM workout_entries we
+		LEFT JOIN exercises e ON e.id = we.exercise_id
+		WHERE we.workout_id = w.id AND (
+			LOWER(we.exercise_name) = LOWER($%[1]d)
+			OR LOWER(e.name) = LOWER($%[1]d)
+			OR EXISTS (SELECT 1 FROM unnest(e.aliases) alias WHERE LOWER(alias) = LOWER($%[1]d))
+		)
+	)`, filter.ExerciseName)
+	}
+
+	// keyset pagination, continue after the last row of the previous page
+	if filter.Cursor != "" {
+		value, id, err := decodeWorkoutCursor(filter.Sort, filter.Cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		operator := ">"
+		if filter.Descending {
+			operator = "<"
+		}
+
+		args = append(args, value, id)
+		conditions = append(conditions, fmt.Sprintf("(%s, w.id) %s ($%d, $%d)", sortColumn, operator, len(args)-1, len(args)))
+	}
+
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	args = append(args, filter.Limit+1)
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM workouts w
+	WHERE %s
+	ORDER BY %s %s, w.id %s
+	LIMIT $%d
+	`, workoutColumns, strings.Join(conditions, " AND "), sortColumn, direction, direction, len(args))
+
+	rows, err := pg.db.Query(query, args...)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	workouts := []*Workout{}
+
+	for rows.Next() {
+		workout := &Workout{}
+
+		err := scanWorkout(rows, workout)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		workout.Entries = []WorkoutEntry{}
+		workouts = append(workouts, workout)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+
+	if len(workouts) > filter.Limit {
+		workouts = workouts[:filter.Limit]
+		nextCursor = encodeWorkoutCursor(filter.Sort, workouts[len(workouts)-1])
+	}
+
+	err = pg.loadEntries(workouts)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return workouts, nextCursor, nil
+}
+
+// loadEntries fetches the entries of all given workouts in a single query
+func (pg *PostgresWorkoutStore) loadEntries(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(workouts))
+	byID := make(map[int]*Workout, len(workouts))
+
+	for _, workout := range workouts {
+		ids = append(ids, int64(workout.ID))
+		byID[workout.ID] = workout
+	}
+
+	query := `
+	SELECT workout_id, id, exercise_id, exercise_name, kind, sets, reps, duration_seconds, weight,
+		distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate, cadence, notes, order_index
+	FROM workout_entries
+	WHERE workout_id = ANY($1)
+	ORDER BY workout_id, order_index
+	`
+
+	rows, err := pg.db.Query(query, ids)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+
+		err := rows.Scan(
+			&workoutID,
+			&entry.ID,
+			&entry.ExerciseID,
+			&entry.ExerciseName,
+			&entry.Kind,
+			&entry.SetCount,
+			&entry.Reps,
+			&entry.DurationSeconds,
+			&entry.Weight,
+			&entry.DistanceMeters,
+			&entry.ElevationGainMeters,
+			&entry.AvgHeartRate,
+			&entry.MaxHeartRate,
+			&entry.Cadence,
+			&entry.Notes,
+			&entry.OrderIndex,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		entry.DeriveCardioMetrics()
+
+		if workout, ok := byID[workoutID]; ok {
+			workout.Entries = append(workout.Entries, entry)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	err = pg.loadSets(workouts)
+
+	if err != nil {
+		return err
+	}
+
+	return loadRecordFlags(pg.db, workouts)
+}
+
+// loadSets fetches the sets of every entry of the given workouts in a single query
+func (pg *PostgresWorkoutStore) loadSets(workouts []*Workout) error {
+	entryIDs := []int64{}
+	byID := map[int]*WorkoutEntry{}
+
+	for _, workout := range workouts {
+		for i := range workout.Entries {
+			entry := &workout.Entries[i]
+			entry.Sets = []WorkoutSet{}
+			entryIDs = append(entryIDs, int64(entry.ID))
+			byID[entry.ID] = entry
+		}
+	}
+
+	if len(entryIDs) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT workout_entry_id, id, set_index, set_type, reps, weight, duration_seconds, distance_meters, rpe, completed
+	FROM workout_sets
+	WHERE workout_entry_id = ANY($1)
+	ORDER BY workout_entry_id, set_index
+	`
+
+	rows, err := pg.db.Query(query, entryIDs)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		var set WorkoutSet
+
+		err := rows.Scan(
+			&entryID,
+			&set.ID,
+			&set.SetIndex,
+			&set.SetType,
+			&set.Reps,
+			&set.Weight,
+			&set.DurationSeconds,
+			&set.DistanceMeters,
+			&set.RPE,
+			&set.Completed,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if entry, ok := byID[entryID]; ok {
+			entry.Sets = append(entry.Sets, set)
+		}
+	}
+
+	return rows.Err()
+}
+
+const workoutColumns = `w.id, w.user_id, w.title, COALESCE(w.description, ''), w.duration_minutes, COALESCE(w.calories_burned, 0),
+	w.template_id, w.performed_at, w.started_at, w.ended_at, w.timezone, w.visibility, w.planned, w.planned_by, w.created_at, w.updated_at`
+
+func scanWorkout(row rowScanner, workout *Workout) error {
+	return row.Scan(
+		&workout.ID,
+		&workout.UserID,
+		&workout.Title,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.TemplateID,
+		&workout.PerformedAt,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.Timezone,
+		&workout.Visibility,
+		&workout.Planned,
+		&workout.PlannedBy,
+		&workout.CreatedAt,
+		&workout.UpdatedAt,
+	)
+}
+
+func workoutSortColumn(sort string) (string, error) {
+	switch sort {
+	case WorkoutSortPerformedAt:
+		return "w.performed_at", nil
+	case WorkoutSortCreatedAt:
+		return "w.created_at", nil
+	case WorkoutSortDuration:
+		return "w.duration_minutes", nil
+	case WorkoutSortCalories:
+		return "COALESCE(w.calories_burned, 0)", nil
+	default:
+		return "", fmt.Errorf("invalid sort %q", sort)
+	}
+}
+
+// a cursor is the base64 encoded sort value and id of the last workout on a page
+func encodeWorkoutCursor(sort string, workout *Workout) string {
+	var value string
+
+	switch sort {
+	case WorkoutSortDuration:
+		value = strconv.Itoa(workout.DurationMinutes)
+	case WorkoutSortCalories:
+		value = strconv.Itoa(workout.CaloriesBurned)
+	case WorkoutSortCreatedAt:
+		value = workout.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		value = workout.PerformedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	raw := fmt.Sprintf("%s|%s|%d", sort, value, workout.ID)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeWorkoutCursor(sort, cursor string) (interface{}, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+
+	// a cursor is only valid for the sort order it was created with
+	if len(parts) != 3 || parts[0] != sort {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	if sort == WorkoutSortPerformedAt || sort == WorkoutSortCreatedAt {
+		t, err := time.Parse(time.RFC3339Nano, parts[1])
+
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+
+		return t, id, nil
+	}
+
+	value, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	return value, id, nil
+}
@@ -2,7 +2,9 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
@@ -24,7 +26,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 	}
 
 	// every time we run a test, we want to start with a clean slate
-	_, err = db.Exec("TRUNCATE TABLE workouts, workout_entries CASCADE")
+	_, err = db.Exec("TRUNCATE TABLE workouts, workout_entries, users CASCADE")
 
 	if err != nil {
 		t.Fatalf("truncating test db: %v", err)
@@ -33,6 +35,19 @@ func setupTestDB(t *testing.T) *sql.DB {
 	return db
 }
 
+func createTestUser(t *testing.T, db *sql.DB, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com"}
+	user.PasswordHash.hash = []byte("hash")
+
+	err := NewPostgresUserStore(db).CreateUser(user)
+
+	if err != nil {
+		t.Fatalf("creating test user: %v", err)
+	}
+
+	return user
+}
+
 func TestCreateWorkout(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -54,7 +69,7 @@ func TestCreateWorkout(t *testing.T) {
 				Entries: []WorkoutEntry{
 					{
 						ExerciseName:    "Bench Press",
-						Sets:            3,
+						SetCount:        3,
 						Reps:            IntPtr(10),
 						DurationSeconds: nil,
 						Weight:          FloatPtr(72.5),
@@ -75,14 +90,14 @@ func TestCreateWorkout(t *testing.T) {
 				Entries: []WorkoutEntry{
 					{
 						ExerciseName: "Plank",
-						Sets:         3,
+						SetCount:     3,
 						Reps:         IntPtr(60),
 						Notes:        "Keep in form",
 						OrderIndex:   1,
 					},
 					{
 						ExerciseName:    "Squats",
-						Sets:            4,
+						SetCount:        4,
 						Reps:            IntPtr(15),
 						DurationSeconds: IntPtr(30),
 						Weight:          FloatPtr(100.0),
@@ -124,6 +139,7 @@ func TestCreateWorkout(t *testing.T) {
 			// check entries
 			for i := range retrievedWorkout.Entries {
 				assert.Equal(t, tt.workout.Entries[i].ExerciseName, retrievedWorkout.Entries[i].ExerciseName)
+				assert.Equal(t, tt.workout.Entries[i].SetCount, retrievedWorkout.Entries[i].SetCount)
 				assert.Equal(t, tt.workout.Entries[i].Sets, retrievedWorkout.Entries[i].Sets)
 				assert.Equal(t, tt.workout.Entries[i].Reps, retrievedWorkout.Entries[i].Reps)
 				assert.Equal(t, tt.workout.Entries[i].DurationSeconds, retrievedWorkout.Entries[i].DurationSeconds)
@@ -143,3 +159,230 @@ func IntPtr(i int) *int {
 func FloatPtr(i float64) *float64 {
 	return &i
 }
+
+func TestWorkoutCursor(t *testing.T) {
+	performedAt := time.Date(2025, 5, 1, 8, 30, 0, 0, time.UTC)
+	createdAt := time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC)
+	workout := &Workout{ID: 42, DurationMinutes: 60, CaloriesBurned: 300, PerformedAt: performedAt, CreatedAt: createdAt}
+
+	tests := []struct {
+		name      string
+		sort      string
+		wantValue interface{}
+	}{
+		{name: "performed at", sort: WorkoutSortPerformedAt, wantValue: performedAt},
+		{name: "created at", sort: WorkoutSortCreatedAt, wantValue: createdAt},
+		{name: "duration", sort: WorkoutSortDuration, wantValue: 60},
+		{name: "calories", sort: WorkoutSortCalories, wantValue: 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := encodeWorkoutCursor(tt.sort, workout)
+
+			value, id, err := decodeWorkoutCursor(tt.sort, cursor)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantValue, value)
+			assert.Equal(t, int64(42), id)
+		})
+	}
+
+	t.Run("cursor from another sort", func(t *testing.T) {
+		cursor := encodeWorkoutCursor(WorkoutSortDuration, workout)
+
+		_, _, err := decodeWorkoutCursor(WorkoutSortCalories, cursor)
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, _, err := decodeWorkoutCursor(WorkoutSortPerformedAt, "not-a-cursor")
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+}
+
+func TestWorkoutEntryUnmarshalJSON(t *testing.T) {
+	t.Run("legacy set count", func(t *testing.T) {
+		var entry WorkoutEntry
+
+		err := json.Unmarshal([]byte(`{"exercise_name": "Squat", "sets": 3, "reps": 5, "weight": 100}`), &entry)
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, entry.SetCount)
+		assert.Empty(t, entry.Sets)
+	})
+
+	t.Run("per set array", func(t *testing.T) {
+		var entry WorkoutEntry
+
+		err := json.Unmarshal([]byte(`{"exercise_name": "Squat", "sets": [{"reps": 5, "weight": 100, "set_type": "working"}]}`), &entry)
+
+		require.NoError(t, err)
+		require.Len(t, entry.Sets, 1)
+		assert.Equal(t, IntPtr(5), entry.Sets[0].Reps)
+	})
+
+	t.Run("completed defaults to true", func(t *testing.T) {
+		var entry WorkoutEntry
+
+		err := json.Unmarshal([]byte(`{"exercise_name": "Squat", "sets": [{"reps": 5, "weight": 100}, {"reps": 5, "weight": 100, "completed": false}]}`), &entry)
+
+		require.NoError(t, err)
+		require.Len(t, entry.Sets, 2)
+		assert.True(t, entry.Sets[0].Completed)
+		assert.False(t, entry.Sets[1].Completed)
+	})
+
+	t.Run("response round trips", func(t *testing.T) {
+		entry := WorkoutEntry{ExerciseName: "Squat", SetCount: 3, Reps: IntPtr(5), Weight: FloatPtr(100)}
+		entry.NormalizeSets()
+
+		data, err := json.Marshal(entry)
+		require.NoError(t, err)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		// older clients read the set count from sets
+		assert.Equal(t, 3.0, body["sets"])
+		assert.Len(t, body["set_details"], 3)
+
+		var decoded WorkoutEntry
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, 3, decoded.SetCount)
+		assert.Len(t, decoded.Sets, 3)
+	})
+}
+
+func TestCreateWorkoutSetWithoutCompleted(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewPostgresWorkoutStore(db)
+	user := createTestUser(t, db, "lifter")
+
+	var entry WorkoutEntry
+
+	err := json.Unmarshal([]byte(`{"exercise_name": "Deadlift", "order_index": 1, "sets": [{"reps": 5, "weight": 140}]}`), &entry)
+	require.NoError(t, err)
+
+	workout, err := store.CreateWorkout(&Workout{
+		UserID:          user.ID,
+		Title:           "Pull day",
+		DurationMinutes: 45,
+		Entries:         []WorkoutEntry{entry},
+	})
+	require.NoError(t, err)
+
+	retrieved, err := store.GetWorkoutByID(int64(workout.ID))
+	require.NoError(t, err)
+	require.Len(t, retrieved.Entries, 1)
+	require.Len(t, retrieved.Entries[0].Sets, 1)
+
+	// the set was done, so it counts for the records
+	assert.True(t, retrieved.Entries[0].Sets[0].Completed)
+	assert.NotEmpty(t, workout.Entries[0].PersonalRecords)
+}
+
+func TestNormalizeSets(t *testing.T) {
+	t.Run("legacy entry is expanded", func(t *testing.T) {
+		entry := WorkoutEntry{ExerciseName: "Squat", SetCount: 3, Reps: IntPtr(5), Weight: FloatPtr(100)}
+
+		entry.NormalizeSets()
+
+		require.Len(t, entry.Sets, 3)
+		assert.Equal(t, 3, entry.Sets[2].SetIndex)
+		assert.Equal(t, SetTypeWorking, entry.Sets[0].SetType)
+		assert.Equal(t, IntPtr(5), entry.Reps)
+	})
+
+	t.Run("pyramid summary uses the top set", func(t *testing.T) {
+		entry := WorkoutEntry{
+			ExerciseName: "Bench Press",
+			Sets: []WorkoutSet{
+				{SetType: SetTypeWarmup, Reps: IntPtr(15), Weight: FloatPtr(40)},
+				{Reps: IntPtr(12), Weight: FloatPtr(60)},
+				{Reps: IntPtr(10), Weight: FloatPtr(70)},
+				{Reps: IntPtr(8), Weight: FloatPtr(80)},
+			},
+		}
+
+		entry.NormalizeSets()
+
+		assert.Equal(t, 4, entry.SetCount)
+		assert.Equal(t, IntPtr(8), entry.Reps)
+		assert.Equal(t, FloatPtr(80), entry.Weight)
+		assert.Nil(t, entry.DurationSeconds)
+	})
+
+	t.Run("timed sets are summed", func(t *testing.T) {
+		entry := WorkoutEntry{
+			ExerciseName: "Plank",
+			Sets: []WorkoutSet{
+				{DurationSeconds: IntPtr(60)},
+				{DurationSeconds: IntPtr(45)},
+			},
+		}
+
+		entry.NormalizeSets()
+
+		assert.Nil(t, entry.Reps)
+		assert.Equal(t, IntPtr(105), entry.DurationSeconds)
+	})
+
+	t.Run("cardio intervals sum distance and duration", func(t *testing.T) {
+		entry := WorkoutEntry{
+			ExerciseName: "Running",
+			Kind:         EntryKindCardio,
+			Sets: []WorkoutSet{
+				{DurationSeconds: IntPtr(120), DistanceMeters: FloatPtr(400)},
+				{DurationSeconds: IntPtr(130), DistanceMeters: FloatPtr(400)},
+				{DistanceMeters: FloatPtr(200)},
+			},
+		}
+
+		entry.NormalizeSets()
+
+		assert.Nil(t, entry.Reps)
+		assert.Equal(t, IntPtr(250), entry.DurationSeconds)
+		assert.Equal(t, FloatPtr(1000), entry.DistanceMeters)
+		assert.Equal(t, FloatPtr(250), entry.PaceSecondsPerKm)
+		assert.Equal(t, FloatPtr(14.4), entry.SpeedKmh)
+	})
+
+	t.Run("entries default to strength", func(t *testing.T) {
+		entry := WorkoutEntry{ExerciseName: "Squat", SetCount: 1, Reps: IntPtr(5)}
+
+		entry.NormalizeSets()
+
+		assert.Equal(t, EntryKindStrength, entry.Kind)
+	})
+}
+
+func TestDeriveCardioMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance *float64
+		duration *int
+		pace     *float64
+		speed    *float64
+	}{
+		{name: "5k in 25 minutes", distance: FloatPtr(5000), duration: IntPtr(1500), pace: FloatPtr(300), speed: FloatPtr(12)},
+		{name: "no distance", duration: IntPtr(1800)},
+		{name: "no duration", distance: FloatPtr(5000)},
+		{name: "zero distance", distance: FloatPtr(0), duration: IntPtr(600)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := WorkoutEntry{Kind: EntryKindCardio, DistanceMeters: tt.distance, DurationSeconds: tt.duration}
+
+			entry.DeriveCardioMetrics()
+
+			assert.Equal(t, tt.pace, entry.PaceSecondsPerKm)
+			assert.Equal(t, tt.speed, entry.SpeedKmh)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrackPoint is a single recorded point of an imported GPS or sensor file
+type TrackPoint struct {
+	RecordedAt      *time.Time `json:"recorded_at"`
+	Latitude        *float64   `json:"latitude"`
+	Longitude       *float64   `json:"longitude"`
+	ElevationMeters *float64   `json:"elevation_meters"`
+	DistanceMeters  *float64   `json:"distance_meters"`
+	HeartRate       *int       `json:"heart_rate"`
+	Cadence         *int       `json:"cadence"`
+}
+
+// a long run easily has thousands of points, so they are inserted in batches
+// to stay well below the parameter limit of postgres
+const trackPointBatchSize = 500
+
+func insertTrackPoints(tx *sql.Tx, workoutID int, track []TrackPoint) error {
+	for start := 0; start < len(track); start += trackPointBatchSize {
+		end := min(start+trackPointBatchSize, len(track))
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*9)
+
+		for i := start; i < end; i++ {
+			point := track[i]
+			n := len(args)
+
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+			args = append(args,
+				workoutID,
+				i,
+				point.RecordedAt,
+				point.Latitude,
+				point.Longitude,
+				point.ElevationMeters,
+				point.DistanceMeters,
+				point.HeartRate,
+				point.Cadence,
+			)
+		}
+
+		query := `
+		INSERT INTO workout_tracks (workout_id, point_index, recorded_at, latitude, longitude, elevation_meters,
+			distance_meters, heart_rate, cadence)
+		VALUES ` + strings.Join(values, ", ")
+
+		_, err := tx.Exec(query, args...)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
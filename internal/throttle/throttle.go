@@ -0,0 +1,217 @@
+package throttle
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// Policy is how hard failed attempts of a key are throttled. After
+// FreeFailures every failure doubles the wait before the next attempt, and at
+// LockoutFailures the key is locked out.
+type Policy struct {
+	FreeFailures    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutFailures int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered
+	Window time.Duration
+}
+
+var (
+	// AccountPolicy is for a single account, by username or by user for 2FA codes
+	AccountPolicy = Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	// IPPolicy is looser, a lot of people can share an ip
+	IPPolicy = Policy{
+		FreeFailures:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutFailures: 50,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	// PasswordResetPolicy is for the reset mails of an email, every request
+	// counts as an attempt
+	PasswordResetPolicy = Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Minute,
+		MaxDelay:        15 * time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// retention is how long keys without failures are kept, longer than any
+// window or lockout
+const retention = 24 * time.Hour
+
+// Delay is how long after the last failure the next attempt has to wait
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.FreeFailures {
+		return 0
+	}
+
+	delay := p.BaseDelay
+
+	for i := p.FreeFailures + 1; i < failures; i++ {
+		delay *= 2
+
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+// Limit is a key that is throttled with a policy
+type Limit struct {
+	Key    string
+	Policy Policy
+}
+
+// Username throttles the logins of a username, whether the account exists or
+// not, so a lockout doesn't tell which usernames exist
+func Username(username string) Limit {
+	return Limit{Key: "username:" + strings.ToLower(strings.TrimSpace(username)), Policy: AccountPolicy}
+}
+
+func IP(ip string) Limit {
+	return Limit{Key: "ip:" + ip, Policy: IPPolicy}
+}
+
+// PasswordReset throttles the reset requests of an email, whether the account
+// exists or not
+func PasswordReset(email string) Limit {
+	return Limit{Key: "reset:" + strings.ToLower(strings.TrimSpace(email)), Policy: PasswordResetPolicy}
+}
+
+// PasswordResetIP throttles the reset requests of an ip apart from its logins
+func PasswordResetIP(ip string) Limit {
+	return Limit{Key: "reset-ip:" + ip, Policy: IPPolicy}
+}
+
+// MFA throttles the 2FA codes of a user
+func MFA(userID int) Limit {
+	return Limit{Key: "mfa:" + strconv.Itoa(userID), Policy: AccountPolicy}
+}
+
+type Throttler struct {
+	store  store.AttemptStore
+	logger *log.Logger
+	now    func() time.Time
+}
+
+func NewThrottler(attemptStore store.AttemptStore, logger *log.Logger) *Throttler {
+	return &Throttler{
+		store:  attemptStore,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Check returns how long to wait before the next attempt is allowed, it is 0
+// when the attempt can go ahead
+func (t *Throttler) Check(limits ...Limit) (time.Duration, error) {
+	now := t.now()
+	wait := time.Duration(0)
+
+	for _, limit := range limits {
+		attempts, err := t.store.GetAttempts(limit.Key)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if attempts == nil {
+			continue
+		}
+
+		next := attempts.LastFailureAt.Add(limit.Policy.Delay(attempts.Failures))
+
+		if attempts.LockedUntil != nil && attempts.LockedUntil.After(next) {
+			next = *attempts.LockedUntil
+		}
+
+		if next.Sub(now) > wait {
+			wait = next.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// Fail records a failed attempt from ip for every limit and locks out the
+// keys that reach their lockout
+func (t *Throttler) Fail(ip string, limits ...Limit) error {
+	now := t.now()
+
+	for _, limit := range limits {
+		attempts, err := t.store.RecordFailure(limit.Key, now, limit.Policy.Window)
+
+		if err != nil {
+			return err
+		}
+
+		locked := attempts.LockedUntil != nil && attempts.LockedUntil.After(now)
+
+		if attempts.Failures < limit.Policy.LockoutFailures || locked {
+			continue
+		}
+
+		event := &store.LockoutEvent{
+			Key:         limit.Key,
+			IP:          ip,
+			Failures:    attempts.Failures,
+			LockedUntil: now.Add(limit.Policy.LockoutDuration),
+		}
+
+		err = t.store.LockAttempts(limit.Key, event.LockedUntil)
+
+		if err != nil {
+			return err
+		}
+
+		err = t.store.RecordLockout(event)
+
+		if err != nil {
+			return err
+		}
+
+		t.logger.Printf("WARNING: %s is locked out until %s after %d failed attempts, the last from %s", event.Key, event.LockedUntil.Format(time.RFC3339), event.Failures, ip)
+	}
+
+	return nil
+}
+
+// Succeed forgets the failures of the limits
+func (t *Throttler) Succeed(limits ...Limit) error {
+	for _, limit := range limits {
+		err := t.store.ResetAttempts(limit.Key)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prune forgets the keys that didn't fail in a long time
+func (t *Throttler) Prune() error {
+	return t.store.DeleteStaleAttempts(t.now().Add(-retention))
+}
@@ -0,0 +1,135 @@
+package throttle
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 9, want: 32 * time.Second},
+		{failures: 10, want: time.Minute},
+		{failures: 100, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, AccountPolicy.Delay(tt.failures), "%d failures", tt.failures)
+	}
+}
+
+func newTestThrottler() (*Throttler, *store.MemoryAttemptStore, *time.Time) {
+	attemptStore := store.NewMemoryAttemptStore()
+	throttler := NewThrottler(attemptStore, log.New(io.Discard, "", 0))
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	throttler.now = func() time.Time { return now }
+
+	return throttler, attemptStore, &now
+}
+
+func TestThrottlerBackoffAndLockout(t *testing.T) {
+	throttler, attemptStore, now := newTestThrottler()
+	limits := []Limit{Username("JohnDoe"), IP("192.0.2.1")}
+
+	for i := 0; i < AccountPolicy.FreeFailures; i++ {
+		require.NoError(t, throttler.Fail("192.0.2.1", limits...))
+	}
+
+	wait, err := throttler.Check(limits...)
+	require.NoError(t, err)
+	assert.Zero(t, wait, "the first failures are free")
+
+	require.NoError(t, throttler.Fail("192.0.2.1", limits...))
+
+	wait, err = throttler.Check(limits...)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	// the username is throttled whatever way it is written
+	wait, err = throttler.Check(Username(" johndoe"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	for i := AccountPolicy.FreeFailures + 1; i < AccountPolicy.LockoutFailures; i++ {
+		*now = now.Add(time.Minute)
+		require.NoError(t, throttler.Fail("192.0.2.1", limits...))
+	}
+
+	wait, err = throttler.Check(limits...)
+	require.NoError(t, err)
+	assert.Equal(t, AccountPolicy.LockoutDuration, wait)
+
+	lockouts := attemptStore.Lockouts()
+	require.Len(t, lockouts, 1)
+	assert.Equal(t, "username:johndoe", lockouts[0].Key)
+	assert.Equal(t, "192.0.2.1", lockouts[0].IP)
+
+	*now = now.Add(AccountPolicy.LockoutDuration)
+
+	wait, err = throttler.Check(limits...)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// pruning forgets the lockout once it is long over
+	*now = now.Add(retention + time.Second)
+	require.NoError(t, throttler.Prune())
+	assert.Empty(t, attemptStore.Lockouts())
+}
+
+func TestThrottlerSucceedAndWindow(t *testing.T) {
+	throttler, _, now := newTestThrottler()
+	limit := Username("johndoe")
+
+	for i := 0; i <= AccountPolicy.FreeFailures; i++ {
+		require.NoError(t, throttler.Fail("192.0.2.1", limit))
+	}
+
+	require.NoError(t, throttler.Succeed(limit))
+
+	wait, err := throttler.Check(limit)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	for i := 0; i < AccountPolicy.FreeFailures; i++ {
+		require.NoError(t, throttler.Fail("192.0.2.1", limit))
+	}
+
+	// failures older than the window are forgotten
+	*now = now.Add(AccountPolicy.Window + time.Second)
+	require.NoError(t, throttler.Fail("192.0.2.1", limit))
+
+	wait, err = throttler.Check(limit)
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestThrottlerPasswordReset(t *testing.T) {
+	throttler, _, _ := newTestThrottler()
+
+	for i := 0; i <= PasswordResetPolicy.FreeFailures; i++ {
+		require.NoError(t, throttler.Fail("192.0.2.1", PasswordReset("john@example.com"), PasswordResetIP("192.0.2.1")))
+	}
+
+	// the email is throttled whatever way it is written, apart from logins
+	wait, err := throttler.Check(PasswordReset(" John@Example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, PasswordResetPolicy.BaseDelay, wait)
+
+	wait, err = throttler.Check(PasswordResetIP("192.0.2.1"), IP("192.0.2.1"))
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
@@ -0,0 +1,89 @@
+package tokens
+
+import (
+	"sync"
+	"time"
+)
+
+// Revocation revokes JWTs before they expire, either a single token by its ID,
+// every token of a login by its family or every token of a user that was
+// issued before RevokedAt. It is kept until Expiry, after that the tokens it
+// revokes are expired anyway.
+type Revocation struct {
+	JTI       string
+	FamilyID  string
+	UserID    int
+	RevokedAt time.Time
+	Expiry    time.Time
+}
+
+// DenyList is the in memory copy of the revocations, so a JWT can be checked
+// without a database query
+type DenyList struct {
+	mu       sync.RWMutex
+	jtis     map[string]time.Time
+	families map[string]time.Time
+	users    map[int]time.Time
+}
+
+func NewDenyList() *DenyList {
+	dl := &DenyList{}
+	dl.Replace(nil)
+	return dl
+}
+
+func (dl *DenyList) add(rev Revocation) {
+	switch {
+	case rev.JTI != "":
+		dl.jtis[rev.JTI] = rev.Expiry
+	case rev.FamilyID != "":
+		dl.families[rev.FamilyID] = rev.Expiry
+	case rev.UserID != 0:
+		// the latest revocation of a user covers the earlier ones
+		if rev.RevokedAt.After(dl.users[rev.UserID]) {
+			dl.users[rev.UserID] = rev.RevokedAt
+		}
+	}
+}
+
+func (dl *DenyList) Add(rev Revocation) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	dl.add(rev)
+}
+
+// Replace swaps the list for the given revocations, used to pick up the
+// revocations of other instances of the api
+func (dl *DenyList) Replace(revs []Revocation) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	dl.jtis = map[string]time.Time{}
+	dl.families = map[string]time.Time{}
+	dl.users = map[int]time.Time{}
+
+	for _, rev := range revs {
+		dl.add(rev)
+	}
+}
+
+// Denied tells whether the token of the claims was revoked. iat only has
+// second precision, so a token of the same second as a user wide revocation
+// is still allowed, that is the new token the revoking request got.
+func (dl *DenyList) Denied(claims *Claims) bool {
+	dl.mu.RLock()
+	defer dl.mu.RUnlock()
+
+	if _, ok := dl.jtis[claims.ID]; ok {
+		return true
+	}
+
+	if _, ok := dl.families[claims.FamilyID]; ok && claims.FamilyID != "" {
+		return true
+	}
+
+	revokedAt, ok := dl.users[claims.UserID]
+
+	return ok && claims.IssuedAt.Before(revokedAt.Truncate(time.Second))
+}
@@ -0,0 +1,339 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// the issuer of the JWTs, tokens of another issuer are refused
+const jwtIssuer = "workout-tracking-api"
+
+// jwtLeeway allows for clocks that are a little off between servers
+const jwtLeeway = 30 * time.Second
+
+var (
+	ErrInvalidJWT = errors.New("invalid jwt")
+	ErrExpiredJWT = errors.New("jwt expired")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Claims is what a JWT access token says about its user, enough to handle a
+// request without looking the user up
+type Claims struct {
+	ID        string
+	UserID    int
+	Username  string
+	Email     string
+	Activated bool
+	Role      string
+	Scopes    []string
+	// FamilyID is the login the token belongs to, like Token.FamilyID
+	FamilyID  string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jwtClaims are the Claims as they are encoded, using the registered and
+// OpenID claim names where there is one
+type jwtClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	ID            string `json:"jti"`
+	IssuedAt      int64  `json:"iat"`
+	ExpiresAt     int64  `json:"exp"`
+	Username      string `json:"preferred_username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role"`
+	Scope         string `json:"scope"`
+	SessionID     string `json:"sid"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type jwtKey struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+	secret  []byte
+}
+
+// KeySet signs JWTs with its first key and verifies them with any of its keys,
+// so a new key can be put in front while tokens of the old one still work
+type KeySet struct {
+	alg  string
+	keys []jwtKey
+}
+
+func keyID(material []byte) string {
+	hash := sha256.Sum256(material)
+	return b64.EncodeToString(hash[:8])
+}
+
+// NewEdDSAKeySet creates a key set from 32 byte Ed25519 seeds
+func NewEdDSAKeySet(seeds [][]byte) (*KeySet, error) {
+	if len(seeds) == 0 {
+		return nil, errors.New("jwt: at least one key is required")
+	}
+
+	ks := &KeySet{alg: AlgEdDSA}
+
+	for _, seed := range seeds {
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("jwt: an Ed25519 seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+		}
+
+		private := ed25519.NewKeyFromSeed(seed)
+		public := private.Public().(ed25519.PublicKey)
+
+		ks.keys = append(ks.keys, jwtKey{id: keyID(public), private: private, public: public})
+	}
+
+	return ks, nil
+}
+
+// NewHS256KeySet creates a key set from shared secrets of at least 32 bytes
+func NewHS256KeySet(secrets [][]byte) (*KeySet, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("jwt: at least one key is required")
+	}
+
+	ks := &KeySet{alg: AlgHS256}
+
+	for _, secret := range secrets {
+		if len(secret) < 32 {
+			return nil, errors.New("jwt: an HS256 secret must be at least 32 bytes")
+		}
+
+		// the id of a secret must not give the secret away, so it is hashed twice
+		hash := sha256.Sum256(secret)
+		ks.keys = append(ks.keys, jwtKey{id: keyID(hash[:]), secret: secret})
+	}
+
+	return ks, nil
+}
+
+// GenerateEdDSASeed returns a random seed for NewEdDSAKeySet
+func GenerateEdDSASeed() ([]byte, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return seed, nil
+}
+
+func (ks *KeySet) Alg() string {
+	return ks.alg
+}
+
+func (ks *KeySet) sign(key jwtKey, signingInput []byte) []byte {
+	if ks.alg == AlgEdDSA {
+		return ed25519.Sign(key.private, signingInput)
+	}
+
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil)
+}
+
+func (ks *KeySet) verify(key jwtKey, signingInput, signature []byte) bool {
+	if ks.alg == AlgEdDSA {
+		return ed25519.Verify(key.public, signingInput, signature)
+	}
+
+	return hmac.Equal(ks.sign(key, signingInput), signature)
+}
+
+// Sign encodes the claims as a JWT signed with the current key, a missing ID
+// is generated
+func (ks *KeySet) Sign(claims *Claims) (string, error) {
+	if claims.ID == "" {
+		id, err := randomString()
+		if err != nil {
+			return "", err
+		}
+
+		claims.ID = id
+	}
+
+	key := ks.keys[0]
+
+	header, err := json.Marshal(jwtHeader{Alg: ks.alg, Typ: "JWT", Kid: key.id})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(jwtClaims{
+		Issuer:        jwtIssuer,
+		Subject:       strconv.Itoa(claims.UserID),
+		ID:            claims.ID,
+		IssuedAt:      claims.IssuedAt.Unix(),
+		ExpiresAt:     claims.ExpiresAt.Unix(),
+		Username:      claims.Username,
+		Email:         claims.Email,
+		EmailVerified: claims.Activated,
+		Role:          claims.Role,
+		Scope:         strings.Join(claims.Scopes, " "),
+		SessionID:     claims.FamilyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	signature := ks.sign(key, []byte(signingInput))
+
+	return signingInput + "." + b64.EncodeToString(signature), nil
+}
+
+// Verify checks the signature and the lifetime of a JWT and returns its claims
+func (ks *KeySet) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidJWT
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	// never let the token pick the algorithm, "none" or an HS256 token signed
+	// with the public key would be accepted otherwise
+	if header.Alg != ks.alg {
+		return nil, ErrInvalidJWT
+	}
+
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	valid := false
+
+	for _, key := range ks.keys {
+		if key.id == header.Kid && ks.verify(key, signingInput, signature) {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return nil, ErrInvalidJWT
+	}
+
+	var payload jwtClaims
+	err = decodeSegment(parts[1], &payload)
+	if err != nil || payload.Issuer != jwtIssuer {
+		return nil, ErrInvalidJWT
+	}
+
+	userID, err := strconv.Atoi(payload.Subject)
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	claims := &Claims{
+		ID:        payload.ID,
+		UserID:    userID,
+		Username:  payload.Username,
+		Email:     payload.Email,
+		Activated: payload.EmailVerified,
+		Role:      payload.Role,
+		Scopes:    strings.Fields(payload.Scope),
+		FamilyID:  payload.SessionID,
+		IssuedAt:  time.Unix(payload.IssuedAt, 0),
+		ExpiresAt: time.Unix(payload.ExpiresAt, 0),
+	}
+
+	if !now.Before(claims.ExpiresAt.Add(jwtLeeway)) {
+		return nil, ErrExpiredJWT
+	}
+
+	if claims.IssuedAt.After(now.Add(jwtLeeway)) {
+		return nil, ErrInvalidJWT
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := b64.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// JWK is a public key as published in the JWKS
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS returns the public keys clients can verify tokens with. HS256 secrets
+// are shared secrets, so there is nothing to publish for them.
+func (ks *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+
+	if ks.alg != AlgEdDSA {
+		return jwks
+	}
+
+	for _, key := range ks.keys {
+		jwks = append(jwks, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64.EncodeToString(key.public),
+			Kid: key.id,
+			Use: "sig",
+			Alg: AlgEdDSA,
+		})
+	}
+
+	return jwks
+}
+
+// IsJWT tells JWTs apart from the opaque tokens and api keys, which never
+// contain a dot
+func IsJWT(plaintext string) bool {
+	return strings.Count(plaintext, ".") == 2
+}
@@ -0,0 +1,187 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims(now time.Time) *Claims {
+	return &Claims{
+		UserID:    42,
+		Username:  "johndoe",
+		Email:     "johndoe@example.com",
+		Activated: true,
+		Role:      "coach",
+		Scopes:    []string{"workouts:read", "workouts:write"},
+		FamilyID:  "family",
+		IssuedAt:  now,
+		ExpiresAt: now.Add(15 * time.Minute),
+	}
+}
+
+func testKeySets(t *testing.T) map[string][2]*KeySet {
+	seed1, err := GenerateEdDSASeed()
+	require.NoError(t, err)
+	seed2, err := GenerateEdDSASeed()
+	require.NoError(t, err)
+
+	oldEdDSA, err := NewEdDSAKeySet([][]byte{seed1})
+	require.NoError(t, err)
+	rotatedEdDSA, err := NewEdDSAKeySet([][]byte{seed2, seed1})
+	require.NoError(t, err)
+
+	secret1 := []byte(strings.Repeat("a", 32))
+	secret2 := []byte(strings.Repeat("b", 32))
+
+	oldHS256, err := NewHS256KeySet([][]byte{secret1})
+	require.NoError(t, err)
+	rotatedHS256, err := NewHS256KeySet([][]byte{secret2, secret1})
+	require.NoError(t, err)
+
+	return map[string][2]*KeySet{
+		AlgEdDSA: {oldEdDSA, rotatedEdDSA},
+		AlgHS256: {oldHS256, rotatedHS256},
+	}
+}
+
+func TestJWTSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	for alg, keySets := range testKeySets(t) {
+		t.Run(alg, func(t *testing.T) {
+			oldKeys, rotatedKeys := keySets[0], keySets[1]
+
+			token, err := oldKeys.Sign(testClaims(now))
+			require.NoError(t, err)
+			assert.True(t, IsJWT(token))
+
+			claims, err := oldKeys.Verify(token, now.Add(time.Minute))
+			require.NoError(t, err)
+
+			want := testClaims(now)
+			want.ID = claims.ID
+			assert.NotEmpty(t, claims.ID)
+			assert.Equal(t, want, claims)
+
+			// tokens of the previous key keep working after a rotation, but
+			// tokens of the new key aren't known to the old key set
+			_, err = rotatedKeys.Verify(token, now)
+			assert.NoError(t, err)
+
+			rotatedToken, err := rotatedKeys.Sign(testClaims(now))
+			require.NoError(t, err)
+
+			_, err = oldKeys.Verify(rotatedToken, now)
+			assert.ErrorIs(t, err, ErrInvalidJWT)
+
+			_, err = oldKeys.Verify(token, now.Add(16*time.Minute))
+			assert.ErrorIs(t, err, ErrExpiredJWT)
+		})
+	}
+}
+
+func TestJWTVerifyRejectsTampering(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	keySets := testKeySets(t)
+	eddsa, hs256 := keySets[AlgEdDSA][0], keySets[AlgHS256][0]
+
+	token, err := eddsa.Sign(testClaims(now))
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	otherClaims := testClaims(now)
+	otherClaims.UserID = 1
+	otherToken, err := eddsa.Sign(otherClaims)
+	require.NoError(t, err)
+	otherParts := strings.Split(otherToken, ".")
+
+	hsToken, err := hs256.Sign(testClaims(now))
+	require.NoError(t, err)
+
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	tests := map[string]string{
+		"swapped payload":  parts[0] + "." + otherParts[1] + "." + parts[2],
+		"alg none":         noneHeader + "." + parts[1] + ".",
+		"other algorithm":  hsToken,
+		"not a jwt":        "ABCDEF",
+		"broken signature": parts[0] + "." + parts[1] + ".!!",
+	}
+
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := eddsa.Verify(tampered, now)
+			assert.ErrorIs(t, err, ErrInvalidJWT)
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keySets := testKeySets(t)
+
+	jwks := keySets[AlgEdDSA][1].JWKS()
+	require.Len(t, jwks, 2)
+
+	for _, jwk := range jwks {
+		assert.Equal(t, "OKP", jwk.Kty)
+		assert.Equal(t, "Ed25519", jwk.Crv)
+		assert.Equal(t, AlgEdDSA, jwk.Alg)
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		require.NoError(t, err)
+		assert.Len(t, x, ed25519.PublicKeySize)
+	}
+
+	assert.Empty(t, keySets[AlgHS256][1].JWKS())
+}
+
+func TestKeySetErrors(t *testing.T) {
+	_, err := NewEdDSAKeySet([][]byte{[]byte("short")})
+	assert.Error(t, err)
+
+	_, err = NewHS256KeySet([][]byte{[]byte("short")})
+	assert.Error(t, err)
+
+	_, err = NewEdDSAKeySet(nil)
+	assert.Error(t, err)
+}
+
+func TestDenyList(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	dl := NewDenyList()
+
+	claims := testClaims(now)
+	claims.ID = "jti-1"
+	assert.False(t, dl.Denied(claims))
+
+	dl.Add(Revocation{JTI: "jti-1", Expiry: now.Add(time.Hour)})
+	assert.True(t, dl.Denied(claims))
+
+	sibling := testClaims(now)
+	sibling.ID = "jti-2"
+	assert.False(t, dl.Denied(sibling))
+
+	dl.Add(Revocation{FamilyID: "family", Expiry: now.Add(time.Hour)})
+	assert.True(t, dl.Denied(sibling))
+
+	other := testClaims(now)
+	other.ID = "jti-3"
+	other.FamilyID = "other-family"
+	assert.False(t, dl.Denied(other))
+
+	// a token of the same second as the revocation is the one the revoking request got
+	dl.Add(Revocation{UserID: 42, RevokedAt: now.Add(500 * time.Millisecond), Expiry: now.Add(time.Hour)})
+	assert.False(t, dl.Denied(other))
+
+	other.IssuedAt = now.Add(-time.Second)
+	assert.True(t, dl.Denied(other))
+
+	dl.Replace(nil)
+	assert.False(t, dl.Denied(claims))
+}
@@ -4,11 +4,27 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"strings"
 	"time"
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth          = "authentication"
+	ScopeRefresh       = "refresh"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+	// ScopeMFAChallenge is what a login with the right password gets when the
+	// user has 2FA on, it is traded for an auth token together with a code
+	ScopeMFAChallenge = "mfa-challenge"
+)
+
+// APIKeyPrefix tells api keys apart from the base32 tokens, which never
+// contain an underscore
+const APIKeyPrefix = "wt_"
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
 )
 
 type Token struct {
@@ -17,6 +33,42 @@ type Token struct {
 	UserID    int       `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// FamilyID groups the access and refresh tokens of a single login
+	FamilyID string `json:"-"`
+	// Stateless tokens, like JWTs, aren't stored
+	Stateless bool `json:"-"`
+	// the client the token was issued to, shown in the list of sessions
+	UserAgent string `json:"-"`
+	IP        string `json:"-"`
+}
+
+// TTLs configures how long the tokens of a Pair stay valid
+type TTLs struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
+// Pair is what a client gets when it logs in: a short lived access token to
+// authenticate with and a long lived refresh token to get the next pair with
+type Pair struct {
+	Access  *Token
+	Refresh *Token
+}
+
+// Hash is how a plaintext token is stored, tokens are never kept in plaintext
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+func randomString() (string, error) {
+	emptyBytes := make([]byte, 32)
+	_, err := rand.Read(emptyBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes), nil
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -26,14 +78,90 @@ func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 		Scope:  scope,
 	}
 
-	emptyBytes := make([]byte, 32)
-	_, err := rand.Read(emptyBytes)
+	var err error
+	token.Plaintext, err = randomString()
 	if err != nil {
 		return nil, err
 	}
 
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes)
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Hash = Hash(token.Plaintext)
 	return token, nil
 }
+
+// NewFamilyID starts a new token family, used for every fresh login
+func NewFamilyID() (string, error) {
+	return randomString()
+}
+
+// GeneratePair creates the next access and refresh token of a family for the
+// client with userAgent and ip
+func GeneratePair(userID int, familyID string, ttls TTLs, userAgent, ip string) (*Pair, error) {
+	access, err := GenerateToken(userID, ttls.Access, ScopeAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := GenerateToken(userID, ttls.Refresh, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		token.FamilyID = familyID
+		token.UserAgent = userAgent
+		token.IP = ip
+	}
+
+	return &Pair{Access: access, Refresh: refresh}, nil
+}
+
+// GenerateAPIKey returns a new plaintext api key, like tokens it is only
+// stored hashed
+func GenerateAPIKey() (string, error) {
+	random, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + strings.ToLower(random), nil
+}
+
+// GenerateShareToken returns the token of a new share link, it is as hard to
+// guess as the other tokens and lowercase to look good in a url
+func GenerateShareToken() (string, error) {
+	random, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(random), nil
+}
+
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, APIKeyPrefix)
+}
+
+// GenerateRecoveryCodes returns n single use codes to pass 2FA with when the
+// authenticator app is lost, formatted like "abcde-fghij"
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		random := make([]byte, 7)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random))
+		codes = append(codes, code[:5]+"-"+code[5:10])
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode is the form a recovery code is hashed in, so it
+// doesn't matter how it is typed
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
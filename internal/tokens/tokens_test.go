@@ -0,0 +1,75 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratePair(t *testing.T) {
+	familyID, err := NewFamilyID()
+	require.NoError(t, err)
+
+	before := time.Now()
+	pair, err := GeneratePair(7, familyID, TTLs{Access: 10 * time.Minute, Refresh: 48 * time.Hour}, "curl/8.0", "192.0.2.1")
+	require.NoError(t, err)
+
+	assert.Equal(t, ScopeAuth, pair.Access.Scope)
+	assert.Equal(t, ScopeRefresh, pair.Refresh.Scope)
+	assert.NotEqual(t, pair.Access.Plaintext, pair.Refresh.Plaintext)
+
+	for _, token := range []*Token{pair.Access, pair.Refresh} {
+		assert.Equal(t, 7, token.UserID)
+		assert.Equal(t, familyID, token.FamilyID)
+		assert.Equal(t, "curl/8.0", token.UserAgent)
+		assert.Equal(t, "192.0.2.1", token.IP)
+		assert.Equal(t, Hash(token.Plaintext), token.Hash)
+	}
+
+	assert.WithinDuration(t, before.Add(10*time.Minute), pair.Access.Expiry, time.Second)
+	assert.WithinDuration(t, before.Add(48*time.Hour), pair.Refresh.Expiry, time.Second)
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, IsAPIKey(key))
+	assert.Len(t, key, len(APIKeyPrefix)+52)
+
+	token, err := GenerateToken(1, time.Minute, ScopeAuth)
+	require.NoError(t, err)
+
+	assert.False(t, IsAPIKey(token.Plaintext))
+}
+
+func TestGenerateShareToken(t *testing.T) {
+	first, err := GenerateShareToken()
+	require.NoError(t, err)
+
+	second, err := GenerateShareToken()
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^[a-z2-7]{52}$`, first)
+	assert.NotEqual(t, first, second)
+	assert.False(t, IsAPIKey(first))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	assert.Equal(t, NormalizeRecoveryCode(codes[0]), NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 test vectors of RFC 6238, appendix B
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	key, err := decodeSecret(rfcSecret)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+
+		assert.Equal(t, tt.want, hotp(key, Step(at), 8))
+
+		code, err := Code(rfcSecret, at)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want[2:], code, "six digits are the last six of the eight")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	previous, err := Code(secret, now.Add(-Period))
+	require.NoError(t, err)
+
+	tooOld, err := Code(secret, now.Add(-2*Period))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current code", secret: secret, code: code, wantStep: Step(now), wantOK: true},
+		{name: "spaces and lower case are fine", secret: strings.ToLower(secret[:8] + " " + secret[8:]), code: code[:3] + " " + code[3:], wantStep: Step(now), wantOK: true},
+		{name: "previous period", secret: secret, code: previous, wantStep: Step(now) - 1, wantOK: true},
+		{name: "two periods ago", secret: secret, code: tooOld, wantOK: tooOld == code || tooOld == previous},
+		{name: "wrong length", secret: secret, code: code[:5]},
+		{name: "invalid secret", secret: "not base32!", code: code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now)
+
+			assert.Equal(t, tt.wantOK, ok)
+
+			if tt.wantStep != 0 {
+				assert.Equal(t, tt.wantStep, step)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Workout Tracker", "jane@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Workout%20Tracker:jane@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Workout+Tracker")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
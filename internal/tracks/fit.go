@@ -0,0 +1,455 @@
+package tracks
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+// FIT is the binary format of Garmin and most other devices. Only the record
+// and session messages are decoded, everything else is skipped.
+
+var (
+	errInvalidFIT  = errors.New("not a fit file")
+	errFITChecksum = errors.New("checksum mismatch")
+	errFITTruncate = errors.New("unexpected end of file")
+)
+
+// timestamps are seconds since the FIT epoch
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+const (
+	fitMesgSession = 18
+	fitMesgRecord  = 20
+
+	fitFieldTimestamp = 253
+)
+
+// record fields
+const (
+	fitRecordLatitude         = 0
+	fitRecordLongitude        = 1
+	fitRecordAltitude         = 2
+	fitRecordHeartRate        = 3
+	fitRecordCadence          = 4
+	fitRecordDistance         = 5
+	fitRecordEnhancedAltitude = 78
+)
+
+// session fields
+const (
+	fitSessionStartTime    = 2
+	fitSessionSport        = 5
+	fitSessionElapsedTime  = 7
+	fitSessionTimerTime    = 8
+	fitSessionDistance     = 9
+	fitSessionCalories     = 11
+	fitSessionAvgHeartRate = 16
+	fitSessionMaxHeartRate = 17
+	fitSessionAvgCadence   = 18
+	fitSessionTotalAscent  = 22
+)
+
+var fitSports = map[int64]string{
+	1:  SportRunning,
+	2:  SportCycling,
+	5:  SportSwimming,
+	11: SportWalking,
+	15: SportRowing,
+	17: SportWalking, // hiking
+}
+
+type fitFieldDefinition struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	bigEndian bool
+	global    uint16
+	fields    []fitFieldDefinition
+	devSize   int
+}
+
+// fitMessage holds the valid numeric fields of a data message
+type fitMessage map[byte]int64
+
+func parseFIT(r io.Reader) (*Activity, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 {
+		return nil, errInvalidFIT
+	}
+
+	headerSize := int(data[0])
+
+	if headerSize < 12 || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return nil, errInvalidFIT
+	}
+
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+
+	if len(data) < end+2 {
+		return nil, errFITTruncate
+	}
+
+	if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return nil, errFITChecksum
+	}
+
+	activity := &Activity{}
+	definitions := map[byte]*fitDefinition{}
+	var lastTimestamp int64
+
+	pos := headerSize
+
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		// compressed timestamp header, the offset is relative to the last timestamp
+		if header&0x80 != 0 {
+			definition := definitions[(header>>5)&0x03]
+
+			if definition == nil {
+				return nil, errInvalidFIT
+			}
+
+			offset := int64(header & 0x1f)
+			timestamp := lastTimestamp&^0x1f + offset
+
+			if offset < lastTimestamp&0x1f {
+				timestamp += 0x20
+			}
+
+			lastTimestamp = timestamp
+
+			message, next, err := readFITMessage(data[:end], pos, definition)
+
+			if err != nil {
+				return nil, err
+			}
+
+			pos = next
+			message[fitFieldTimestamp] = timestamp
+			activity.addFITMessage(definition.global, message)
+			continue
+		}
+
+		local := header & 0x0f
+
+		if header&0x40 != 0 {
+			definition, next, err := readFITDefinition(data[:end], pos, header&0x20 != 0)
+
+			if err != nil {
+				return nil, err
+			}
+
+			pos = next
+			definitions[local] = definition
+			continue
+		}
+
+		definition := definitions[local]
+
+		if definition == nil {
+			return nil, errInvalidFIT
+		}
+
+		message, next, err := readFITMessage(data[:end], pos, definition)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pos = next
+
+		if timestamp, ok := message[fitFieldTimestamp]; ok {
+			lastTimestamp = timestamp
+		}
+
+		activity.addFITMessage(definition.global, message)
+	}
+
+	return activity, nil
+}
+
+func readFITDefinition(data []byte, pos int, hasDeveloperFields bool) (*fitDefinition, int, error) {
+	if pos+5 > len(data) {
+		return nil, 0, errFITTruncate
+	}
+
+	definition := &fitDefinition{bigEndian: data[pos+1] == 1}
+
+	if definition.bigEndian {
+		definition.global = binary.BigEndian.Uint16(data[pos+2 : pos+4])
+	} else {
+		definition.global = binary.LittleEndian.Uint16(data[pos+2 : pos+4])
+	}
+
+	fieldCount := int(data[pos+4])
+	pos += 5
+
+	if pos+fieldCount*3 > len(data) {
+		return nil, 0, errFITTruncate
+	}
+
+	for i := 0; i < fieldCount; i++ {
+		definition.fields = append(definition.fields, fitFieldDefinition{
+			num:      data[pos],
+			size:     int(data[pos+1]),
+			baseType: data[pos+2],
+		})
+		pos += 3
+	}
+
+	if hasDeveloperFields {
+		if pos >= len(data) {
+			return nil, 0, errFITTruncate
+		}
+
+		developerCount := int(data[pos])
+		pos++
+
+		if pos+developerCount*3 > len(data) {
+			return nil, 0, errFITTruncate
+		}
+
+		for i := 0; i < developerCount; i++ {
+			definition.devSize += int(data[pos+1])
+			pos += 3
+		}
+	}
+
+	return definition, pos, nil
+}
+
+func readFITMessage(data []byte, pos int, definition *fitDefinition) (fitMessage, int, error) {
+	message := fitMessage{}
+
+	for _, field := range definition.fields {
+		if pos+field.size > len(data) {
+			return nil, 0, errFITTruncate
+		}
+
+		if value, ok := decodeFITValue(data[pos:pos+field.size], field.baseType, definition.bigEndian); ok {
+			message[field.num] = value
+		}
+
+		pos += field.size
+	}
+
+	if pos+definition.devSize > len(data) {
+		return nil, 0, errFITTruncate
+	}
+
+	return message, pos + definition.devSize, nil
+}
+
+// decodeFITValue decodes a single integer value, arrays, strings, floats and
+// the invalid value of a base type are skipped
+func decodeFITValue(raw []byte, baseType byte, bigEndian bool) (int64, bool) {
+	var order binary.ByteOrder = binary.LittleEndian
+
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	var value uint64
+
+	switch len(raw) {
+	case 1:
+		value = uint64(raw[0])
+	case 2:
+		value = uint64(order.Uint16(raw))
+	case 4:
+		value = uint64(order.Uint32(raw))
+	case 8:
+		value = order.Uint64(raw)
+	default:
+		return 0, false
+	}
+
+	bits := uint(len(raw) * 8)
+	allOnes := uint64(1)<<bits - 1
+
+	if bits == 64 {
+		allOnes = math.MaxUint64
+	}
+
+	switch baseType & 0x1f {
+	// enum, uint8, uint16, uint32, byte and uint64
+	case 0x00, 0x02, 0x04, 0x06, 0x0d, 0x0f:
+		if value == allOnes {
+			return 0, false
+		}
+
+		return int64(value), true
+	// the z variants use zero as invalid value
+	case 0x0a, 0x0b, 0x0c, 0x10:
+		if value == 0 {
+			return 0, false
+		}
+
+		return int64(value), true
+	// sint8, sint16, sint32 and sint64
+	case 0x01, 0x03, 0x05, 0x0e:
+		if value == allOnes>>1 {
+			return 0, false
+		}
+
+		// sign extend
+		shift := 64 - bits
+		return int64(value<<shift) >> shift, true
+	}
+
+	return 0, false
+}
+
+func (a *Activity) addFITMessage(global uint16, message fitMessage) {
+	switch global {
+	case fitMesgRecord:
+		a.Points = append(a.Points, fitTrackPoint(message))
+	case fitMesgSession:
+		a.addFITSession(message)
+	}
+}
+
+func fitTrackPoint(message fitMessage) store.TrackPoint {
+	point := store.TrackPoint{}
+
+	if value, ok := message[fitFieldTimestamp]; ok {
+		recordedAt := fitTime(value)
+		point.RecordedAt = &recordedAt
+	}
+
+	latitude, hasLatitude := message[fitRecordLatitude]
+	longitude, hasLongitude := message[fitRecordLongitude]
+
+	if hasLatitude && hasLongitude {
+		lat, lon := semicirclesToDegrees(latitude), semicirclesToDegrees(longitude)
+		point.Latitude = &lat
+		point.Longitude = &lon
+	}
+
+	altitude, ok := message[fitRecordEnhancedAltitude]
+
+	if !ok {
+		altitude, ok = message[fitRecordAltitude]
+	}
+
+	if ok {
+		elevation := round2(float64(altitude)/5 - 500)
+		point.ElevationMeters = &elevation
+	}
+
+	if value, ok := message[fitRecordHeartRate]; ok {
+		heartRate := int(value)
+		point.HeartRate = &heartRate
+	}
+
+	if value, ok := message[fitRecordCadence]; ok {
+		cadence := int(value)
+		point.Cadence = &cadence
+	}
+
+	if value, ok := message[fitRecordDistance]; ok {
+		distance := float64(value) / 100
+		point.DistanceMeters = &distance
+	}
+
+	return point
+}
+
+func (a *Activity) addFITSession(message fitMessage) {
+	if value, ok := message[fitSessionSport]; ok {
+		a.Sport = fitSports[value]
+	}
+
+	if value, ok := message[fitSessionStartTime]; ok {
+		a.StartTime = fitTime(value)
+	}
+
+	if value, ok := message[fitSessionElapsedTime]; ok {
+		a.EndTime = a.StartTime.Add(time.Duration(value) * time.Millisecond)
+	}
+
+	timerTime, ok := message[fitSessionTimerTime]
+
+	if !ok {
+		timerTime, ok = message[fitSessionElapsedTime]
+	}
+
+	if ok {
+		duration := int(math.Round(float64(timerTime) / 1000))
+		a.DurationSeconds = &duration
+	}
+
+	if value, ok := message[fitSessionDistance]; ok {
+		distance := float64(value) / 100
+		a.DistanceMeters = &distance
+	}
+
+	if value, ok := message[fitSessionTotalAscent]; ok {
+		ascent := float64(value)
+		a.ElevationGainMeters = &ascent
+	}
+
+	if value, ok := message[fitSessionCalories]; ok {
+		calories := int(value)
+		a.Calories = &calories
+	}
+
+	if value, ok := message[fitSessionAvgHeartRate]; ok {
+		heartRate := int(value)
+		a.AvgHeartRate = &heartRate
+	}
+
+	if value, ok := message[fitSessionMaxHeartRate]; ok {
+		heartRate := int(value)
+		a.MaxHeartRate = &heartRate
+	}
+
+	if value, ok := message[fitSessionAvgCadence]; ok {
+		cadence := int(value)
+		a.AvgCadence = &cadence
+	}
+}
+
+func fitTime(seconds int64) time.Time {
+	return fitEpoch.Add(time.Duration(seconds) * time.Second)
+}
+
+func semicirclesToDegrees(semicircles int64) float64 {
+	return float64(semicircles) * 180 / math.Pow(2, 31)
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xcc01, 0xd801, 0x1400, 0xf001, 0x3c00, 0x2800, 0xe401,
+	0xa001, 0x6c00, 0x7800, 0xb401, 0x5000, 0x9c01, 0x8801, 0x4400,
+}
+
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0x0f]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ fitCRCTable[b&0x0f]
+
+		tmp = fitCRCTable[crc&0x0f]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0x0f]
+	}
+
+	return crc
+}
@@ -0,0 +1,73 @@
+package tracks
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Latitude  float64    `xml:"lat,attr"`
+	Longitude float64    `xml:"lon,attr"`
+	Elevation *float64   `xml:"ele"`
+	Time      *time.Time `xml:"time"`
+	// heart rate and cadence are stored in the garmin track point extension
+	HeartRate *int `xml:"extensions>TrackPointExtension>hr"`
+	Cadence   *int `xml:"extensions>TrackPointExtension>cad"`
+}
+
+func parseGPX(r io.Reader) (*Activity, error) {
+	var file gpxFile
+
+	err := xml.NewDecoder(r).Decode(&file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &Activity{
+		Name: file.Metadata.Name,
+	}
+
+	for _, track := range file.Tracks {
+		if activity.Name == "" {
+			activity.Name = track.Name
+		}
+
+		if activity.Sport == "" {
+			activity.Sport = track.Type
+		}
+
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				latitude, longitude := point.Latitude, point.Longitude
+
+				activity.Points = append(activity.Points, store.TrackPoint{
+					RecordedAt:      point.Time,
+					Latitude:        &latitude,
+					Longitude:       &longitude,
+					ElevationMeters: point.Elevation,
+					HeartRate:       point.HeartRate,
+					Cadence:         point.Cadence,
+				})
+			}
+		}
+	}
+
+	return activity, nil
+}
@@ -0,0 +1,101 @@
+package tracks
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Laps  []struct {
+			StartTime        time.Time  `xml:"StartTime,attr"`
+			TotalTimeSeconds float64    `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64    `xml:"DistanceMeters"`
+			Calories         int        `xml:"Calories"`
+			Points           []tcxPoint `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxPoint struct {
+	Time      *time.Time `xml:"Time"`
+	Latitude  *float64   `xml:"Position>LatitudeDegrees"`
+	Longitude *float64   `xml:"Position>LongitudeDegrees"`
+	Altitude  *float64   `xml:"AltitudeMeters"`
+	Distance  *float64   `xml:"DistanceMeters"`
+	HeartRate *int       `xml:"HeartRateBpm>Value"`
+	Cadence   *int       `xml:"Cadence"`
+	// running cadence lives in the activity extension
+	RunCadence *int `xml:"Extensions>TPX>RunCadence"`
+}
+
+// parseTCX reads the first activity of the file, the lap totals win over the track points
+func parseTCX(r io.Reader) (*Activity, error) {
+	var file tcxFile
+
+	err := xml.NewDecoder(r).Decode(&file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	activity := &Activity{}
+
+	if len(file.Activities) == 0 {
+		return activity, nil
+	}
+
+	var totalTime, totalDistance float64
+	var totalCalories int
+
+	activity.Sport = file.Activities[0].Sport
+
+	for i, lap := range file.Activities[0].Laps {
+		if i == 0 {
+			activity.StartTime = lap.StartTime
+		}
+
+		totalTime += lap.TotalTimeSeconds
+		totalDistance += lap.DistanceMeters
+		totalCalories += lap.Calories
+
+		for _, point := range lap.Points {
+			cadence := point.Cadence
+
+			if cadence == nil {
+				cadence = point.RunCadence
+			}
+
+			activity.Points = append(activity.Points, store.TrackPoint{
+				RecordedAt:      point.Time,
+				Latitude:        point.Latitude,
+				Longitude:       point.Longitude,
+				ElevationMeters: point.Altitude,
+				DistanceMeters:  point.Distance,
+				HeartRate:       point.HeartRate,
+				Cadence:         cadence,
+			})
+		}
+	}
+
+	if totalTime > 0 {
+		duration := int(math.Round(totalTime))
+		activity.DurationSeconds = &duration
+	}
+
+	if totalDistance > 0 {
+		distance := round2(totalDistance)
+		activity.DistanceMeters = &distance
+	}
+
+	if totalCalories > 0 {
+		activity.Calories = &totalCalories
+	}
+
+	return activity, nil
+}
@@ -0,0 +1,325 @@
+// Package tracks parses the GPX, TCX and FIT files that GPS watches and bike
+// computers record into workouts with a single cardio entry.
+package tracks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+)
+
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+	FormatFIT = "fit"
+)
+
+const (
+	SportRunning  = "running"
+	SportCycling  = "cycling"
+	SportWalking  = "walking"
+	SportRowing   = "rowing"
+	SportSwimming = "swimming"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported file format, use gpx, tcx or fit")
+	ErrNoTrackPoints     = errors.New("the file has no track points")
+)
+
+// the files don't know the body weight of the athlete, calories that have to
+// be estimated assume an average adult
+const defaultBodyMassKg = 70
+
+// metabolic equivalents used to estimate the calories of a sport
+var sportMET = map[string]float64{
+	SportRunning:  9.8,
+	SportCycling:  7.5,
+	SportWalking:  3.5,
+	SportRowing:   7.0,
+	SportSwimming: 8.0,
+}
+
+const defaultMET = 6.0
+
+// the catalog exercise an imported sport is logged as
+var sportExercise = map[string]string{
+	SportRunning:  "Running",
+	SportCycling:  "Cycling",
+	SportWalking:  "Walking",
+	SportRowing:   "Rowing",
+	SportSwimming: "Swimming",
+}
+
+// Activity is a parsed file. The summary fields that were recorded by the
+// device are kept, the missing ones are derived from the points.
+type Activity struct {
+	Name                string
+	Sport               string
+	StartTime           time.Time
+	EndTime             time.Time
+	DurationSeconds     *int
+	DistanceMeters      *float64
+	ElevationGainMeters *float64
+	AvgHeartRate        *int
+	MaxHeartRate        *int
+	AvgCadence          *int
+	Calories            *int
+	Points              []store.TrackPoint
+}
+
+// FormatFromFilename returns the format of an uploaded file based on its extension
+func FormatFromFilename(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+func Parse(format string, r io.Reader) (*Activity, error) {
+	var activity *Activity
+	var err error
+
+	switch strings.ToLower(format) {
+	case FormatGPX:
+		activity, err = parseGPX(r)
+	case FormatTCX:
+		activity, err = parseTCX(r)
+	case FormatFIT:
+		activity, err = parseFIT(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file: %w", format, err)
+	}
+
+	if len(activity.Points) == 0 {
+		return nil, ErrNoTrackPoints
+	}
+
+	activity.Sport = normalizeSport(activity.Sport)
+	activity.summarize()
+
+	return activity, nil
+}
+
+func normalizeSport(sport string) string {
+	sport = strings.ToLower(sport)
+
+	switch {
+	case strings.Contains(sport, "run"):
+		return SportRunning
+	case strings.Contains(sport, "bik"), strings.Contains(sport, "cycl"), strings.Contains(sport, "ride"):
+		return SportCycling
+	case strings.Contains(sport, "walk"), strings.Contains(sport, "hik"):
+		return SportWalking
+	case strings.Contains(sport, "row"):
+		return SportRowing
+	case strings.Contains(sport, "swim"):
+		return SportSwimming
+	}
+
+	return ""
+}
+
+func (a *Activity) summarize() {
+	var first, last *time.Time
+	var distance, gain float64
+	var heartRateSum, heartRateCount, maxHeartRate, cadenceSum, cadenceCount int
+	var recordedDistance *float64
+	var prev *store.TrackPoint
+
+	for i := range a.Points {
+		point := &a.Points[i]
+
+		if point.RecordedAt != nil {
+			if first == nil {
+				first = point.RecordedAt
+			}
+
+			last = point.RecordedAt
+		}
+
+		if point.DistanceMeters != nil {
+			recordedDistance = point.DistanceMeters
+		}
+
+		if prev != nil {
+			if hasPosition(prev) && hasPosition(point) {
+				distance += haversine(*prev.Latitude, *prev.Longitude, *point.Latitude, *point.Longitude)
+			}
+
+			if prev.ElevationMeters != nil && point.ElevationMeters != nil && *point.ElevationMeters > *prev.ElevationMeters {
+				gain += *point.ElevationMeters - *prev.ElevationMeters
+			}
+		}
+
+		// gpx files have no distance of their own, keep a running total instead
+		if recordedDistance == nil && hasPosition(point) {
+			pointDistance := round2(distance)
+			point.DistanceMeters = &pointDistance
+		}
+
+		if point.HeartRate != nil {
+			heartRateSum += *point.HeartRate
+			heartRateCount++
+			maxHeartRate = max(maxHeartRate, *point.HeartRate)
+		}
+
+		if point.Cadence != nil {
+			cadenceSum += *point.Cadence
+			cadenceCount++
+		}
+
+		prev = point
+	}
+
+	if a.StartTime.IsZero() && first != nil {
+		a.StartTime = *first
+	}
+
+	if a.EndTime.IsZero() && last != nil {
+		a.EndTime = *last
+	}
+
+	if a.DurationSeconds == nil && !a.StartTime.IsZero() && a.EndTime.After(a.StartTime) {
+		duration := int(a.EndTime.Sub(a.StartTime).Seconds())
+		a.DurationSeconds = &duration
+	}
+
+	if a.EndTime.IsZero() && a.DurationSeconds != nil {
+		a.EndTime = a.StartTime.Add(time.Duration(*a.DurationSeconds) * time.Second)
+	}
+
+	if a.DistanceMeters == nil {
+		if recordedDistance != nil {
+			distance = *recordedDistance
+		}
+
+		if distance > 0 {
+			total := round2(distance)
+			a.DistanceMeters = &total
+		}
+	}
+
+	if a.ElevationGainMeters == nil && gain > 0 {
+		total := round2(gain)
+		a.ElevationGainMeters = &total
+	}
+
+	if a.AvgHeartRate == nil && heartRateCount > 0 {
+		avg := int(math.Round(float64(heartRateSum) / float64(heartRateCount)))
+		a.AvgHeartRate = &avg
+	}
+
+	if a.MaxHeartRate == nil && heartRateCount > 0 {
+		a.MaxHeartRate = &maxHeartRate
+	}
+
+	if a.AvgCadence == nil && cadenceCount > 0 {
+		avg := int(math.Round(float64(cadenceSum) / float64(cadenceCount)))
+		a.AvgCadence = &avg
+	}
+
+	if a.Calories == nil && a.DurationSeconds != nil {
+		met, ok := sportMET[a.Sport]
+
+		if !ok {
+			met = defaultMET
+		}
+
+		calories := int(math.Round(met * defaultBodyMassKg * float64(*a.DurationSeconds) / 3600))
+		a.Calories = &calories
+	}
+}
+
+// Workout turns the activity into a workout with a single cardio entry. The
+// duration of the entry is the recorded (moving) time, the workout spans the
+// whole activity.
+func (a *Activity) Workout() *store.Workout {
+	exerciseName, ok := sportExercise[a.Sport]
+
+	if !ok {
+		exerciseName = "Cardio"
+	}
+
+	title := a.Name
+
+	if title == "" {
+		title = exerciseName
+	}
+
+	workout := &store.Workout{
+		Title:    title,
+		Timezone: store.DefaultTimezone,
+	}
+
+	if a.Calories != nil {
+		workout.CaloriesBurned = *a.Calories
+	}
+
+	if !a.StartTime.IsZero() {
+		start, end := a.StartTime, a.EndTime
+		workout.PerformedAt = start
+		workout.StartedAt = &start
+
+		if !end.Before(start) {
+			workout.EndedAt = &end
+			workout.DurationMinutes = int(math.Round(end.Sub(start).Minutes()))
+		}
+	}
+
+	if workout.EndedAt == nil && a.DurationSeconds != nil {
+		workout.DurationMinutes = int(math.Round(float64(*a.DurationSeconds) / 60))
+	}
+
+	workout.Entries = []store.WorkoutEntry{
+		{
+			ExerciseName:        exerciseName,
+			Kind:                store.EntryKindCardio,
+			ElevationGainMeters: a.ElevationGainMeters,
+			AvgHeartRate:        a.AvgHeartRate,
+			MaxHeartRate:        a.MaxHeartRate,
+			Cadence:             a.AvgCadence,
+			OrderIndex:          1,
+			Sets: []store.WorkoutSet{
+				{
+					SetType:         store.SetTypeWorking,
+					DurationSeconds: a.DurationSeconds,
+					DistanceMeters:  a.DistanceMeters,
+					Completed:       true,
+				},
+			},
+		},
+	}
+
+	return workout
+}
+
+func hasPosition(point *store.TrackPoint) bool {
+	return point.Latitude != nil && point.Longitude != nil
+}
+
+const earthRadiusMeters = 6371000
+
+// haversine returns the distance in meters between two coordinates
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,180 @@
+package tracks
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/edwinboon/workout-tracking-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFixture(t *testing.T, filename string) *Activity {
+	file, err := os.Open("testdata/" + filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	activity, err := Parse(FormatFromFilename(filename), file)
+	require.NoError(t, err)
+
+	return activity
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file          string
+		name          string
+		sport         string
+		start         time.Time
+		end           time.Time
+		duration      int
+		distance      float64
+		elevationGain float64
+		avgHeartRate  int
+		maxHeartRate  int
+		avgCadence    int
+		calories      int
+		points        int
+	}{
+		{
+			// no distance or calories in the file, both are derived
+			file:          "morning_run.gpx",
+			name:          "Morning Run",
+			sport:         SportRunning,
+			start:         time.Date(2025, 5, 3, 7, 30, 0, 0, time.UTC),
+			end:           time.Date(2025, 5, 3, 7, 34, 30, 0, time.UTC),
+			duration:      270,
+			distance:      900.68,
+			elevationGain: 4.6,
+			avgHeartRate:  149,
+			maxHeartRate:  165,
+			avgCadence:    85,
+			calories:      51,
+			points:        10,
+		},
+		{
+			file:          "evening_ride.tcx",
+			sport:         SportCycling,
+			start:         time.Date(2025, 5, 4, 16, 0, 0, 0, time.UTC),
+			end:           time.Date(2025, 5, 4, 16, 10, 0, 0, time.UTC),
+			duration:      600,
+			distance:      5500,
+			elevationGain: 4,
+			avgHeartRate:  141,
+			maxHeartRate:  150,
+			avgCadence:    89,
+			calories:      200,
+			points:        11,
+		},
+		{
+			// the session has no calories and a timer time below the elapsed time
+			file:          "interval_run.fit",
+			sport:         SportRunning,
+			start:         time.Date(2025, 5, 6, 6, 0, 0, 0, time.UTC),
+			end:           time.Date(2025, 5, 6, 6, 5, 0, 0, time.UTC),
+			duration:      290,
+			distance:      1000,
+			elevationGain: 6,
+			avgHeartRate:  148,
+			maxHeartRate:  155,
+			avgCadence:    86,
+			calories:      55,
+			points:        6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			activity := parseFixture(t, tt.file)
+
+			assert.Equal(t, tt.name, activity.Name)
+			assert.Equal(t, tt.sport, activity.Sport)
+			assert.True(t, tt.start.Equal(activity.StartTime), "start %s", activity.StartTime)
+			assert.True(t, tt.end.Equal(activity.EndTime), "end %s", activity.EndTime)
+			assert.Equal(t, tt.duration, *activity.DurationSeconds)
+			assert.InDelta(t, tt.distance, *activity.DistanceMeters, 0.01)
+			assert.InDelta(t, tt.elevationGain, *activity.ElevationGainMeters, 0.01)
+			assert.Equal(t, tt.avgHeartRate, *activity.AvgHeartRate)
+			assert.Equal(t, tt.maxHeartRate, *activity.MaxHeartRate)
+			assert.Equal(t, tt.avgCadence, *activity.AvgCadence)
+			assert.Equal(t, tt.calories, *activity.Calories)
+			assert.Len(t, activity.Points, tt.points)
+		})
+	}
+}
+
+func TestParseFITRecords(t *testing.T) {
+	activity := parseFixture(t, "interval_run.fit")
+
+	first := activity.Points[0]
+	assert.InDelta(t, 51.92, *first.Latitude, 0.000001)
+	assert.InDelta(t, 4.48, *first.Longitude, 0.000001)
+	assert.Equal(t, 5.0, *first.ElevationMeters)
+	assert.Equal(t, 140, *first.HeartRate)
+
+	// the invalid heart rate of the fourth record is skipped
+	assert.Nil(t, activity.Points[3].HeartRate)
+
+	// the last record uses a compressed timestamp that rolls over
+	last := activity.Points[5]
+	assert.True(t, time.Date(2025, 5, 6, 6, 4, 25, 0, time.UTC).Equal(*last.RecordedAt), "recorded at %s", last.RecordedAt)
+	assert.Equal(t, 1000.0, *last.DistanceMeters)
+}
+
+func TestParseErrors(t *testing.T) {
+	fit, err := os.ReadFile("testdata/interval_run.fit")
+	require.NoError(t, err)
+
+	corrupt := bytes.Clone(fit)
+	corrupt[20] ^= 0xff
+
+	tests := []struct {
+		name    string
+		format  string
+		data    []byte
+		wantErr error
+	}{
+		{name: "unknown format", format: "csv", data: []byte("a,b"), wantErr: ErrUnsupportedFormat},
+		{name: "gpx without points", format: FormatGPX, data: []byte(`<gpx><trk><trkseg></trkseg></trk></gpx>`), wantErr: ErrNoTrackPoints},
+		{name: "broken xml", format: FormatTCX, data: []byte(`<TrainingCenterDatabase>`)},
+		{name: "not a fit file", format: FormatFIT, data: []byte("hello world, this is text"), wantErr: errInvalidFIT},
+		{name: "fit checksum", format: FormatFIT, data: corrupt, wantErr: errFITChecksum},
+		{name: "truncated fit", format: FormatFIT, data: fit[:40], wantErr: errFITTruncate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.format, bytes.NewReader(tt.data))
+
+			require.Error(t, err)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestActivityWorkout(t *testing.T) {
+	workout := parseFixture(t, "interval_run.fit").Workout()
+
+	assert.Equal(t, "Running", workout.Title)
+	assert.Equal(t, 5, workout.DurationMinutes)
+	assert.Equal(t, 55, workout.CaloriesBurned)
+	require.NotNil(t, workout.StartedAt)
+	require.NotNil(t, workout.EndedAt)
+	assert.True(t, workout.PerformedAt.Equal(*workout.StartedAt))
+
+	require.Len(t, workout.Entries, 1)
+	entry := workout.Entries[0]
+	assert.Equal(t, store.EntryKindCardio, entry.Kind)
+	assert.Equal(t, "Running", entry.ExerciseName)
+
+	entry.NormalizeSets()
+
+	assert.Equal(t, 290, *entry.DurationSeconds)
+	assert.Equal(t, 1000.0, *entry.DistanceMeters)
+	assert.Equal(t, 290.0, *entry.PaceSecondsPerKm)
+}
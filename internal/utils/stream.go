@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// rows are flushed to the client in batches instead of one by one
+const streamFlushEvery = 100
+
+var ErrUnsupportedStreamFormat = errors.New("format must be csv, json or ndjson")
+
+// CSVRecorder is implemented by the rows that can be streamed as csv
+type CSVRecorder interface {
+	CSVRecord() []string
+}
+
+// StreamWriter writes a response row by row, unlike WriteJSON nothing is
+// buffered. Once the first row is written the status can't change anymore,
+// so errors halfway can only cut the response short.
+type StreamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	format  string
+	csv     *csv.Writer
+	rows    int
+}
+
+// NewStreamWriter writes the headers of a download called filename, the
+// extension is added based on the format
+func NewStreamWriter(w http.ResponseWriter, format, filename string, csvHeader []string) (*StreamWriter, error) {
+	stream := &StreamWriter{w: w, format: format}
+	stream.flusher, _ = w.(http.Flusher)
+
+	switch format {
+	case FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case FormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		stream.csv = csv.NewWriter(w)
+	default:
+		return nil, ErrUnsupportedStreamFormat
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+format))
+	w.WriteHeader(http.StatusOK)
+
+	switch format {
+	case FormatJSON:
+		_, err := io.WriteString(w, "[\n")
+		return stream, err
+	case FormatCSV:
+		return stream, stream.csv.Write(csvHeader)
+	}
+
+	return stream, nil
+}
+
+func (s *StreamWriter) WriteRow(row interface{}) error {
+	var err error
+
+	switch s.format {
+	case FormatCSV:
+		recorder, ok := row.(CSVRecorder)
+
+		if !ok {
+			return fmt.Errorf("%T can't be written as csv", row)
+		}
+
+		err = s.csv.Write(recorder.CSVRecord())
+	default:
+		err = s.writeJSONRow(row)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.rows++
+
+	if s.rows%streamFlushEvery == 0 {
+		return s.flush()
+	}
+
+	return nil
+}
+
+func (s *StreamWriter) writeJSONRow(row interface{}) error {
+	js, err := json.Marshal(row)
+
+	if err != nil {
+		return err
+	}
+
+	if s.format == FormatJSON && s.rows > 0 {
+		_, err = io.WriteString(s.w, ",\n")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.format == FormatNDJSON {
+		js = append(js, '\n')
+	}
+
+	_, err = s.w.Write(js)
+
+	return err
+}
+
+// Close ends the response, it doesn't close the underlying writer
+func (s *StreamWriter) Close() error {
+	if s.format == FormatJSON {
+		prefix := ""
+
+		if s.rows > 0 {
+			prefix = "\n"
+		}
+
+		_, err := io.WriteString(s.w, prefix+"]\n")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.flush()
+}
+
+func (s *StreamWriter) flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRow struct {
+	Name string `json:"name"`
+	Reps int    `json:"reps"`
+}
+
+func (row testRow) CSVRecord() []string {
+	return []string{row.Name, "5"}
+}
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		format      string
+		rows        []testRow
+		contentType string
+		want        string
+	}{
+		{format: FormatJSON, rows: []testRow{{"Squat", 5}, {"Bench", 5}}, contentType: "application/json", want: "[\n{\"name\":\"Squat\",\"reps\":5},\n{\"name\":\"Bench\",\"reps\":5}\n]\n"},
+		{format: FormatJSON, contentType: "application/json", want: "[\n]\n"},
+		{format: FormatNDJSON, rows: []testRow{{"Squat", 5}, {"Bench", 5}}, contentType: "application/x-ndjson", want: "{\"name\":\"Squat\",\"reps\":5}\n{\"name\":\"Bench\",\"reps\":5}\n"},
+		{format: FormatCSV, rows: []testRow{{"Squat, low bar", 5}}, contentType: "text/csv", want: "name,reps\n\"Squat, low bar\",5\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			stream, err := NewStreamWriter(rr, tt.format, "export", []string{"name", "reps"})
+			require.NoError(t, err)
+
+			for _, row := range tt.rows {
+				require.NoError(t, stream.WriteRow(row))
+			}
+
+			require.NoError(t, stream.Close())
+
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, `attachment; filename="export.`+tt.format+`"`, rr.Header().Get("Content-Disposition"))
+			assert.Equal(t, tt.want, rr.Body.String())
+		})
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		_, err := NewStreamWriter(rr, "xml", "export", nil)
+
+		assert.ErrorIs(t, err, ErrUnsupportedStreamFormat)
+		assert.Empty(t, rr.Body.String())
+	})
+}
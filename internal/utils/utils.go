@@ -2,9 +2,11 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -28,17 +30,94 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadIDParam(r *http.Request) (int64, error) {
-	idParam := chi.URLParam(r, "id")
+	return ReadInt64Param(r, "id")
+}
+
+// ReadInt64Param reads a numeric url param other than id, like a nested id
+func ReadInt64Param(r *http.Request, name string) (int64, error) {
+	param := chi.URLParam(r, name)
+
+	if param == "" {
+		return 0, fmt.Errorf("missing %s parameter", name)
+	}
+
+	value, err := strconv.ParseInt(param, 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return value, nil
+}
+
+// ReadIntQuery returns nil when the query parameter is not present
+func ReadIntQuery(r *http.Request, key string) (*int, error) {
+	value := r.URL.Query().Get(key)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	i, err := strconv.Atoi(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter", key)
+	}
+
+	return &i, nil
+}
 
-	if idParam == "" {
-		return 0, errors.New("missing id parameter")
+// ReadTimeQuery accepts both a date (2006-01-02) and a full RFC3339 timestamp
+func ReadTimeQuery(r *http.Request, key string) (*time.Time, error) {
+	value := r.URL.Query().Get(key)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+
+	if err == nil {
+		return &t, nil
+	}
+
+	t, err = time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter", key)
 	}
 
-	id, err := strconv.ParseInt(idParam, 10, 64)
+	return &t, nil
+}
+
+// ReadEndTimeQuery is ReadTimeQuery for the exclusive end of a range, a date
+// without a time includes that whole day so it ends at the start of the next
+func ReadEndTimeQuery(r *http.Request, key string) (*time.Time, error) {
+	t, err := ReadTimeQuery(r, key)
+
+	if err != nil || t == nil {
+		return t, err
+	}
+
+	_, err = time.Parse(time.DateOnly, r.URL.Query().Get(key))
+
+	// a timestamp is used as is
+	if err != nil {
+		return t, nil
+	}
+
+	end := t.AddDate(0, 0, 1)
+	return &end, nil
+}
+
+// ClientIP is the address of the connection, X-Forwarded-For is ignored since
+// anyone can send it
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 
 	if err != nil {
-		return 0, errors.New("invalid id parameter")
+		return r.RemoteAddr
 	}
 
-	return id, nil
+	return host
 }
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			assert.Equal(t, tt.want, ClientIP(r))
+		})
+	}
+}
+
+func TestReadEndTimeQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    *time.Time
+		wantErr bool
+	}{
+		{query: "", want: nil},
+		{query: "to=2025-05-31", want: timePtr(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))},
+		{query: "to=2025-05-31T18:00:00Z", want: timePtr(time.Date(2025, 5, 31, 18, 0, 0, 0, time.UTC))},
+		{query: "to=yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			got, err := ReadEndTimeQuery(r, "to")
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
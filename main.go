@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+	_ "time/tzdata" // workouts store an IANA timezone, don't depend on the host for it
 
 	"github.com/edwinboon/workout-tracking-api/internal/app"
 	"github.com/edwinboon/workout-tracking-api/internal/routes"
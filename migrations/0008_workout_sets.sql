@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_sets (
+  id BIGSERIAL PRIMARY KEY,
+  workout_entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+  set_index INTEGER NOT NULL,
+  set_type VARCHAR(20) NOT NULL DEFAULT 'working',
+  reps INTEGER,
+  weight DECIMAL(5, 2),
+  duration_seconds INTEGER,
+  rpe DECIMAL(3, 1),
+  completed BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT valid_set_type CHECK (set_type IN ('warmup', 'working', 'drop', 'failure')),
+  CONSTRAINT valid_rpe CHECK (rpe IS NULL OR (rpe >= 1 AND rpe <= 10)),
+  CONSTRAINT valid_workout_set CHECK (reps IS NOT NULL OR duration_seconds IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_sets_entry ON workout_sets(workout_entry_id, set_index);
+
+-- existing entries become that many identical working sets
+INSERT INTO workout_sets (workout_entry_id, set_index, reps, weight, duration_seconds)
+SELECT e.id, s.n, e.reps, e.weight, e.duration_seconds
+FROM workout_entries e
+CROSS JOIN LATERAL generate_series(1, GREATEST(e.sets, 1)) AS s(n);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_sets;
+-- +goose StatementEnd
@@ -0,0 +1,74 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exercises (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) UNIQUE NOT NULL,
+  aliases TEXT[] NOT NULL DEFAULT '{}',
+  primary_muscles TEXT[] NOT NULL DEFAULT '{}',
+  secondary_muscles TEXT[] NOT NULL DEFAULT '{}',
+  equipment VARCHAR(50) NOT NULL,
+  movement_pattern VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO exercises (name, aliases, primary_muscles, secondary_muscles, equipment, movement_pattern) VALUES
+  ('Bench Press', '{"BP", "Barbell Bench Press", "Flat Bench", "Flat Bench Press"}', '{"chest"}', '{"triceps", "shoulders"}', 'barbell', 'horizontal_push'),
+  ('Incline Bench Press', '{"Incline BP", "Incline Barbell Bench Press"}', '{"chest"}', '{"shoulders", "triceps"}', 'barbell', 'horizontal_push'),
+  ('Dumbbell Bench Press', '{"DB Bench", "DB Bench Press"}', '{"chest"}', '{"triceps", "shoulders"}', 'dumbbell', 'horizontal_push'),
+  ('Push-up', '{"Push up", "Pushup", "Press up"}', '{"chest"}', '{"triceps", "shoulders", "core"}', 'bodyweight', 'horizontal_push'),
+  ('Dip', '{"Dips", "Chest Dip", "Tricep Dip"}', '{"chest", "triceps"}', '{"shoulders"}', 'bodyweight', 'vertical_push'),
+  ('Overhead Press', '{"OHP", "Military Press", "Shoulder Press", "Standing Press"}', '{"shoulders"}', '{"triceps", "core"}', 'barbell', 'vertical_push'),
+  ('Dumbbell Shoulder Press', '{"DB Shoulder Press", "Seated Dumbbell Press"}', '{"shoulders"}', '{"triceps"}', 'dumbbell', 'vertical_push'),
+  ('Lateral Raise', '{"Side Raise", "Lateral Raises", "DB Lateral Raise"}', '{"shoulders"}', '{}', 'dumbbell', 'isolation'),
+  ('Triceps Pushdown', '{"Tricep Pushdown", "Cable Pushdown", "Rope Pushdown"}', '{"triceps"}', '{}', 'cable', 'isolation'),
+  ('Skull Crusher', '{"Skullcrusher", "Lying Triceps Extension"}', '{"triceps"}', '{}', 'barbell', 'isolation'),
+  ('Pull-up', '{"Pull up", "Pullup"}', '{"lats"}', '{"biceps", "back"}', 'bodyweight', 'vertical_pull'),
+  ('Chin-up', '{"Chin up", "Chinup"}', '{"lats", "biceps"}', '{"back"}', 'bodyweight', 'vertical_pull'),
+  ('Lat Pulldown', '{"Pulldown", "Lat Pull Down"}', '{"lats"}', '{"biceps"}', 'cable', 'vertical_pull'),
+  ('Barbell Row', '{"Bent Over Row", "BB Row", "Pendlay Row"}', '{"back", "lats"}', '{"biceps", "hamstrings"}', 'barbell', 'horizontal_pull'),
+  ('Dumbbell Row', '{"DB Row", "One Arm Dumbbell Row"}', '{"back", "lats"}', '{"biceps"}', 'dumbbell', 'horizontal_pull'),
+  ('Seated Cable Row', '{"Cable Row", "Seated Row"}', '{"back"}', '{"lats", "biceps"}', 'cable', 'horizontal_pull'),
+  ('Face Pull', '{"Face Pulls", "Cable Face Pull"}', '{"shoulders", "traps"}', '{"back"}', 'cable', 'horizontal_pull'),
+  ('Barbell Curl', '{"Curl", "Biceps Curl", "BB Curl"}', '{"biceps"}', '{"forearms"}', 'barbell', 'isolation'),
+  ('Dumbbell Curl', '{"DB Curl", "Hammer Curl"}', '{"biceps"}', '{"forearms"}', 'dumbbell', 'isolation'),
+  ('Shrug', '{"Shrugs", "Barbell Shrug"}', '{"traps"}', '{"forearms"}', 'barbell', 'isolation'),
+  ('Back Squat', '{"Squat", "Squats", "Barbell Squat", "High Bar Squat", "Low Bar Squat"}', '{"quadriceps", "glutes"}', '{"hamstrings", "core"}', 'barbell', 'squat'),
+  ('Front Squat', '{"Barbell Front Squat"}', '{"quadriceps"}', '{"glutes", "core"}', 'barbell', 'squat'),
+  ('Goblet Squat', '{"DB Goblet Squat", "KB Goblet Squat"}', '{"quadriceps", "glutes"}', '{"core"}', 'dumbbell', 'squat'),
+  ('Leg Press', '{"Machine Leg Press"}', '{"quadriceps", "glutes"}', '{"hamstrings"}', 'machine', 'squat'),
+  ('Leg Extension', '{"Leg Extensions"}', '{"quadriceps"}', '{}', 'machine', 'isolation'),
+  ('Deadlift', '{"DL", "Conventional Deadlift", "Barbell Deadlift"}', '{"hamstrings", "glutes", "back"}', '{"quadriceps", "traps", "forearms"}', 'barbell', 'hinge'),
+  ('Romanian Deadlift', '{"RDL", "Stiff Leg Deadlift"}', '{"hamstrings", "glutes"}', '{"back"}', 'barbell', 'hinge'),
+  ('Hip Thrust', '{"Barbell Hip Thrust", "Glute Bridge"}', '{"glutes"}', '{"hamstrings"}', 'barbell', 'hinge'),
+  ('Kettlebell Swing', '{"KB Swing", "Swing"}', '{"glutes", "hamstrings"}', '{"core", "shoulders"}', 'kettlebell', 'hinge'),
+  ('Leg Curl', '{"Hamstring Curl", "Lying Leg Curl", "Seated Leg Curl"}', '{"hamstrings"}', '{}', 'machine', 'isolation'),
+  ('Lunge', '{"Lunges", "Walking Lunge", "Dumbbell Lunge"}', '{"quadriceps", "glutes"}', '{"hamstrings"}', 'dumbbell', 'lunge'),
+  ('Bulgarian Split Squat', '{"BSS", "Split Squat", "Rear Foot Elevated Split Squat"}', '{"quadriceps", "glutes"}', '{"hamstrings"}', 'dumbbell', 'lunge'),
+  ('Calf Raise', '{"Calf Raises", "Standing Calf Raise"}', '{"calves"}', '{}', 'machine', 'isolation'),
+  ('Farmer''s Carry', '{"Farmers Walk", "Farmer Carry", "Farmers Carry"}', '{"forearms", "traps"}', '{"core"}', 'dumbbell', 'carry'),
+  ('Plank', '{"Front Plank", "Planks"}', '{"core"}', '{"shoulders"}', 'bodyweight', 'core'),
+  ('Crunch', '{"Crunches", "Sit-up", "Sit up"}', '{"core"}', '{}', 'bodyweight', 'core'),
+  ('Hanging Leg Raise', '{"Leg Raise", "Hanging Knee Raise"}', '{"core"}', '{"forearms"}', 'bodyweight', 'core'),
+  ('Running', '{"Run", "Jogging", "Jog", "Treadmill"}', '{"cardio"}', '{"quadriceps", "calves"}', 'none', 'cardio'),
+  ('Walking', '{"Walk", "Hiking"}', '{"cardio"}', '{"calves"}', 'none', 'cardio'),
+  ('Cycling', '{"Bike", "Ride", "Indoor Cycling", "Spinning"}', '{"cardio"}', '{"quadriceps"}', 'machine', 'cardio'),
+  ('Rowing', '{"Row Erg", "Rowing Machine", "Erg"}', '{"cardio"}', '{"back", "quadriceps"}', 'machine', 'cardio'),
+  ('Swimming', '{"Swim"}', '{"cardio"}', '{"shoulders", "back"}', 'none', 'cardio'),
+  ('Jump Rope', '{"Skipping", "Skipping Rope"}', '{"cardio"}', '{"calves"}', 'none', 'cardio');
+
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+
+-- link existing free text entries to the catalog
+UPDATE workout_entries we
+SET exercise_id = e.id
+FROM exercises e
+WHERE LOWER(we.exercise_name) = LOWER(e.name)
+   OR EXISTS (SELECT 1 FROM unnest(e.aliases) alias WHERE LOWER(alias) = LOWER(we.exercise_name));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN exercise_id;
+DROP TABLE exercises;
+-- +goose StatementEnd
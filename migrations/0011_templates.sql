@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS templates (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL,
+  description TEXT,
+  duration_minutes INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS template_entries (
+  id BIGSERIAL PRIMARY KEY,
+  template_id BIGINT NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+  exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL,
+  exercise_name VARCHAR(255) NOT NULL,
+  sets INTEGER NOT NULL,
+  target_reps_min INTEGER,
+  target_reps_max INTEGER,
+  target_weight_min DECIMAL(5, 2),
+  target_weight_max DECIMAL(5, 2),
+  duration_seconds INTEGER,
+  notes TEXT,
+  order_index INTEGER NOT NULL,
+  CONSTRAINT valid_template_entry CHECK (
+    (target_reps_min IS NOT NULL OR target_reps_max IS NOT NULL OR duration_seconds IS NOT NULL) AND
+    (target_reps_min IS NULL OR target_reps_max IS NULL OR target_reps_min <= target_reps_max) AND
+    (target_weight_min IS NULL OR target_weight_max IS NULL OR target_weight_min <= target_weight_max)
+  )
+);
+
+ALTER TABLE workouts
+ADD COLUMN template_id BIGINT REFERENCES templates(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_template ON workouts(template_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN template_id;
+DROP TABLE template_entries;
+DROP TABLE templates;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS programs (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR(255) NOT NULL,
+  description TEXT,
+  weeks INTEGER NOT NULL CHECK (weeks BETWEEN 1 AND 52),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS program_sessions (
+  id BIGSERIAL PRIMARY KEY,
+  program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+  week INTEGER NOT NULL,
+  day INTEGER NOT NULL CHECK (day BETWEEN 1 AND 7),
+  template_id BIGINT NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+  progression_type VARCHAR(30) NOT NULL DEFAULT 'none',
+  percent DECIMAL(4, 3),
+  training_max_percent DECIMAL(4, 3),
+  increment DECIMAL(5, 2),
+  CONSTRAINT valid_progression CHECK (
+    (progression_type = 'none') OR
+    (progression_type = 'percent_training_max' AND percent IS NOT NULL) OR
+    (progression_type = 'linear' AND increment IS NOT NULL)
+  ),
+  UNIQUE (program_id, week, day)
+);
+
+CREATE TABLE IF NOT EXISTS program_enrollments (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  program_id BIGINT NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+  start_date DATE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, program_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE program_enrollments;
+DROP TABLE program_sessions;
+DROP TABLE programs;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_workout_entry,
+ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'strength',
+ADD COLUMN distance_meters DECIMAL(9, 2),
+ADD COLUMN elevation_gain_meters DECIMAL(7, 2),
+ADD COLUMN avg_heart_rate INTEGER,
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN cadence INTEGER,
+ADD CONSTRAINT valid_entry_kind CHECK (kind IN ('strength', 'cardio', 'mobility')),
+-- strength and mobility entries are done for reps or for time, cardio for time and/or distance
+ADD CONSTRAINT valid_workout_entry CHECK (
+  CASE kind
+    WHEN 'cardio' THEN reps IS NULL AND (duration_seconds IS NOT NULL OR distance_meters IS NOT NULL)
+    ELSE (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND (reps IS NULL OR duration_seconds IS NULL)
+  END
+),
+ADD CONSTRAINT valid_heart_rate CHECK (
+  (avg_heart_rate IS NULL OR avg_heart_rate > 0) AND
+  (max_heart_rate IS NULL OR max_heart_rate > 0) AND
+  (avg_heart_rate IS NULL OR max_heart_rate IS NULL OR avg_heart_rate <= max_heart_rate)
+);
+
+ALTER TABLE workout_sets
+DROP CONSTRAINT valid_workout_set,
+ADD COLUMN distance_meters DECIMAL(9, 2),
+ADD CONSTRAINT valid_workout_set CHECK (reps IS NOT NULL OR duration_seconds IS NOT NULL OR distance_meters IS NOT NULL);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_sets
+DROP CONSTRAINT valid_workout_set,
+DROP COLUMN distance_meters,
+ADD CONSTRAINT valid_workout_set CHECK (reps IS NOT NULL OR duration_seconds IS NOT NULL);
+
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_heart_rate,
+DROP CONSTRAINT valid_workout_entry,
+DROP CONSTRAINT valid_entry_kind,
+DROP COLUMN kind,
+DROP COLUMN distance_meters,
+DROP COLUMN elevation_gain_meters,
+DROP COLUMN avg_heart_rate,
+DROP COLUMN max_heart_rate,
+DROP COLUMN cadence,
+ADD CONSTRAINT valid_workout_entry CHECK (
+  (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+  (reps IS NULL OR duration_seconds IS NULL)
+);
+-- +goose StatementEnd
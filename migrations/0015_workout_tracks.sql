@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_tracks (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  point_index INTEGER NOT NULL,
+  recorded_at TIMESTAMP WITH TIME ZONE,
+  latitude DOUBLE PRECISION,
+  longitude DOUBLE PRECISION,
+  elevation_meters DOUBLE PRECISION,
+  distance_meters DOUBLE PRECISION,
+  heart_rate INTEGER,
+  cadence INTEGER,
+  UNIQUE (workout_id, point_index)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_tracks;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN activated BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- accounts from before email verification keep working
+UPDATE users SET activated = TRUE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN activated,
+DROP COLUMN email_verified_at;
+-- +goose StatementEnd
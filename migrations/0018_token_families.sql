@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens
+ADD COLUMN family_id VARCHAR(64),
+ADD COLUMN used_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_tokens_family_id ON tokens(family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tokens_family_id;
+
+ALTER TABLE tokens
+DROP COLUMN family_id,
+DROP COLUMN used_at;
+-- +goose StatementEnd
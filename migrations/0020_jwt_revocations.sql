@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS jwt_revocations (
+  id BIGSERIAL PRIMARY KEY,
+  jti VARCHAR(64),
+  family_id VARCHAR(64),
+  user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+  revoked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expiry TIMESTAMP WITH TIME ZONE NOT NULL,
+  CONSTRAINT valid_jwt_revocation CHECK (num_nonnulls(jti, family_id, user_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_jwt_revocations_expiry ON jwt_revocations(expiry);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE jwt_revocations;
+-- +goose StatementEnd
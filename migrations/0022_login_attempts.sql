@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- failed logins per username or ip, the key says which, e.g. "username:johndoe"
+CREATE TABLE IF NOT EXISTS login_attempts (
+  key VARCHAR(320) PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+  id BIGSERIAL PRIMARY KEY,
+  key VARCHAR(320) NOT NULL,
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  failures INTEGER NOT NULL,
+  locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lockout_events_created_at ON lockout_events(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE lockout_events;
+DROP TABLE login_attempts;
+-- +goose StatementEnd
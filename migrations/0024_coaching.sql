@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+-- an athlete invites a coach, the coach gets access once they accept
+CREATE TABLE IF NOT EXISTS coachings (
+  id BIGSERIAL PRIMARY KEY,
+  coach_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  athlete_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  access VARCHAR(20) NOT NULL CHECK (access IN ('read', 'read_write')),
+  status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted')),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  accepted_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (coach_id, athlete_id),
+  CHECK (coach_id <> athlete_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coachings_athlete_id ON coachings(athlete_id);
+
+-- a planned workout was put in the calendar of an athlete by their coach
+ALTER TABLE workouts
+ADD COLUMN planned BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN planned_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+
+-- a comment stays on the workout when its entry is removed
+CREATE TABLE IF NOT EXISTS workout_comments (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  entry_id BIGINT REFERENCES workout_entries(id) ON DELETE SET NULL,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_comments_workout_id ON workout_comments(workout_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_comments;
+
+ALTER TABLE workouts
+DROP COLUMN planned,
+DROP COLUMN planned_by;
+
+DROP TABLE coachings;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS organizations (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the admins of an organization manage its members
+CREATE TABLE IF NOT EXISTS organization_members (
+  organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'admin')),
+  joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+-- workouts are private unless their owner shares them with their organizations
+ALTER TABLE workouts
+ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'private',
+ADD CONSTRAINT valid_workout_visibility CHECK (visibility IN ('private', 'org'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP CONSTRAINT valid_workout_visibility,
+DROP COLUMN visibility;
+
+DROP TABLE organization_members;
+DROP TABLE organizations;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+DROP CONSTRAINT valid_workout_visibility,
+ADD CONSTRAINT valid_workout_visibility CHECK (visibility IN ('private', 'org', 'followers', 'public', 'unlisted'));
+
+CREATE TABLE IF NOT EXISTS follows (
+  follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (follower_id, followee_id),
+  CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_followee_id ON follows(followee_id);
+
+-- share links of a workout, like tokens only the hash of a link is stored
+CREATE TABLE IF NOT EXISTS workout_shares (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  prefix VARCHAR(20) NOT NULL,
+  hash BYTEA NOT NULL UNIQUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_shares_workout_id ON workout_shares(workout_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE workout_shares;
+DROP TABLE follows;
+
+UPDATE workouts SET visibility = 'private' WHERE visibility NOT IN ('private', 'org');
+
+ALTER TABLE workouts
+DROP CONSTRAINT valid_workout_visibility,
+ADD CONSTRAINT valid_workout_visibility CHECK (visibility IN ('private', 'org'));
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- members are invited by an admin and only join once they accept, the members
+-- that are already in an organization keep their membership
+ALTER TABLE organization_members
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'accepted' CHECK (status IN ('pending', 'accepted'));
+
+ALTER TABLE organization_members
+ALTER COLUMN status SET DEFAULT 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM organization_members WHERE status = 'pending';
+
+ALTER TABLE organization_members
+DROP COLUMN status;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a follow is a request until the followee accepts it, only then the follower
+-- sees the workouts for followers. The follows that already exist were never
+-- approved, so they are requests too.
+ALTER TABLE follows
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted')),
+ADD COLUMN accepted_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE follows
+DROP COLUMN accepted_at,
+DROP COLUMN status;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a template can't be deleted while a program uses it, the sessions of the
+-- users that are enrolled would vanish with it. NO ACTION instead of RESTRICT
+-- so the check waits for the end of the statement
+ALTER TABLE program_sessions
+DROP CONSTRAINT program_sessions_template_id_fkey,
+ADD CONSTRAINT program_sessions_template_id_fkey FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE NO ACTION;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE program_sessions
+DROP CONSTRAINT program_sessions_template_id_fkey,
+ADD CONSTRAINT program_sessions_template_id_fkey FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE;
+-- +goose StatementEnd